@@ -19,15 +19,92 @@ package v1alpha1
 import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const (
 	AMDPCIVendorID = "1002"
 )
 
+// condition types reported in the DeviceConfig status
+const (
+	// ConditionTypeReady is set to True when all the operands are deployed and available
+	ConditionTypeReady = "Ready"
+	// ConditionTypeProgressing is set to True while the operands are being rolled out
+	ConditionTypeProgressing = "Progressing"
+	// ConditionTypeDegraded is set to True when one of the reconciliation steps failed
+	ConditionTypeDegraded = "Degraded"
+	// ConditionTypePrebuiltImagesMissing is set to True when the build policy is Never and some of the selected
+	// nodes have no prebuilt drivers image
+	ConditionTypePrebuiltImagesMissing = "PrebuiltImagesMissing"
+)
+
+// condition reasons reported in the DeviceConfig status
+const (
+	ReasonNodeOverlapCheckFailed = "NodeOverlapCheckFailed"
+	ReasonBuildConfigMapFailed   = "BuildConfigMapFailed"
+	ReasonKMMModuleFailed        = "KMMModuleFailed"
+	ReasonDevicePluginFailed     = "DevicePluginFailed"
+	ReasonNodeLabellerFailed     = "NodeLabellerFailed"
+	ReasonNodeMetricsFailed      = "NodeMetricsFailed"
+	ReasonOperandsAvailable      = "OperandsAvailable"
+	ReasonOperandsNotAvailable   = "OperandsNotAvailable"
+	ReasonNoMatchingNodes        = "NoMatchingNodes"
+	ReasonReconcileSucceeded     = "ReconcileSucceeded"
+	ReasonNodesOverlap           = "NodesOverlap"
+	ReasonUpgradeFailed          = "UpgradeFailed"
+	ReasonBlacklistFailed        = "BlacklistFailed"
+	ReasonPrebuiltImagesMissing  = "NodesWithoutPrebuiltImage"
+	ReasonPrebuiltImagesFound    = "PrebuiltImagesFound"
+	ReasonPartitioningFailed     = "PartitioningFailed"
+	ReasonPreflightFailed        = "PreflightFailed"
+)
+
+// node upgrade states reported in the DeviceConfig status
+const (
+	// UpgradeStateStarted is set when the node is selected for the upgrade
+	UpgradeStateStarted = "Upgrade-Started"
+	// UpgradeStateDrain is set while the node is cordoned and its pods are evicted
+	UpgradeStateDrain = "Drain"
+	// UpgradeStateModuleReload is set while KMM unloads the old drivers and loads the new ones
+	UpgradeStateModuleReload = "Module-Reload"
+	// UpgradeStateDone is set once the new drivers are loaded and the node is uncordoned, unless it was
+	// already cordoned when the upgrade started
+	UpgradeStateDone = "Done"
+	// UpgradeStateFailed is set when the node could not be drained in time. The node stays cordoned,
+	// labelled with amd.io/gpu-driver-upgrade-state=Failed, and counts as unavailable until the next
+	// DriversVersion change
+	UpgradeStateFailed = "Failed"
+)
+
+// node partitioning states reported in the DeviceConfig status
+const (
+	// PartitionStateDrain is set while the node is cordoned and its pods are evicted
+	PartitionStateDrain = "Drain"
+	// PartitionStateApply is set while the partition agent applies the profile on the node
+	PartitionStateApply = "Apply"
+	// PartitionStateDone is set once the profile is applied, the node relabelled and uncordoned
+	PartitionStateDone = "Done"
+	// PartitionStateFailed is set when the node could not be drained in time or the profile could not be
+	// applied. The node stays cordoned until the profile changes
+	PartitionStateFailed = "Failed"
+)
+
+// preflight validation states reported in the DeviceConfig status
+const (
+	// PreflightStateRunning is set while KMM validates the drivers version against the kernels
+	PreflightStateRunning = "Running"
+	// PreflightStateSucceeded is set once all the kernels were validated
+	PreflightStateSucceeded = "Succeeded"
+	// PreflightStateFailed is set when the validation failed for one of the kernels. The KMM Module is not
+	// changed until the DriversVersion or the kernels change
+	PreflightStateFailed = "Failed"
+)
+
 // DeviceConfigSpec describes how the AMD GPU operator should enable AMD GPU device for customer's use.
 type DeviceConfigSpec struct {
-	// if the in-tree driver should be used instead of OOT drivers
+	// if the in-tree driver should be used instead of OOT drivers. In that case no drivers are built or loaded
+	// by KMM, and the device plugin, node labeller and node metrics are deployed on all the nodes matching the Selector
 	UseInTreeDrivers bool `json:"useInTreeDrivers,omitempty"`
 
 	// defines image that includes drivers and firmware blobs
@@ -38,6 +115,16 @@ type DeviceConfigSpec struct {
 	// +optional
 	DriversVersion string `json:"driversVersion,omitempty"`
 
+	// KernelMappings define per kernel drivers image, version and build settings.
+	// Nodes are matched against the mappings in order, and the first matching mapping is used.
+	// If no mappings are defined, a single mapping matching all kernels is used, based on DriversImage and DriversVersion
+	// +optional
+	KernelMappings []KernelMapping `json:"kernelMappings,omitempty"`
+
+	// Signing defines the secrets used to sign the OOT kernel modules, required on Secure Boot enabled nodes
+	// +optional
+	Signing *ModuleSigning `json:"signing,omitempty"`
+
 	// device plugin image
 	// +optional
 	DevicePluginImage string `json:"devicePluginImage,omitempty"`
@@ -49,6 +136,528 @@ type DeviceConfigSpec struct {
 	// Selector describes on which nodes the GPU Operator should enable the GPU device.
 	// +optional
 	Selector map[string]string `json:"selector,omitempty"`
+
+	// DevicePlugin defines the configuration of the device plugin, deployed by KMM for OOT drivers and by the
+	// operator for in-tree drivers
+	// +optional
+	DevicePlugin DevicePluginSpec `json:"devicePlugin,omitempty"`
+
+	// NodeLabeller defines the deployment of the node labeller, which labels the nodes with the properties of their GPUs
+	// +optional
+	NodeLabeller NodeLabellerSpec `json:"nodeLabeller,omitempty"`
+
+	// MetricsExporter defines the deployment of the metrics exporter, and the Service and ServiceMonitor exposing it
+	// +optional
+	MetricsExporter MetricsExporterSpec `json:"metricsExporter,omitempty"`
+
+	// Tolerations of the operand pods (node labeller, metrics exporter and device plugin), e.g. to run
+	// on GPU nodes tainted with amd.com/gpu:NoSchedule.
+	// The KMM Module API does not expose tolerations, so they are not applied to the pods deployed by KMM
+	// +optional
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+
+	// NodeAffinity further restricts the nodes the operand pods run on, in addition to the Selector.
+	// The KMM Module API does not expose affinity, so it is not applied to the pods deployed by KMM
+	// +optional
+	NodeAffinity *v1.NodeAffinity `json:"nodeAffinity,omitempty"`
+
+	// PriorityClassName of the operand pods. Defaults to system-node-critical.
+	// The KMM Module API does not expose the priority class, so it is not applied to the pods deployed by KMM
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// Resources of the operand containers. They are also applied to the device plugin deployed by KMM,
+	// the KMM module loader container does not expose resources
+	// +optional
+	Resources v1.ResourceRequirements `json:"resources,omitempty"`
+
+	// UpgradePolicy rolls out DriversVersion changes node by node, draining each node before KMM reloads its drivers.
+	// If not set, a DriversVersion change is applied by KMM on all the nodes at once. When set, DriversImage and the
+	// drivers of KernelMappings can only be changed together with DriversVersion, which is set in a node label and
+	// must be a valid label value
+	// +optional
+	UpgradePolicy *UpgradePolicySpec `json:"upgradePolicy,omitempty"`
+
+	// Blacklist defines how the inbox amdgpu driver is blacklisted on the selected nodes,
+	// so that it is not loaded at boot instead of the OOT drivers. On OpenShift the MachineConfig
+	// applies to the whole MachineConfigPool of the selected nodes: all the nodes of the pool are
+	// blacklisted and rebooted, so a dedicated pool for the GPU nodes is recommended
+	// +optional
+	Blacklist BlacklistSpec `json:"blacklist,omitempty"`
+
+	// Driver defines how the OOT drivers are built
+	// +optional
+	Driver DriverSpec `json:"driver,omitempty"`
+
+	// Partitioning applies a compute and memory partitioning profile to the GPUs of the selected nodes,
+	// e.g. on MI300 accelerators. The nodes are drained one at a time before the profile is applied
+	// +optional
+	Partitioning *PartitioningSpec `json:"partitioning,omitempty"`
+}
+
+// DriverSpec defines the OOT drivers
+type DriverSpec struct {
+	// Build defines how the drivers images are built
+	// +optional
+	Build DriverBuildSpec `json:"build,omitempty"`
+
+	// Modprobe defines how the drivers are loaded on the nodes
+	// +optional
+	Modprobe ModprobeSpec `json:"modprobe,omitempty"`
+
+	// Preflight defines the KMM preflight validation of new drivers versions and kernels
+	// +optional
+	Preflight PreflightSpec `json:"preflight,omitempty"`
+}
+
+// PreflightSpec defines the KMM preflight validation run before the KMM Module is changed
+type PreflightSpec struct {
+	// Enable validates every new drivers version and kernel of the selected nodes with a KMM PreflightValidation.
+	// The KMM Module is only created or changed once all the kernels were validated
+	// +optional
+	Enable bool `json:"enable,omitempty"`
+
+	// PushBuiltImage pushes the drivers images built during the preflight validation to the registry
+	// +optional
+	PushBuiltImage bool `json:"pushBuiltImage,omitempty"`
+}
+
+// ModprobeSpec defines how the amdgpu module is loaded
+type ModprobeSpec struct {
+	// Parameters are the amdgpu module parameters, in the key=value form, e.g. sched_policy=1.
+	// Only the known amdgpu parameters are accepted
+	// +optional
+	Parameters []string `json:"parameters,omitempty"`
+
+	// RawArgs are passed as is to modprobe when loading and unloading the drivers, instead of the arguments set
+	// by the operator. Parameters cannot be set together with RawArgs
+	// +optional
+	RawArgs *ModprobeArgs `json:"rawArgs,omitempty"`
+
+	// LoadOrder are the modules in the order they are loaded, e.g. amdkcl, amdxcp, amd-sched, amdttm, amdgpu.
+	// The last module must be amdgpu. If not set, the order is resolved by modprobe from the modules dependencies
+	// +optional
+	LoadOrder []string `json:"loadOrder,omitempty"`
+}
+
+// ModprobeArgs are the modprobe arguments used to load and unload the drivers
+type ModprobeArgs struct {
+	// Load are the arguments used to load the drivers
+	// +optional
+	Load []string `json:"load,omitempty"`
+
+	// Unload are the arguments used to unload the drivers
+	// +optional
+	Unload []string `json:"unload,omitempty"`
+}
+
+// BuildPolicy defines when the drivers images are built in the cluster
+// +kubebuilder:validation:Enum=Always;IfNotPresent;Never
+type BuildPolicy string
+
+const (
+	// BuildPolicyAlways builds all the drivers images in the cluster. User provided drivers images are not allowed
+	BuildPolicyAlways BuildPolicy = "Always"
+	// BuildPolicyIfNotPresent builds the drivers images missing from the registry
+	BuildPolicyIfNotPresent BuildPolicy = "IfNotPresent"
+	// BuildPolicyNever never builds the drivers images, which must be prebuilt and pushed to the registry
+	BuildPolicyNever BuildPolicy = "Never"
+)
+
+// DriverBuildSpec defines the build of the drivers images
+type DriverBuildSpec struct {
+	// Policy is one of Always, IfNotPresent and Never. With Always, the drivers images are always built in the
+	// cluster and driversImage cannot be set. With IfNotPresent, KMM builds the images missing from the registry.
+	// With Never, no build is configured and the nodes without a prebuilt image are reported in the
+	// PrebuiltImagesMissing condition. Defaults to IfNotPresent
+	// +optional
+	Policy BuildPolicy `json:"policy,omitempty"`
+
+	// DockerfileConfigMap is a ConfigMap holding the Dockerfile used to build the drivers under the "dockerfile" key.
+	// When set, the operator stops managing its own build dockerfile ConfigMaps and the Dockerfile is used for all
+	// the kernels, except the kernel mappings defining their own DockerfileConfigMap
+	// +optional
+	DockerfileConfigMap *v1.LocalObjectReference `json:"dockerfileConfigMap,omitempty"`
+
+	// SourcesImageRepo is the repository of the drivers sources images, tagged with the drivers version.
+	// It is passed to the build as the SOURCES_IMAGE_REPO build arg. Defaults to the repository set in the
+	// operator configuration, or to quay.io/yshnaidm/amd_gpu_sources
+	// +optional
+	SourcesImageRepo string `json:"sourcesImageRepo,omitempty"`
+
+	// Secrets are made available to the build under /run/secrets/<name>, e.g. to access private sources.
+	// The credentials of the registries of the sources and base images are taken from ImageRepoSecret
+	// +optional
+	Secrets []v1.LocalObjectReference `json:"secrets,omitempty"`
+
+	// BaseImageRegistryTLS defines how the registries of the images pulled by the Dockerfile are accessed
+	// +optional
+	BaseImageRegistryTLS RegistryTLS `json:"baseImageRegistryTLS,omitempty"`
+
+	// KanikoParams customizes the Kaniko build
+	// +optional
+	KanikoParams *KanikoParams `json:"kanikoParams,omitempty"`
+
+	// ExtraBuildArgs are additional build args passed to the Dockerfile. DRIVERS_VERSION and SOURCES_IMAGE_REPO
+	// are set by the operator and cannot be overridden
+	// +optional
+	ExtraBuildArgs []BuildArg `json:"extraBuildArgs,omitempty"`
+}
+
+// RegistryTLS defines how a registry is accessed
+type RegistryTLS struct {
+	// Insecure allows plain HTTP access to the registry
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
+	// InsecureSkipTLSVerify accepts any certificate served by the registry
+	// +optional
+	InsecureSkipTLSVerify bool `json:"insecureSkipTLSVerify,omitempty"`
+}
+
+// KanikoParams customizes the Kaniko build
+type KanikoParams struct {
+	// Tag is the Kaniko image tag used by the build Job
+	// +optional
+	Tag string `json:"tag,omitempty"`
+}
+
+// BuildArg is a build arg passed to the drivers Dockerfile
+type BuildArg struct {
+	// Name of the build arg
+	Name string `json:"name"`
+
+	// Value of the build arg
+	// +optional
+	Value string `json:"value,omitempty"`
+}
+
+// BlacklistSpec defines the blacklisting of the inbox amdgpu driver
+type BlacklistSpec struct {
+	// Enable controls if the operator blacklists the inbox amdgpu driver. On OpenShift a MachineConfig is
+	// created per role of the selected nodes and applies to all the nodes of the role MachineConfigPool,
+	// otherwise a DaemonSet writes the blacklist into /etc/modprobe.d of the selected nodes.
+	// The nodes must be rebooted for the blacklist to take effect. Defaults to false
+	// +optional
+	Enable bool `json:"enable,omitempty"`
+
+	// Image of the DaemonSet writing the blacklist on non OpenShift clusters
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// UpgradePolicySpec defines how the drivers are upgraded on the nodes
+type UpgradePolicySpec struct {
+	// MaxUnavailable is the maximum number or percentage of nodes upgraded at the same time. Defaults to 1
+	// +optional
+	// +kubebuilder:validation:XIntOrString
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// Drain controls if the nodes are cordoned and their pods evicted before the drivers are reloaded.
+	// Evictions respect the PodDisruptionBudgets. Defaults to true
+	// +optional
+	Drain *bool `json:"drain,omitempty"`
+
+	// DrainTimeoutSeconds is the time after which a node that could not be drained is marked as failed.
+	// Defaults to 300
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	DrainTimeoutSeconds int32 `json:"drainTimeoutSeconds,omitempty"`
+
+	// PodSelector is a label selector restricting the evicted pods, e.g. to the pods using the GPUs.
+	// If not set, all the pods except DaemonSet and mirror pods are evicted
+	// +optional
+	PodSelector string `json:"podSelector,omitempty"`
+}
+
+// ComputePartition is a GPU compute partition mode
+// +kubebuilder:validation:Enum=SPX;DPX;QPX;CPX
+type ComputePartition string
+
+// MemoryPartition is a GPU memory partition mode
+// +kubebuilder:validation:Enum=NPS1;NPS4
+type MemoryPartition string
+
+// PartitioningSpec defines the GPU partitioning profile of the selected nodes
+type PartitioningSpec struct {
+	// ComputePartition is the compute partition mode written to current_compute_partition of the GPUs
+	ComputePartition ComputePartition `json:"computePartition"`
+
+	// MemoryPartition is the memory partition mode written to current_memory_partition of the GPUs.
+	// If not set, the memory partition mode is not changed
+	// +optional
+	MemoryPartition MemoryPartition `json:"memoryPartition,omitempty"`
+
+	// Image of the partition agent DaemonSet applying the profile on the nodes
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// DrainTimeoutSeconds is the time after which a node that could not be drained is marked as failed.
+	// Defaults to 300
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	DrainTimeoutSeconds int32 `json:"drainTimeoutSeconds,omitempty"`
+
+	// PodSelector is a label selector restricting the evicted pods, e.g. to the pods using the GPUs.
+	// If not set, all the pods except DaemonSet and mirror pods are evicted
+	// +optional
+	PodSelector string `json:"podSelector,omitempty"`
+}
+
+// NodePartitionStatus contains the partitioning state of a node
+type NodePartitionStatus struct {
+	// NodeName is the name of the node
+	NodeName string `json:"nodeName"`
+	// State is one of Drain, Apply, Done and Failed
+	State string `json:"state"`
+	// Profile is the partitioning profile of the node, e.g. CPX-NPS4
+	Profile string `json:"profile,omitempty"`
+	// Cordoned is set while the node is cordoned by the partitioning. Nodes that were already cordoned are
+	// left cordoned once partitioned
+	// +optional
+	Cordoned bool `json:"cordoned,omitempty"`
+	// LastTransitionTime is the time the node entered the state
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+	// Message is a human readable description of the state
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// NodeUpgradeStatus contains the drivers upgrade state of a node
+type NodeUpgradeStatus struct {
+	// NodeName is the name of the node
+	NodeName string `json:"nodeName"`
+	// State is one of Upgrade-Started, Drain, Module-Reload, Done and Failed
+	State string `json:"state"`
+	// DriversVersion is the version the node is upgraded to
+	DriversVersion string `json:"driversVersion,omitempty"`
+	// Cordoned is set while the node is cordoned by the upgrade. Nodes that were already cordoned are left
+	// cordoned once upgraded
+	// +optional
+	Cordoned bool `json:"cordoned,omitempty"`
+	// LastTransitionTime is the time the node entered the state
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+	// Message is a human readable description of the state
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// PreflightStatus contains the result of the preflight validation of a drivers version
+type PreflightStatus struct {
+	// DriversVersion is the validated drivers version
+	DriversVersion string `json:"driversVersion,omitempty"`
+	// ModuleHash is the hash of the validated KMM Module spec. Any change to the drivers images, kernel mappings or
+	// build settings restarts the validation
+	// +optional
+	ModuleHash string `json:"moduleHash,omitempty"`
+	// State is one of Running, Succeeded and Failed
+	State string `json:"state"`
+	// Kernels contain the validation result of each kernel of the selected nodes
+	// +optional
+	// +listType=map
+	// +listMapKey=kernel
+	Kernels []PreflightKernelStatus `json:"kernels,omitempty"`
+}
+
+// PreflightKernelStatus contains the preflight validation result of a kernel
+type PreflightKernelStatus struct {
+	// Kernel is the validated kernel version
+	Kernel string `json:"kernel"`
+	// VerificationStatus is True once the drivers were validated for the kernel, and False otherwise
+	// +optional
+	VerificationStatus string `json:"verificationStatus,omitempty"`
+	// VerificationStage is the KMM verification stage: Image, Build, Sign, Requeued or Done
+	// +optional
+	VerificationStage string `json:"verificationStage,omitempty"`
+	// Reason describes the verification status
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// NodeLabellerLabel is a family of labels published by the node labeller
+// +kubebuilder:validation:Enum=vram;cu-count;simd-count;device-id;family;product-name;driver-version;driver-src-version;compute-partitioning-supported;memory-partitioning-supported;compute-memory-partition
+type NodeLabellerLabel string
+
+// ResourceNamingStrategy defines how the device plugin names the GPU resources it advertises
+// +kubebuilder:validation:Enum=single;mixed
+type ResourceNamingStrategy string
+
+const (
+	// ResourceNamingStrategySingle advertises all the GPUs and GPU partitions as amd.com/gpu
+	ResourceNamingStrategySingle ResourceNamingStrategy = "single"
+	// ResourceNamingStrategyMixed advertises a resource per partition type, e.g. amd.com/cpx_nps1
+	ResourceNamingStrategyMixed ResourceNamingStrategy = "mixed"
+)
+
+// DevicePluginSpec defines the device plugin configuration
+type DevicePluginSpec struct {
+	// pull policy of the device plugin image.
+	// Defaults to Always for images without a tag or with the latest tag, and to IfNotPresent otherwise
+	// +optional
+	ImagePullPolicy v1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// ResourceNamingStrategy is single to advertise all the GPUs as amd.com/gpu, or mixed to advertise a resource
+	// per partition type. If not set, the device plugin default is used
+	// +optional
+	ResourceNamingStrategy ResourceNamingStrategy `json:"resourceNamingStrategy,omitempty"`
+
+	// HealthCheckInterval is the number of seconds between the GPU health checks, 0 disables the health checks.
+	// If not set, the device plugin default is used
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	HealthCheckInterval *int32 `json:"healthCheckInterval,omitempty"`
+
+	// ConfigMap holding the device plugin configuration files. It is mounted in the device plugin container at
+	// /etc/amd-gpu-device-plugin, so that the files can be referenced in Args
+	// +optional
+	ConfigMap *v1.LocalObjectReference `json:"configMap,omitempty"`
+
+	// Args are additional arguments passed to the device plugin, after the ones set by the operator
+	// +optional
+	Args []string `json:"args,omitempty"`
+
+	// Env are additional environment variables of the device plugin container
+	// +optional
+	Env []v1.EnvVar `json:"env,omitempty"`
+
+	// Resources of the device plugin container. Defaults to the Resources of the operand containers
+	// +optional
+	Resources *v1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// NodeLabellerSpec defines the node labeller deployment
+type NodeLabellerSpec struct {
+	// Enable controls if the node labeller is deployed. Defaults to true
+	// +optional
+	Enable *bool `json:"enable,omitempty"`
+
+	// node labeller image
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// pull policy of the node labeller image.
+	// Defaults to Always for images without a tag or with the latest tag, and to IfNotPresent otherwise
+	// +optional
+	ImagePullPolicy v1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// Labels are the families of labels the node labeller publishes on the nodes.
+	// Defaults to vram, cu-count, simd-count, device-id and family
+	// +optional
+	Labels []NodeLabellerLabel `json:"labels,omitempty"`
+
+	// ExtraArgs are additional arguments passed to the node labeller
+	// +optional
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+}
+
+// KernelMapping defines the drivers image and build settings for the nodes whose kernel matches it.
+// Exactly one of Regexp and Literal must be set
+type KernelMapping struct {
+	// Regexp is a regular expression to be matched against node kernels
+	// +optional
+	Regexp string `json:"regexp,omitempty"`
+
+	// Literal is a kernel version to be matched exactly against node kernels
+	// +optional
+	Literal string `json:"literal,omitempty"`
+
+	// defines image that includes drivers and firmware blobs for the matching kernels.
+	// Defaults to DriversImage
+	// +optional
+	DriversImage string `json:"driversImage,omitempty"`
+
+	// version of the drivers source code for the matching kernels.
+	// Defaults to DriversVersion
+	// +optional
+	DriversVersion string `json:"driversVersion,omitempty"`
+
+	// DockerfileConfigMap overrides the Dockerfile used to build the drivers for the matching kernels.
+	// The ConfigMap must contain the Dockerfile under the "dockerfile" key
+	// +optional
+	DockerfileConfigMap *v1.LocalObjectReference `json:"dockerfileConfigMap,omitempty"`
+}
+
+// ModuleSigning defines how the OOT kernel modules are signed for Secure Boot enabled nodes
+type ModuleSigning struct {
+	// KeySecret is the secret holding the private key used to sign the kernel modules
+	KeySecret *v1.LocalObjectReference `json:"keySecret"`
+
+	// CertSecret is the secret holding the public certificate used to sign the kernel modules
+	CertSecret *v1.LocalObjectReference `json:"certSecret"`
+
+	// FilesToSign are the paths of the kernel modules inside the drivers image that should be signed.
+	// Defaults to all the kernel modules built by the default Dockerfile
+	// +optional
+	FilesToSign []string `json:"filesToSign,omitempty"`
+}
+
+// MetricsExporterSpec defines the metrics exporter deployment
+type MetricsExporterSpec struct {
+	// Enable controls if the metrics exporter is deployed. Defaults to true
+	// +optional
+	Enable *bool `json:"enable,omitempty"`
+
+	// metrics exporter image
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// pull policy of the metrics exporter image.
+	// Defaults to Always for images without a tag or with the latest tag, and to IfNotPresent otherwise
+	// +optional
+	ImagePullPolicy v1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// Port is the host port on which the metrics exporter serves the metrics on each node,
+	// and the port of the metrics Service. Defaults to 9110
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// ServiceType is the type of the metrics Service. Defaults to ClusterIP
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort
+	// +optional
+	ServiceType v1.ServiceType `json:"serviceType,omitempty"`
+
+	// NodePort is the node port of the metrics Service when ServiceType is NodePort.
+	// If not set, a node port is allocated by Kubernetes
+	// +optional
+	NodePort int32 `json:"nodePort,omitempty"`
+
+	// RbacProxy fronts the metrics exporter with kube-rbac-proxy, so that only clients allowed to get /metrics
+	// can scrape the metrics. The operator creates the <namespace>-<name>-metrics-reader ClusterRole granting
+	// that access, to be bound to the service account of the scraping Prometheus
+	// +optional
+	RbacProxy *MetricsRbacProxySpec `json:"rbacProxy,omitempty"`
+
+	// TLS serves the metrics over TLS. When RbacProxy is set the certificate is served by kube-rbac-proxy,
+	// otherwise by the metrics exporter itself. Without TLS, kube-rbac-proxy serves a self-signed certificate
+	// +optional
+	TLS *MetricsTLSSpec `json:"tls,omitempty"`
+}
+
+// MetricsRbacProxySpec defines the kube-rbac-proxy fronting the metrics exporter
+type MetricsRbacProxySpec struct {
+	// kube-rbac-proxy image
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// MetricsTLSSpec defines the certificate of the metrics endpoint
+type MetricsTLSSpec struct {
+	// CertSecret is the secret holding the serving certificate and key under tls.crt and tls.key.
+	// The secret is mounted under /etc/metrics-exporter/tls, and the metrics exporter is started with the
+	// --tls-cert-file and --tls-key-file arguments when it serves TLS itself
+	CertSecret v1.LocalObjectReference `json:"certSecret"`
+
+	// CAKey is the key of CertSecret holding the CA certificate used by Prometheus to verify the endpoint.
+	// Defaults to ca.crt. Ignored when CAConfigMap is set
+	// +optional
+	CAKey string `json:"caKey,omitempty"`
+
+	// CAConfigMap is the ConfigMap key holding the CA certificate, for secrets without one, e.g. the service-ca.crt
+	// key of the openshift-service-ca.crt ConfigMap for certificates generated by the OpenShift service CA
+	// +optional
+	CAConfigMap *v1.ConfigMapKeySelector `json:"caConfigMap,omitempty"`
 }
 
 // DaemonSetStatus contains the status for a daemonset deployed during
@@ -68,11 +677,42 @@ type DeviceConfigStatus struct {
 	DevicePlugin DeploymentStatus `json:"devicePlugin,omitempty"`
 	// Driver contains the status of the Drivers deployment
 	Drivers DeploymentStatus `json:"driver"`
+	// NodeLabeller contains the status of the Node Labeller daemonset
+	NodeLabeller DeploymentStatus `json:"nodeLabeller,omitempty"`
+	// NodeMetrics contains the status of the Node Metrics daemonset
+	NodeMetrics DeploymentStatus `json:"nodeMetrics,omitempty"`
+	// Conditions describe the current state of the DeviceConfig: Ready, Progressing and Degraded
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// NodeUpgrades contain the drivers upgrade state of the nodes, when an UpgradePolicy is set
+	// +optional
+	// +listType=map
+	// +listMapKey=nodeName
+	NodeUpgrades []NodeUpgradeStatus `json:"nodeUpgrades,omitempty"`
+	// RebootPendingNodes are the selected nodes that must be rebooted for the inbox driver blacklist to take effect
+	// +optional
+	RebootPendingNodes []string `json:"rebootPendingNodes,omitempty"`
+	// Preflight contains the result of the last preflight validation, when it is enabled
+	// +optional
+	Preflight *PreflightStatus `json:"preflight,omitempty"`
+	// NodePartitions contain the partitioning state of the nodes, when a partitioning profile is set
+	// +optional
+	// +listType=map
+	// +listMapKey=nodeName
+	NodePartitions []NodePartitionStatus `json:"nodePartitions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:resource:scope=Namespaced,shortName=gpue
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Drivers Desired",type=integer,JSONPath=`.status.driver.desiredNumber`
+//+kubebuilder:printcolumn:name="Drivers Available",type=integer,JSONPath=`.status.driver.availableNumber`
+//+kubebuilder:printcolumn:name="Plugin Desired",type=integer,JSONPath=`.status.devicePlugin.desiredNumber`
+//+kubebuilder:printcolumn:name="Plugin Available",type=integer,JSONPath=`.status.devicePlugin.availableNumber`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // DeviceConfig describes how to enable AMD GPU device
 // +operator-sdk:csv:customresourcedefinitions:displayName="DeviceConfig"
@@ -21,6 +21,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/klog/v2/textlogger"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -32,12 +33,18 @@ import (
 
 	kmmv1beta1 "github.com/rh-ecosystem-edge/kernel-module-management/api/v1beta1"
 	gpuev1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/blacklist"
 	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/cmd"
 	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/config"
 	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/controllers"
 	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/kmmmodule"
 	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/nodelabeller"
 	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/nodemetrics"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/partition"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/platform"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/preflight"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/upgrade"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/webhook"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -82,24 +89,57 @@ func main() {
 	options := cfg.ManagerOptions()
 	options.Scheme = scheme
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), *options)
+	restConfig := ctrl.GetConfigOrDie()
+
+	mgr, err := ctrl.NewManager(restConfig, *options)
 	if err != nil {
 		cmd.FatalError(setupLogger, err, "unable to create manager")
 	}
 
+	clusterPlatform, err := platform.Parse(cfg.Drivers.Platform)
+	if err != nil {
+		cmd.FatalError(setupLogger, err, "invalid platform in the configuration file")
+	}
+	if clusterPlatform == "" {
+		discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+		if err != nil {
+			cmd.FatalError(setupLogger, err, "unable to create discovery client")
+		}
+		if clusterPlatform, err = platform.Detect(discoveryClient); err != nil {
+			cmd.FatalError(setupLogger, err, "unable to detect the platform")
+		}
+	}
+	setupLogger.Info("Running on platform", "platform", clusterPlatform)
+
 	client := mgr.GetClient()
-	kmmHandler := kmmmodule.NewKMMModule(client, scheme)
+	kmmHandler := kmmmodule.NewKMMModule(client, scheme, kmmmodule.GetBuildDefaults(clusterPlatform, cfg.Drivers))
 	nlHandler := nodelabeller.NewNodeLabeller(scheme)
 	nmHandler := nodemetrics.NewNodeMetrcis(scheme)
+	upgradeHandler := upgrade.NewUpgradeManager(client)
+	blHandler := blacklist.NewBlacklist(scheme)
+	preflightHandler := preflight.NewPreflightManager(client, scheme)
+	partitionHandler := partition.NewPartitioner(client, scheme)
 	dcr := controllers.NewDeviceConfigReconciler(
 		client,
 		kmmHandler,
 		nlHandler,
-		nmHandler)
+		nmHandler,
+		upgradeHandler,
+		blHandler,
+		preflightHandler,
+		partitionHandler,
+		mgr.GetEventRecorderFor(controllers.DeviceConfigReconcilerName))
 	if err = dcr.SetupWithManager(mgr); err != nil {
 		cmd.FatalError(setupLogger, err, "unable to create controller", "name", controllers.DeviceConfigReconcilerName)
 	}
 
+	if cfg.Webhook.Enabled {
+		setupLogger.Info("Enabling webhooks")
+		if err = webhook.NewDeviceConfigWebhook(client).SetupWebhookWithManager(mgr); err != nil {
+			cmd.FatalError(setupLogger, err, "unable to create webhook", "webhook", "DeviceConfig")
+		}
+	}
+
 	ctx := ctrl.SetupSignalHandler()
 
 	//+kubebuilder:scaffold:builder
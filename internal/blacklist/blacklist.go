@@ -0,0 +1,242 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blacklist
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	blacklistFileName       = "amdgpu-blacklist.conf"
+	blacklistDir            = "/etc/modprobe.d"
+	blacklistContent        = "blacklist amdgpu"
+	blacklistImage          = "registry.access.redhat.com/ubi9/ubi-minimal:latest"
+	blacklistServiceAccount = "amd-gpu-operator-blacklist"
+	hostMountPath           = "/host" + blacklistDir
+	ignitionVersion         = "3.2.0"
+	// mode 0644 of the blacklist file written by the MachineConfig
+	blacklistFileMode = 420
+
+	MachineConfigRoleLabel = "machineconfiguration.openshift.io/role"
+	devConfigNameLabel     = "amd.io/deviceconfig-name"
+	devConfigNSLabel       = "amd.io/deviceconfig-namespace"
+
+	nodeRoleLabelPrefix        = "node-role.kubernetes.io/"
+	machineConfigCurrentConfig = "machineconfiguration.openshift.io/currentConfig"
+	machineConfigDesiredConfig = "machineconfiguration.openshift.io/desiredConfig"
+	machineConfigState         = "machineconfiguration.openshift.io/state"
+	machineConfigStateDone     = "Done"
+	defaultNodeRole            = "worker"
+	masterNodeRole             = "master"
+	controlPlaneNodeRoleLabel  = nodeRoleLabelPrefix + "control-plane"
+	masterNodeRoleLabel        = nodeRoleLabelPrefix + masterNodeRole
+)
+
+var (
+	MachineConfigGVK     = schema.GroupVersionKind{Group: "machineconfiguration.openshift.io", Version: "v1", Kind: "MachineConfig"}
+	MachineConfigListGVK = schema.GroupVersionKind{Group: "machineconfiguration.openshift.io", Version: "v1", Kind: "MachineConfigList"}
+)
+
+//go:generate mockgen -source=blacklist.go -package=blacklist -destination=mock_blacklist.go Blacklist
+type Blacklist interface {
+	SetMachineConfigAsDesired(mc *unstructured.Unstructured, devConfig *amdv1alpha1.DeviceConfig, role string) error
+	SetBlacklistDaemonSetAsDesired(ds *appsv1.DaemonSet, devConfig *amdv1alpha1.DeviceConfig) error
+}
+
+type blacklist struct {
+	scheme *runtime.Scheme
+}
+
+func NewBlacklist(scheme *runtime.Scheme) Blacklist {
+	return &blacklist{
+		scheme: scheme,
+	}
+}
+
+// SetMachineConfigAsDesired sets the MachineConfig writing the amdgpu blacklist on the nodes of the role.
+// The MachineConfig is cluster scoped, so it is not owned by the DeviceConfig and is deleted by the
+// operator on finalization
+func (b *blacklist) SetMachineConfigAsDesired(mc *unstructured.Unstructured, devConfig *amdv1alpha1.DeviceConfig, role string) error {
+	if mc == nil {
+		return fmt.Errorf("machine config is not initialized, zero pointer")
+	}
+
+	labels := GetMachineConfigLabels(devConfig)
+	labels[MachineConfigRoleLabel] = role
+
+	mc.SetGroupVersionKind(MachineConfigGVK)
+	mc.SetLabels(labels)
+	mc.Object["spec"] = map[string]interface{}{
+		"config": map[string]interface{}{
+			"ignition": map[string]interface{}{
+				"version": ignitionVersion,
+			},
+			"storage": map[string]interface{}{
+				"files": []interface{}{
+					map[string]interface{}{
+						"path":      blacklistDir + "/" + blacklistFileName,
+						"mode":      int64(blacklistFileMode),
+						"overwrite": true,
+						"contents": map[string]interface{}{
+							"source": "data:text/plain;base64," + base64.StdEncoding.EncodeToString([]byte(blacklistContent+"\n")),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return nil
+}
+
+// SetBlacklistDaemonSetAsDesired sets the DaemonSet writing the amdgpu blacklist into /etc/modprobe.d of the
+// nodes, for clusters without the machine config operator. The pods are ready only once the node was
+// rebooted after the blacklist was written, so a pod that is not ready means a reboot is pending
+func (b *blacklist) SetBlacklistDaemonSetAsDesired(ds *appsv1.DaemonSet, devConfig *amdv1alpha1.DeviceConfig) error {
+	if ds == nil {
+		return fmt.Errorf("daemon set is not initialized, zero pointer")
+	}
+
+	image := devConfig.Spec.Blacklist.Image
+	if image == "" {
+		image = blacklistImage
+	}
+
+	blacklistFile := hostMountPath + "/" + blacklistFileName
+	// the file is only rewritten when its content differs, so that its modification time
+	// keeps telling if the node was rebooted since the blacklist was set
+	script := fmt.Sprintf(`if [ "$(cat %[1]s 2>/dev/null)" != "%[2]s" ]; then echo "%[2]s" > %[1]s; fi; exec sleep infinity`,
+		blacklistFile, blacklistContent)
+	readinessCheck := fmt.Sprintf(`[ "$(stat -c %%Y %s)" -lt "$(sed -n 's/^btime //p' /proc/stat)" ]`, blacklistFile)
+
+	hostPathDirectoryOrCreate := v1.HostPathDirectoryOrCreate
+	matchLabels := GetBlacklistPodLabels(devConfig)
+	ds.Spec = appsv1.DaemonSetSpec{
+		Selector: &metav1.LabelSelector{MatchLabels: matchLabels},
+		Template: v1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: matchLabels,
+			},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{
+					{
+						Name:            "blacklist-container",
+						Command:         []string{"/bin/sh", "-c", script},
+						Image:           image,
+						ImagePullPolicy: utils.GetImagePullPolicy(image, ""),
+						ReadinessProbe: &v1.Probe{
+							ProbeHandler: v1.ProbeHandler{
+								Exec: &v1.ExecAction{Command: []string{"/bin/sh", "-c", readinessCheck}},
+							},
+							PeriodSeconds: 60,
+						},
+						Resources:       devConfig.Spec.Resources,
+						SecurityContext: &v1.SecurityContext{Privileged: pointer.Bool(true)},
+						VolumeMounts: []v1.VolumeMount{
+							{
+								Name:      "modprobe-volume",
+								MountPath: hostMountPath,
+							},
+						},
+					},
+				},
+				Affinity:           utils.GetAffinity(devConfig),
+				PriorityClassName:  utils.GetPriorityClassName(devConfig),
+				NodeSelector:       utils.GetNodeSelector(devConfig),
+				ServiceAccountName: blacklistServiceAccount,
+				Tolerations:        devConfig.Spec.Tolerations,
+				Volumes: []v1.Volume{
+					{
+						Name: "modprobe-volume",
+						VolumeSource: v1.VolumeSource{
+							HostPath: &v1.HostPathVolumeSource{
+								Path: blacklistDir,
+								Type: &hostPathDirectoryOrCreate,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return controllerutil.SetControllerReference(devConfig, ds, b.scheme)
+}
+
+// GetMachineConfigName returns the name of the blacklist MachineConfig of the DeviceConfig for the role.
+// The 99 prefix makes the MachineConfig rendered after the default ones of the role
+func GetMachineConfigName(devConfig *amdv1alpha1.DeviceConfig, role string) string {
+	return fmt.Sprintf("99-%s-amdgpu-blacklist-%s-%s", role, devConfig.Namespace, devConfig.Name)
+}
+
+// GetMachineConfigLabels returns the labels identifying the blacklist MachineConfigs of the DeviceConfig
+func GetMachineConfigLabels(devConfig *amdv1alpha1.DeviceConfig) map[string]string {
+	return map[string]string{
+		devConfigNSLabel:   devConfig.Namespace,
+		devConfigNameLabel: devConfig.Name,
+	}
+}
+
+// GetBlacklistPodLabels returns the labels of the blacklist DaemonSet pods of the DeviceConfig
+func GetBlacklistPodLabels(devConfig *amdv1alpha1.DeviceConfig) map[string]string {
+	return map[string]string{"daemonset-name": devConfig.Name + "-blacklist"}
+}
+
+// GetNodeRole returns the machine config pool role of the node: master for control plane nodes,
+// the custom role of the node if it has one, and worker otherwise
+func GetNodeRole(node *v1.Node) string {
+	if _, ok := node.Labels[masterNodeRoleLabel]; ok {
+		return masterNodeRole
+	}
+	if _, ok := node.Labels[controlPlaneNodeRoleLabel]; ok {
+		return masterNodeRole
+	}
+
+	role := defaultNodeRole
+	for label := range node.Labels {
+		if nodeRole, found := strings.CutPrefix(label, nodeRoleLabelPrefix); found && nodeRole != defaultNodeRole {
+			// a node belongs to a single custom pool, but the labels are compared to keep the result stable
+			if role == defaultNodeRole || nodeRole < role {
+				role = nodeRole
+			}
+		}
+	}
+	return role
+}
+
+// IsMachineConfigPending returns true if the machine config operator did not apply the desired
+// configuration of the node yet, i.e. the node was not rebooted with the latest MachineConfigs
+func IsMachineConfigPending(node *v1.Node) bool {
+	desired, ok := node.Annotations[machineConfigDesiredConfig]
+	if !ok {
+		return false
+	}
+	return node.Annotations[machineConfigCurrentConfig] != desired || node.Annotations[machineConfigState] != machineConfigStateDone
+}
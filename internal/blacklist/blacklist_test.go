@@ -0,0 +1,148 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blacklist
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = Describe("SetMachineConfigAsDesired", func() {
+	b := NewBlacklist(scheme)
+	devConfig := amdv1alpha1.DeviceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "devConfigName",
+			Namespace: "devConfigNamespace",
+		},
+	}
+
+	It("good flow", func() {
+		mc := &unstructured.Unstructured{}
+
+		err := b.SetMachineConfigAsDesired(mc, &devConfig, "worker")
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mc.GroupVersionKind()).To(Equal(MachineConfigGVK))
+		Expect(mc.GetLabels()).To(Equal(map[string]string{
+			"machineconfiguration.openshift.io/role": "worker",
+			"amd.io/deviceconfig-namespace":          "devConfigNamespace",
+			"amd.io/deviceconfig-name":               "devConfigName",
+		}))
+		Expect(mc.GetOwnerReferences()).To(BeEmpty())
+		files, found, err := unstructured.NestedSlice(mc.Object, "spec", "config", "storage", "files")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(files).To(Equal([]interface{}{
+			map[string]interface{}{
+				"path":      "/etc/modprobe.d/amdgpu-blacklist.conf",
+				"mode":      int64(420),
+				"overwrite": true,
+				"contents": map[string]interface{}{
+					"source": "data:text/plain;base64,YmxhY2tsaXN0IGFtZGdwdQo=",
+				},
+			},
+		}))
+	})
+
+	It("machine config is not initialized", func() {
+		err := b.SetMachineConfigAsDesired(nil, &devConfig, "worker")
+
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("SetBlacklistDaemonSetAsDesired", func() {
+	b := NewBlacklist(scheme)
+	devConfig := amdv1alpha1.DeviceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "devConfigName",
+			Namespace: "devConfigNamespace",
+		},
+		Spec: amdv1alpha1.DeviceConfigSpec{
+			Selector: map[string]string{"some label": "some value"},
+		},
+	}
+
+	It("default image", func() {
+		ds := appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-blacklist"}}
+
+		err := b.SetBlacklistDaemonSetAsDesired(&ds, &devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		podSpec := ds.Spec.Template.Spec
+		Expect(podSpec.NodeSelector).To(Equal(map[string]string{"some label": "some value"}))
+		Expect(podSpec.Volumes[0].HostPath.Path).To(Equal("/etc/modprobe.d"))
+		Expect(podSpec.Containers[0].Image).To(Equal("registry.access.redhat.com/ubi9/ubi-minimal:latest"))
+		Expect(podSpec.Containers[0].ReadinessProbe).ToNot(BeNil())
+		Expect(ds.Spec.Template.Labels).To(Equal(GetBlacklistPodLabels(&devConfig)))
+		Expect(ds.OwnerReferences).To(HaveLen(1))
+	})
+
+	It("user image", func() {
+		ds := appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-blacklist"}}
+		userDevConfig := devConfig.DeepCopy()
+		userDevConfig.Spec.Blacklist.Image = "example.com/tools:1.0"
+
+		err := b.SetBlacklistDaemonSetAsDesired(&ds, userDevConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ds.Spec.Template.Spec.Containers[0].Image).To(Equal("example.com/tools:1.0"))
+		Expect(ds.Spec.Template.Spec.Containers[0].ImagePullPolicy).To(Equal(v1.PullIfNotPresent))
+	})
+})
+
+var _ = Describe("GetNodeRole", func() {
+	DescribeTable("node roles", func(labels map[string]string, expectedRole string) {
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: labels}}
+		Expect(GetNodeRole(node)).To(Equal(expectedRole))
+	},
+		Entry("no role labels", map[string]string{"some label": "some value"}, "worker"),
+		Entry("worker", map[string]string{"node-role.kubernetes.io/worker": ""}, "worker"),
+		Entry("master", map[string]string{"node-role.kubernetes.io/master": "", "node-role.kubernetes.io/worker": ""}, "master"),
+		Entry("control plane", map[string]string{"node-role.kubernetes.io/control-plane": ""}, "master"),
+		Entry("custom role", map[string]string{"node-role.kubernetes.io/worker": "", "node-role.kubernetes.io/gpu": ""}, "gpu"),
+	)
+})
+
+var _ = Describe("IsMachineConfigPending", func() {
+	DescribeTable("machine config annotations", func(annotations map[string]string, expectedPending bool) {
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+		Expect(IsMachineConfigPending(node)).To(Equal(expectedPending))
+	},
+		Entry("no machine config operator", nil, false),
+		Entry("configuration applied", map[string]string{
+			"machineconfiguration.openshift.io/currentConfig": "rendered-worker-1",
+			"machineconfiguration.openshift.io/desiredConfig": "rendered-worker-1",
+			"machineconfiguration.openshift.io/state":         "Done",
+		}, false),
+		Entry("new configuration desired", map[string]string{
+			"machineconfiguration.openshift.io/currentConfig": "rendered-worker-1",
+			"machineconfiguration.openshift.io/desiredConfig": "rendered-worker-2",
+			"machineconfiguration.openshift.io/state":         "Done",
+		}, true),
+		Entry("configuration being applied", map[string]string{
+			"machineconfiguration.openshift.io/currentConfig": "rendered-worker-2",
+			"machineconfiguration.openshift.io/desiredConfig": "rendered-worker-2",
+			"machineconfiguration.openshift.io/state":         "Working",
+		}, true),
+	)
+})
@@ -0,0 +1,69 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: blacklist.go
+//
+// Generated by this command:
+//
+//	mockgen -source=blacklist.go -package=blacklist -destination=mock_blacklist.go Blacklist
+//
+// Package blacklist is a generated GoMock package.
+package blacklist
+
+import (
+	reflect "reflect"
+
+	v1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	gomock "go.uber.org/mock/gomock"
+	v1 "k8s.io/api/apps/v1"
+	unstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// MockBlacklist is a mock of Blacklist interface.
+type MockBlacklist struct {
+	ctrl     *gomock.Controller
+	recorder *MockBlacklistMockRecorder
+}
+
+// MockBlacklistMockRecorder is the mock recorder for MockBlacklist.
+type MockBlacklistMockRecorder struct {
+	mock *MockBlacklist
+}
+
+// NewMockBlacklist creates a new mock instance.
+func NewMockBlacklist(ctrl *gomock.Controller) *MockBlacklist {
+	mock := &MockBlacklist{ctrl: ctrl}
+	mock.recorder = &MockBlacklistMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBlacklist) EXPECT() *MockBlacklistMockRecorder {
+	return m.recorder
+}
+
+// SetBlacklistDaemonSetAsDesired mocks base method.
+func (m *MockBlacklist) SetBlacklistDaemonSetAsDesired(ds *v1.DaemonSet, devConfig *v1alpha1.DeviceConfig) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetBlacklistDaemonSetAsDesired", ds, devConfig)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetBlacklistDaemonSetAsDesired indicates an expected call of SetBlacklistDaemonSetAsDesired.
+func (mr *MockBlacklistMockRecorder) SetBlacklistDaemonSetAsDesired(ds, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBlacklistDaemonSetAsDesired", reflect.TypeOf((*MockBlacklist)(nil).SetBlacklistDaemonSetAsDesired), ds, devConfig)
+}
+
+// SetMachineConfigAsDesired mocks base method.
+func (m *MockBlacklist) SetMachineConfigAsDesired(mc *unstructured.Unstructured, devConfig *v1alpha1.DeviceConfig, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMachineConfigAsDesired", mc, devConfig, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetMachineConfigAsDesired indicates an expected call of SetMachineConfigAsDesired.
+func (mr *MockBlacklistMockRecorder) SetMachineConfigAsDesired(mc, devConfig, role any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMachineConfigAsDesired", reflect.TypeOf((*MockBlacklist)(nil).SetMachineConfigAsDesired), mc, devConfig, role)
+}
@@ -23,6 +23,7 @@ import (
 	"gopkg.in/yaml.v3"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 type LeaderElection struct {
@@ -30,10 +31,35 @@ type LeaderElection struct {
 	ResourceID string `yaml:"resourceID"`
 }
 
+type Webhook struct {
+	Enabled bool   `yaml:"enabled"`
+	Port    int    `yaml:"port"`
+	CertDir string `yaml:"certDir"`
+}
+
+// Drivers overrides the defaults of the OOT drivers build, which otherwise depend on the platform
+type Drivers struct {
+	// Platform is openshift or kubernetes. It is detected at startup when empty
+	Platform string `yaml:"platform"`
+	// ImageRepo is the repository the drivers images are pushed to when the DeviceConfig does not set driversImage
+	ImageRepo string `yaml:"imageRepo"`
+	// BuilderImage is the image the drivers are compiled in. Not used by the default OpenShift Dockerfile,
+	// which compiles the drivers in the Driver Toolkit image
+	BuilderImage string `yaml:"builderImage"`
+	// BaseImage is the base image of the drivers images
+	BaseImage string `yaml:"baseImage"`
+	// DockerfileTemplate is the Go template of the default build Dockerfile
+	DockerfileTemplate string `yaml:"dockerfileTemplate"`
+	// SourcesImageRepo is the repository of the drivers sources images, when the DeviceConfig does not set one
+	SourcesImageRepo string `yaml:"sourcesImageRepo"`
+}
+
 type Config struct {
 	HealthProbeBindAddress string         `yaml:"healthProbeBindAddress"`
 	MetricsBindAddress     string         `yaml:"metricsBindAddress"`
 	LeaderElection         LeaderElection `yaml:"leaderElection"`
+	Webhook                Webhook        `yaml:"webhook"`
+	Drivers                Drivers        `yaml:"drivers"`
 }
 
 func ParseFile(path string) (*Config, error) {
@@ -60,5 +86,9 @@ func (c *Config) ManagerOptions() *manager.Options {
 		Metrics: server.Options{
 			BindAddress: c.MetricsBindAddress,
 		},
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    c.Webhook.Port,
+			CertDir: c.Webhook.CertDir,
+		}),
 	}
 }
@@ -18,27 +18,64 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	kmmv1beta1 "github.com/rh-ecosystem-edge/kernel-module-management/api/v1beta1"
+	kmmlabels "github.com/rh-ecosystem-edge/kernel-module-management/pkg/labels"
 	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/blacklist"
 	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/kmmmodule"
 	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/nodelabeller"
 	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/nodemetrics"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/partition"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/preflight"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/upgrade"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 const (
 	DeviceConfigReconcilerName = "DriverAndPluginReconciler"
 	deviceConfigFinalizer      = "amd.node.kubernetes.io/deviceconfig-finalizer"
+	finalizeRequeueInterval    = 5 * time.Second
+	upgradeRequeueInterval     = 10 * time.Second
+)
+
+// reasons of the events recorded on the DeviceConfig
+const (
+	eventReasonCreated   = "Created"
+	eventReasonPatched   = "Patched"
+	eventReasonDeleted   = "Deleted"
+	eventReasonFinalized = "Finalized"
+	eventReasonUpgrade   = "NodeUpgrade"
+	eventReasonPreflight = "Preflight"
+	eventReasonPartition = "NodePartition"
+	eventReasonBlacklist = "Blacklist"
 )
 
 // ModuleReconciler reconciles a Module object
@@ -50,8 +87,13 @@ func NewDeviceConfigReconciler(
 	client client.Client,
 	kmmHandler kmmmodule.KMMModuleAPI,
 	nlHandler nodelabeller.NodeLabeller,
-	nmHandler nodemetrics.NodeMetrics) *DeviceConfigReconciler {
-	helper := newDeviceConfigReconcilerHelper(client, kmmHandler, nlHandler, nmHandler)
+	nmHandler nodemetrics.NodeMetrics,
+	upgradeHandler upgrade.UpgradeManager,
+	blHandler blacklist.Blacklist,
+	preflightHandler preflight.PreflightManager,
+	partitionHandler partition.Partitioner,
+	recorder record.EventRecorder) *DeviceConfigReconciler {
+	helper := newDeviceConfigReconcilerHelper(client, kmmHandler, nlHandler, nmHandler, upgradeHandler, blHandler, preflightHandler, partitionHandler, recorder)
 	return &DeviceConfigReconciler{
 		helper: helper,
 	}
@@ -59,10 +101,44 @@ func NewDeviceConfigReconciler(
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *DeviceConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// the pods are listed per node when draining the nodes during drivers upgrades
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1.Pod{}, upgrade.PodNodeNameField, func(obj client.Object) []string {
+		return []string{obj.(*v1.Pod).Spec.NodeName}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index pods by node name: %v", err)
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&amdv1alpha1.DeviceConfig{}).
 		Owns(&kmmv1beta1.Module{}).
 		Owns(&appsv1.DaemonSet{}).
+		Owns(&v1.Service{}).
+		// a spec change in any DeviceConfig may create or resolve a node overlap between DeviceConfigs, so
+		// all of them are reconciled again. Status updates are left out, since each reconcile writes some
+		Watches(
+			&amdv1alpha1.DeviceConfig{},
+			handler.EnqueueRequestsFromMapFunc(r.helper.getAllDeviceConfigsRequests),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		// a change in the node labels only concerns the DeviceConfigs targeting the node before or after it
+		Watches(
+			&v1.Node{},
+			handler.Funcs{
+				CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.RateLimitingInterface) {
+					addRequests(q, r.helper.getNodeDeviceConfigsRequests(ctx, nil, e.Object.GetLabels()))
+				},
+				UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+					addRequests(q, r.helper.getNodeDeviceConfigsRequests(ctx, e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()))
+				},
+				DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+					addRequests(q, r.helper.getNodeDeviceConfigsRequests(ctx, e.Object.GetLabels(), nil))
+				},
+			},
+			builder.WithPredicates(predicate.LabelChangedPredicate{}),
+		).
+		// the PreflightValidations are cluster scoped, so they are mapped to their DeviceConfig by labels
+		Watches(&kmmv1beta1.PreflightValidation{}, handler.EnqueueRequestsFromMapFunc(preflight.GetDeviceConfigRequests)).
 		Named(DeviceConfigReconcilerName).
 		Complete(r)
 }
@@ -70,9 +146,19 @@ func (r *DeviceConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 //+kubebuilder:rbac:groups=amd.io,resources=deviceconfigs,verbs=get;list;watch;create;patch;update
 //+kubebuilder:rbac:groups=kmm.sigs.x-k8s.io,resources=modules,verbs=get;list;watch;create;patch;update;delete
 //+kubebuilder:rbac:groups=amd.io,resources=deviceconfigs/finalizers,verbs=update
+//+kubebuilder:rbac:groups=amd.io,resources=deviceconfigs/status,verbs=get;patch;update
 //+kubebuilder:rbac:groups=kmm.sigs.x-k8s.io,resources=modules/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=kmm.sigs.x-k8s.io,resources=preflightvalidations,verbs=get;list;watch;create;patch;delete
 //+kubebuilder:rbac:groups=core,resources=configmaps,verbs=create;delete;get;list;patch;watch;create
 //+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=create;delete;get;list;patch;watch
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=core,resources=pods/eviction,verbs=create
+//+kubebuilder:rbac:groups=core,resources=services,verbs=create;delete;get;list;patch;watch
+//+kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=create;delete;get;list;patch;watch
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles,verbs=create;delete;get;list;patch;watch
+//+kubebuilder:rbac:groups=machineconfiguration.openshift.io,resources=machineconfigs,verbs=create;delete;get;list;patch;watch
+//+kubebuilder:rbac:urls=/metrics,verbs=get
 
 func (r *DeviceConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	res := ctrl.Result{}
@@ -91,10 +177,14 @@ func (r *DeviceConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request
 
 	if devConfig.GetDeletionTimestamp() != nil {
 		// DeviceConfig is being deleted
-		err = r.helper.finalizeDeviceConfig(ctx, devConfig)
+		finalized, err := r.helper.finalizeDeviceConfig(ctx, devConfig)
 		if err != nil {
 			return ctrl.Result{}, fmt.Errorf("failed to finalize DeviceConfig %s: %v", req.NamespacedName, err)
 		}
+		if !finalized {
+			logger.Info("waiting for the owned resources to be deleted")
+			return ctrl.Result{RequeueAfter: finalizeRequeueInterval}, nil
+		}
 		return ctrl.Result{}, nil
 	}
 
@@ -103,60 +193,143 @@ func (r *DeviceConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return res, fmt.Errorf("failed to set finalizer for DeviceConfig %s: %v", req.NamespacedName, err)
 	}
 
+	logger.Info("start node overlap check")
+	overlappingNodes, err := r.helper.getOverlappingNodes(ctx, devConfig)
+	if err != nil {
+		r.helper.setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonNodeOverlapCheckFailed, fmt.Errorf("getOverlappingNodes: %v", err))
+		return res, fmt.Errorf("failed to check node overlap for DeviceConfig %s: %v", req.NamespacedName, err)
+	}
+	if len(overlappingNodes) > 0 {
+		// the DeviceConfig will be reconciled again once the overlap is resolved, via the DeviceConfig and Node watches
+		logger.Info("DeviceConfig targets nodes already targeted by other DeviceConfigs, not deploying it", "nodes", overlappingNodes)
+		r.helper.setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonNodesOverlap,
+			fmt.Errorf("nodes %s are already targeted by other DeviceConfigs", strings.Join(overlappingNodes, ", ")))
+		return res, nil
+	}
+
+	logger.Info("start inbox driver blacklist reconciliation")
+	err = r.helper.handleBlacklist(ctx, devConfig)
+	if err != nil {
+		r.helper.setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonBlacklistFailed, fmt.Errorf("handleBlacklist: %v", err))
+		return res, fmt.Errorf("failed to handle inbox driver blacklist for DeviceConfig %s: %v", req.NamespacedName, err)
+	}
+
 	logger.Info("start build configmap reconciliation")
 	err = r.helper.handleBuildConfigMap(ctx, devConfig)
 	if err != nil {
+		r.helper.setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonBuildConfigMapFailed, fmt.Errorf("handleBuildConfigMap: %v", err))
 		return res, fmt.Errorf("failed to handle build ConfigMap for DeviceConfig %s: %v", req.NamespacedName, err)
 	}
 
 	logger.Info("start KMM reconciliation")
 	err = r.helper.handleKMMModule(ctx, devConfig)
 	if err != nil {
+		r.helper.setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonKMMModuleFailed, fmt.Errorf("handleKMMModule: %v", err))
 		return res, fmt.Errorf("failed to handle KMM module for DeviceConfig %s: %v", req.NamespacedName, err)
 	}
 
+	logger.Info("start drivers upgrade reconciliation")
+	upgradeInProgress, err := r.helper.handleUpgrade(ctx, devConfig)
+	if err != nil {
+		r.helper.setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonUpgradeFailed, fmt.Errorf("handleUpgrade: %v", err))
+		return res, fmt.Errorf("failed to handle drivers upgrade for DeviceConfig %s: %v", req.NamespacedName, err)
+	}
+	if upgradeInProgress {
+		// the drain progress is not reflected in any watched object, so the nodes are checked periodically
+		res.RequeueAfter = upgradeRequeueInterval
+	}
+
+	logger.Info("start GPU partitioning reconciliation")
+	partitioningInProgress, err := r.helper.handlePartitioning(ctx, devConfig)
+	if err != nil {
+		r.helper.setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonPartitioningFailed, fmt.Errorf("handlePartitioning: %v", err))
+		return res, fmt.Errorf("failed to handle GPU partitioning for DeviceConfig %s: %v", req.NamespacedName, err)
+	}
+	if partitioningInProgress {
+		res.RequeueAfter = upgradeRequeueInterval
+	}
+
+	logger.Info("start device plugin reconciliation")
+	err = r.helper.handleDevicePlugin(ctx, devConfig)
+	if err != nil {
+		r.helper.setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonDevicePluginFailed, fmt.Errorf("handleDevicePlugin: %v", err))
+		return res, fmt.Errorf("failed to handle device plugin for DeviceConfig %s: %v", req.NamespacedName, err)
+	}
+
 	logger.Info("start node labeller reconciliation")
 	err = r.helper.handleNodeLabeller(ctx, devConfig)
 	if err != nil {
+		r.helper.setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonNodeLabellerFailed, fmt.Errorf("handleNodeLabeller: %v", err))
 		return res, fmt.Errorf("failed to handle node labeller for DeviceConfig %s: %v", req.NamespacedName, err)
 	}
 
 	logger.Info("start metrics reconciliation")
 	err = r.helper.handleNodeMetrics(ctx, devConfig)
 	if err != nil {
+		r.helper.setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonNodeMetricsFailed, fmt.Errorf("handleNodeMetrics: %v", err))
 		return res, fmt.Errorf("failed to handle node metrics for DeviceConfig %s: %v", req.NamespacedName, err)
 	}
-	// [TODO] add status handling for DeviceConfig
+
+	logger.Info("start status reconciliation")
+	err = r.helper.handleDeviceConfigStatus(ctx, devConfig)
+	if err != nil {
+		return res, fmt.Errorf("failed to handle status for DeviceConfig %s: %v", req.NamespacedName, err)
+	}
+
 	return res, nil
 }
 
 //go:generate mockgen -source=device_config_reconciler.go -package=controllers -destination=mock_device_config_reconciler.go deviceConfigReconcilerHelperAPI
 type deviceConfigReconcilerHelperAPI interface {
 	getRequestedDeviceConfig(ctx context.Context, namespacedName types.NamespacedName) (*amdv1alpha1.DeviceConfig, error)
-	finalizeDeviceConfig(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error
+	finalizeDeviceConfig(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) (bool, error)
 	setFinalizer(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error
+	getOverlappingNodes(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) ([]string, error)
+	getAllDeviceConfigsRequests(ctx context.Context, obj client.Object) []reconcile.Request
+	getNodeDeviceConfigsRequests(ctx context.Context, oldLabels, newLabels map[string]string) []reconcile.Request
+	handleBlacklist(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error
 	handleKMMModule(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error
+	handleUpgrade(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) (bool, error)
+	handlePartitioning(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) (bool, error)
 	handleBuildConfigMap(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error
+	handleDevicePlugin(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error
 	handleNodeLabeller(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error
 	handleNodeMetrics(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error
+	handleDeviceConfigStatus(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error
+	setDegradedStatus(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, reason string, stepErr error)
 }
 
 type deviceConfigReconcilerHelper struct {
-	client     client.Client
-	kmmHandler kmmmodule.KMMModuleAPI
-	nlHandler  nodelabeller.NodeLabeller
-	nmHandler  nodemetrics.NodeMetrics
+	client           client.Client
+	kmmHandler       kmmmodule.KMMModuleAPI
+	nlHandler        nodelabeller.NodeLabeller
+	nmHandler        nodemetrics.NodeMetrics
+	upgradeHandler   upgrade.UpgradeManager
+	blHandler        blacklist.Blacklist
+	preflightHandler preflight.PreflightManager
+	partitionHandler partition.Partitioner
+	recorder         record.EventRecorder
 }
 
 func newDeviceConfigReconcilerHelper(client client.Client,
 	kmmHandler kmmmodule.KMMModuleAPI,
 	nlHandler nodelabeller.NodeLabeller,
-	nmHandler nodemetrics.NodeMetrics) deviceConfigReconcilerHelperAPI {
+	nmHandler nodemetrics.NodeMetrics,
+	upgradeHandler upgrade.UpgradeManager,
+	blHandler blacklist.Blacklist,
+	preflightHandler preflight.PreflightManager,
+	partitionHandler partition.Partitioner,
+	recorder record.EventRecorder) deviceConfigReconcilerHelperAPI {
 	return &deviceConfigReconcilerHelper{
-		client:     client,
-		kmmHandler: kmmHandler,
-		nlHandler:  nlHandler,
-		nmHandler:  nmHandler,
+		client:           client,
+		kmmHandler:       kmmHandler,
+		nlHandler:        nlHandler,
+		nmHandler:        nmHandler,
+		upgradeHandler:   upgradeHandler,
+		blHandler:        blHandler,
+		preflightHandler: preflightHandler,
+		partitionHandler: partitionHandler,
+		recorder:         recorder,
 	}
 }
 
@@ -179,78 +352,399 @@ func (dcrh *deviceConfigReconcilerHelper) setFinalizer(ctx context.Context, devC
 	return dcrh.client.Patch(ctx, devConfig, client.MergeFrom(devConfigCopy))
 }
 
-func (dcrh *deviceConfigReconcilerHelper) finalizeDeviceConfig(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error {
+// getOverlappingNodes returns the names of the nodes targeted by devConfig that are also targeted by a
+// DeviceConfig that takes precedence over it. The oldest DeviceConfig takes precedence, so that an existing
+// deployment is not disrupted by a newly created DeviceConfig
+func (dcrh *deviceConfigReconcilerHelper) getOverlappingNodes(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) ([]string, error) {
+	devConfigList := amdv1alpha1.DeviceConfigList{}
+	if err := dcrh.client.List(ctx, &devConfigList); err != nil {
+		return nil, fmt.Errorf("failed to list DeviceConfigs: %v", err)
+	}
+
+	precedingSelectors := []labels.Selector{}
+	for i := range devConfigList.Items {
+		other := &devConfigList.Items[i]
+		if other.Namespace == devConfig.Namespace && other.Name == devConfig.Name {
+			continue
+		}
+		if takesPrecedence(other, devConfig) {
+			precedingSelectors = append(precedingSelectors, labels.SelectorFromSet(utils.GetNodeSelector(other)))
+		}
+	}
+
+	if len(precedingSelectors) == 0 {
+		return nil, nil
+	}
+
+	nodes := v1.NodeList{}
+	if err := dcrh.client.List(ctx, &nodes, client.MatchingLabels(utils.GetNodeSelector(devConfig))); err != nil {
+		return nil, fmt.Errorf("failed to list nodes matching DeviceConfig selector: %v", err)
+	}
+
+	overlappingNodes := []string{}
+	for _, node := range nodes.Items {
+		for _, selector := range precedingSelectors {
+			if selector.Matches(labels.Set(node.Labels)) {
+				overlappingNodes = append(overlappingNodes, node.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(overlappingNodes)
+
+	return overlappingNodes, nil
+}
+
+// takesPrecedence returns true if first was created before second. DeviceConfigs created at the
+// same time are ordered by namespace and name
+func takesPrecedence(first, second *amdv1alpha1.DeviceConfig) bool {
+	if !first.CreationTimestamp.Equal(&second.CreationTimestamp) {
+		return first.CreationTimestamp.Before(&second.CreationTimestamp)
+	}
+	return first.Namespace+"/"+first.Name < second.Namespace+"/"+second.Name
+}
+
+// getAllDeviceConfigsRequests maps any watched object to the reconcile requests of all the DeviceConfigs
+func (dcrh *deviceConfigReconcilerHelper) getAllDeviceConfigsRequests(ctx context.Context, obj client.Object) []reconcile.Request {
+	devConfigList := amdv1alpha1.DeviceConfigList{}
+	if err := dcrh.client.List(ctx, &devConfigList); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list DeviceConfigs")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(devConfigList.Items))
+	for _, devConfig := range devConfigList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: devConfig.Namespace, Name: devConfig.Name},
+		})
+	}
+	return requests
+}
+
+// getNodeDeviceConfigsRequests maps a change of the node labels to the reconcile requests of the DeviceConfigs
+// whose selectors match the old or the new labels. Nothing is reconciled when the change does not affect which
+// DeviceConfigs target the node or run their operands on it
+func (dcrh *deviceConfigReconcilerHelper) getNodeDeviceConfigsRequests(ctx context.Context, oldLabels, newLabels map[string]string) []reconcile.Request {
+	devConfigList := amdv1alpha1.DeviceConfigList{}
+	if err := dcrh.client.List(ctx, &devConfigList); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list DeviceConfigs")
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	changed := false
+	for i := range devConfigList.Items {
+		devConfig := &devConfigList.Items[i]
+		matched := false
+		for _, selector := range []map[string]string{utils.GetNodeSelector(devConfig), utils.GetOperandsNodeSelector(devConfig)} {
+			oldMatch := labels.SelectorFromSet(selector).Matches(labels.Set(oldLabels))
+			newMatch := labels.SelectorFromSet(selector).Matches(labels.Set(newLabels))
+			changed = changed || oldMatch != newMatch
+			matched = matched || oldMatch || newMatch
+		}
+		if matched {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: devConfig.Namespace, Name: devConfig.Name},
+			})
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return requests
+}
+
+func addRequests(q workqueue.RateLimitingInterface, requests []reconcile.Request) {
+	for _, request := range requests {
+		q.Add(request)
+	}
+}
+
+// finalizeDeviceConfig deletes all the resources owned by the DeviceConfig, and removes the finalizer once
+// all of them are gone. It returns false while some of the resources are still being deleted
+func (dcrh *deviceConfigReconcilerHelper) finalizeDeviceConfig(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) (bool, error) {
 	logger := log.FromContext(ctx)
 
-	nlDS := appsv1.DaemonSet{}
-	namespacedName := types.NamespacedName{
-		Namespace: devConfig.Namespace,
-		Name:      devConfig.Name + "-node-labeller",
+	type ownedObject struct {
+		kind string
+		obj  client.Object
+	}
+	ownedObjects := []ownedObject{
+		{kind: "node labeller DaemonSet", obj: &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-labeller"}}},
+		{kind: "node metrics DaemonSet", obj: &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"}}},
+		{kind: "node metrics Service", obj: &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"}}},
+		{kind: "node metrics ServiceMonitor", obj: newServiceMonitor(devConfig)},
+		{kind: "node metrics reader ClusterRole", obj: newMetricsReaderClusterRole(devConfig)},
+		{kind: "device plugin DaemonSet", obj: &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-device-plugin"}}},
+		{kind: "blacklist DaemonSet", obj: newBlacklistDaemonSet(devConfig)},
+		{kind: "partition agent DaemonSet", obj: &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-partition-agent"}}},
+		{kind: "KMM Module", obj: &kmmv1beta1.Module{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name}}},
+		{kind: "preflight KMM Module", obj: &kmmv1beta1.Module{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: preflight.GetCandidateModuleName(devConfig)}}},
+	}
+	buildCMName := kmmmodule.GetDockerfileCMName(devConfig, kmmmodule.NodeOS{})
+	if userCM := devConfig.Spec.Driver.Build.DockerfileConfigMap; userCM == nil || userCM.Name != buildCMName {
+		ownedObjects = append(ownedObjects, ownedObject{kind: "build dockerfile ConfigMap", obj: &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: buildCMName}}})
 	}
 
-	err := dcrh.client.Get(ctx, namespacedName, &nlDS)
+	errs := []error{}
+	machineConfigs, err := dcrh.listMachineConfigs(ctx, devConfig)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for i := range machineConfigs {
+		ownedObjects = append(ownedObjects, ownedObject{kind: "blacklist MachineConfig", obj: &machineConfigs[i]})
+	}
+	validations, err := dcrh.listPreflightValidations(ctx, devConfig)
 	if err != nil {
-		if !k8serrors.IsNotFound(err) {
-			return fmt.Errorf("failed to get nodelabeller daemonset %s: %v", namespacedName, err)
+		errs = append(errs, err)
+	}
+	for i := range validations {
+		ownedObjects = append(ownedObjects, ownedObject{kind: "PreflightValidation", obj: &validations[i]})
+	}
+
+	remaining := 0
+	for _, owned := range ownedObjects {
+		namespacedName := client.ObjectKeyFromObject(owned.obj)
+		err := dcrh.client.Get(ctx, namespacedName, owned.obj)
+		if err != nil {
+			// a missing kind (e.g. ServiceMonitor without prometheus-operator) means there is nothing to delete
+			if !k8serrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+				errs = append(errs, fmt.Errorf("failed to get %s %s: %v", owned.kind, namespacedName, err))
+			}
+			continue
 		}
-	} else {
-		logger.Info("deleting nodelabeller daemonset", "daemonset", namespacedName)
-		return dcrh.client.Delete(ctx, &nlDS)
+
+		remaining++
+		if owned.obj.GetDeletionTimestamp() != nil {
+			logger.Info("waiting for deletion", "kind", owned.kind, "name", namespacedName)
+			continue
+		}
+
+		logger.Info("deleting owned resource", "kind", owned.kind, "name", namespacedName)
+		if err = dcrh.client.Delete(ctx, owned.obj); err != nil && !k8serrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete %s %s: %v", owned.kind, namespacedName, err))
+			continue
+		}
+		dcrh.recorder.Eventf(devConfig, v1.EventTypeNormal, eventReasonDeleted, "Deleted %s %s", owned.kind, owned.obj.GetName())
 	}
 
-	nmDS := appsv1.DaemonSet{}
-	namespacedName = types.NamespacedName{
-		Namespace: devConfig.Namespace,
-		Name:      devConfig.Name + "-node-metrics",
+	if len(errs) > 0 {
+		return false, errors.Join(errs...)
+	}
+
+	if remaining > 0 {
+		return false, nil
+	}
+
+	logger.Info("all owned resources deleted, removing finalizer")
+	devConfigCopy := devConfig.DeepCopy()
+	controllerutil.RemoveFinalizer(devConfig, deviceConfigFinalizer)
+	if err := dcrh.client.Patch(ctx, devConfig, client.MergeFrom(devConfigCopy)); err != nil {
+		return false, fmt.Errorf("failed to remove finalizer: %v", err)
+	}
+	dcrh.recorder.Event(devConfig, v1.EventTypeNormal, eventReasonFinalized, "All owned resources deleted, finalizer removed")
+
+	return true, nil
+}
+
+// handleBlacklist blacklists the inbox amdgpu driver on the selected nodes. On OpenShift a MachineConfig is
+// created per role of the nodes, otherwise the MachineConfig CRD is not installed and a DaemonSet writes
+// the blacklist on the nodes instead
+func (dcrh *deviceConfigReconcilerHelper) handleBlacklist(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error {
+	ds := newBlacklistDaemonSet(devConfig)
+
+	logger := log.FromContext(ctx)
+	if !devConfig.Spec.Blacklist.Enable {
+		if err := dcrh.deleteMachineConfigs(ctx, devConfig, nil); err != nil {
+			return err
+		}
+		return dcrh.deleteIfExists(ctx, devConfig, "blacklist DaemonSet", ds)
 	}
 
-	err = dcrh.client.Get(ctx, namespacedName, &nmDS)
+	nodes, err := dcrh.getSelectedNodes(ctx, devConfig)
 	if err != nil {
-		if !k8serrors.IsNotFound(err) {
-			return fmt.Errorf("failed to get nodemetrics daemonset %s: %v", namespacedName, err)
+		return err
+	}
+	roles := map[string]bool{}
+	for i := range nodes {
+		roles[blacklist.GetNodeRole(&nodes[i])] = true
+	}
+	sortedRoles := make([]string, 0, len(roles))
+	for role := range roles {
+		sortedRoles = append(sortedRoles, role)
+	}
+	sort.Strings(sortedRoles)
+
+	var allNodes *v1.NodeList
+	for _, role := range sortedRoles {
+		mc := newMachineConfig(devConfig, role)
+		opRes, err := controllerutil.CreateOrPatch(ctx, dcrh.client, mc, func() error {
+			return dcrh.blHandler.SetMachineConfigAsDesired(mc, devConfig, role)
+		})
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				logger.Info("MachineConfig CRD is not installed, blacklisting the inbox driver with a DaemonSet")
+				opRes, err = controllerutil.CreateOrPatch(ctx, dcrh.client, ds, func() error {
+					return dcrh.blHandler.SetBlacklistDaemonSetAsDesired(ds, devConfig)
+				})
+				if err != nil {
+					return fmt.Errorf("failed to reconcile blacklist DaemonSet: %v", err)
+				}
+				logger.Info("Reconciled blacklist DaemonSet", "namespace", ds.Namespace, "name", ds.Name, "result", opRes)
+				dcrh.recordOperationEvent(devConfig, "blacklist DaemonSet", ds.Name, opRes)
+				return nil
+			}
+			return fmt.Errorf("failed to reconcile blacklist MachineConfig %s: %v", mc.GetName(), err)
+		}
+		logger.Info("Reconciled blacklist MachineConfig", "name", mc.GetName(), "result", opRes)
+		dcrh.recordOperationEvent(devConfig, "blacklist MachineConfig", mc.GetName(), opRes)
+		if opRes != controllerutil.OperationResultNone {
+			if allNodes == nil {
+				allNodes = &v1.NodeList{}
+				if err := dcrh.client.List(ctx, allNodes); err != nil {
+					return fmt.Errorf("failed to list nodes: %v", err)
+				}
+			}
+			dcrh.warnUnselectedPoolNodes(devConfig, role, allNodes.Items)
 		}
-	} else {
-		logger.Info("deleting nodemetrics daemonset", "daemonset", namespacedName)
-		return dcrh.client.Delete(ctx, &nmDS)
 	}
 
-	mod := kmmv1beta1.Module{}
-	namespacedName = types.NamespacedName{
-		Namespace: devConfig.Namespace,
-		Name:      devConfig.Name,
+	// the MachineConfigs of roles that no longer have selected nodes are removed
+	if err := dcrh.deleteMachineConfigs(ctx, devConfig, roles); err != nil {
+		return err
+	}
+	return dcrh.deleteIfExists(ctx, devConfig, "blacklist DaemonSet", ds)
+}
+
+// warnUnselectedPoolNodes records a warning when the pool of the role contains nodes that the DeviceConfig does not
+// select, since the MachineConfig of the role blacklists amdgpu on all the nodes of the pool and reboots them
+func (dcrh *deviceConfigReconcilerHelper) warnUnselectedPoolNodes(devConfig *amdv1alpha1.DeviceConfig, role string, nodes []v1.Node) {
+	selector := labels.SelectorFromSet(utils.GetNodeSelector(devConfig))
+	unselected := []string{}
+	for i := range nodes {
+		if blacklist.GetNodeRole(&nodes[i]) == role && !selector.Matches(labels.Set(nodes[i].Labels)) {
+			unselected = append(unselected, nodes[i].Name)
+		}
+	}
+	if len(unselected) > 0 {
+		dcrh.recorder.Eventf(devConfig, v1.EventTypeWarning, eventReasonBlacklist,
+			"MachineConfig pool %s also contains nodes not selected by the DeviceConfig, amdgpu is blacklisted on them and they are rebooted: %s",
+			role, strings.Join(unselected, ", "))
 	}
-	err = dcrh.client.Get(ctx, namespacedName, &mod)
+}
+
+// listMachineConfigs returns the blacklist MachineConfigs of the DeviceConfig. No MachineConfigs are
+// returned if the MachineConfig CRD is not installed
+func (dcrh *deviceConfigReconcilerHelper) listMachineConfigs(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) ([]unstructured.Unstructured, error) {
+	mcList := unstructured.UnstructuredList{}
+	mcList.SetGroupVersionKind(blacklist.MachineConfigListGVK)
+	err := dcrh.client.List(ctx, &mcList, client.MatchingLabels(blacklist.GetMachineConfigLabels(devConfig)))
 	if err != nil {
-		if k8serrors.IsNotFound(err) {
-			logger.Info("module already deleted, removing finalizer", "module", namespacedName)
-			devConfigCopy := devConfig.DeepCopy()
-			controllerutil.RemoveFinalizer(devConfig, deviceConfigFinalizer)
-			return dcrh.client.Patch(ctx, devConfig, client.MergeFrom(devConfigCopy))
+		if meta.IsNoMatchError(err) {
+			return nil, nil
 		}
-		return fmt.Errorf("failed to get the requested Module %s: %v", namespacedName, err)
+		return nil, fmt.Errorf("failed to list blacklist MachineConfigs: %v", err)
 	}
-	logger.Info("deleting KMM Module", "module", namespacedName)
-	return dcrh.client.Delete(ctx, &mod)
+	return mcList.Items, nil
 }
 
-func (dcrh *deviceConfigReconcilerHelper) handleBuildConfigMap(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error {
-	buildDockerfileCM := &v1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: devConfig.Namespace,
-			Name:      getDockerfileCMName(devConfig),
-		},
+// listPreflightValidations lists the cluster scoped PreflightValidations of the DeviceConfig
+func (dcrh *deviceConfigReconcilerHelper) listPreflightValidations(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) ([]kmmv1beta1.PreflightValidation, error) {
+	pfvList := kmmv1beta1.PreflightValidationList{}
+	err := dcrh.client.List(ctx, &pfvList, client.MatchingLabels(preflight.GetValidationLabels(devConfig)))
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list PreflightValidations: %v", err)
+	}
+	return pfvList.Items, nil
+}
+
+// deleteMachineConfigs deletes the blacklist MachineConfigs of the DeviceConfig, except the ones of keepRoles
+func (dcrh *deviceConfigReconcilerHelper) deleteMachineConfigs(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, keepRoles map[string]bool) error {
+	machineConfigs, err := dcrh.listMachineConfigs(ctx, devConfig)
+	if err != nil {
+		return err
+	}
+	for i := range machineConfigs {
+		if keepRoles[machineConfigs[i].GetLabels()[blacklist.MachineConfigRoleLabel]] {
+			continue
+		}
+		if err = dcrh.deleteIfExists(ctx, devConfig, "blacklist MachineConfig", &machineConfigs[i]); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
+// handleBuildConfigMap reconciles the build dockerfile ConfigMap of the platform, and the ones of the OSes of
+// the selected nodes that have their own Dockerfile. The ConfigMaps of OSes no longer running are deleted
+func (dcrh *deviceConfigReconcilerHelper) handleBuildConfigMap(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error {
 	logger := log.FromContext(ctx)
-	opRes, err := controllerutil.CreateOrPatch(ctx, dcrh.client, buildDockerfileCM, func() error {
-		return dcrh.kmmHandler.SetBuildConfigMapAsDesired(buildDockerfileCM, devConfig)
-	})
+	desiredOS := map[string]kmmmodule.NodeOS{}
+	// the ConfigMap of the user is never deleted, even if it is one that was managed by the operator
+	userCMName := ""
+	if devConfig.Spec.Driver.Build.DockerfileConfigMap != nil {
+		userCMName = devConfig.Spec.Driver.Build.DockerfileConfigMap.Name
+	}
+	if devConfig.Spec.UseInTreeDrivers || userCMName != "" || devConfig.Spec.Driver.Build.Policy == amdv1alpha1.BuildPolicyNever {
+		logger.Info("in-tree drivers, a user build dockerfile ConfigMap or prebuilt drivers images are used, build dockerfile ConfigMaps are not needed")
+		defaultCM := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: kmmmodule.GetDockerfileCMName(devConfig, kmmmodule.NodeOS{})},
+		}
+		if defaultCM.Name != userCMName {
+			if err := dcrh.deleteIfExists(ctx, devConfig, "build dockerfile ConfigMap", defaultCM); err != nil {
+				return err
+			}
+		}
+	} else {
+		nodes, err := dcrh.getSelectedNodes(ctx, devConfig)
+		if err != nil {
+			return err
+		}
+		desiredOS[kmmmodule.GetDockerfileCMName(devConfig, kmmmodule.NodeOS{})] = kmmmodule.NodeOS{}
+		for i := range nodes {
+			nodeOS := kmmmodule.GetNodeOS(&nodes[i])
+			desiredOS[kmmmodule.GetDockerfileCMName(devConfig, nodeOS)] = nodeOS
+		}
+	}
 
-	if err == nil {
-		logger.Info("Reconciled KMM build dockerfile ConfigMap", "name", buildDockerfileCM.Name, "result", opRes)
+	cmNames := make([]string, 0, len(desiredOS))
+	for cmName := range desiredOS {
+		cmNames = append(cmNames, cmName)
+	}
+	sort.Strings(cmNames)
+	for _, cmName := range cmNames {
+		nodeOS := desiredOS[cmName]
+		buildDockerfileCM := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: cmName},
+		}
+		opRes, err := controllerutil.CreateOrPatch(ctx, dcrh.client, buildDockerfileCM, func() error {
+			return dcrh.kmmHandler.SetBuildConfigMapAsDesired(buildDockerfileCM, devConfig, nodeOS)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to reconcile build dockerfile ConfigMap %s: %v", cmName, err)
+		}
+		logger.Info("Reconciled KMM build dockerfile ConfigMap", "name", cmName, "result", opRes)
+		dcrh.recordOperationEvent(devConfig, "build dockerfile ConfigMap", cmName, opRes)
 	}
 
-	return err
+	buildCMs := v1.ConfigMapList{}
+	err := dcrh.client.List(ctx, &buildCMs, client.InNamespace(devConfig.Namespace), client.MatchingLabels{kmmmodule.DockerfileCMLabel: devConfig.Name})
+	if err != nil {
+		return fmt.Errorf("failed to list build dockerfile ConfigMaps: %v", err)
+	}
+	for i := range buildCMs.Items {
+		if _, ok := desiredOS[buildCMs.Items[i].Name]; ok || buildCMs.Items[i].Name == userCMName {
+			continue
+		}
+		if err = dcrh.deleteIfExists(ctx, devConfig, "build dockerfile ConfigMap", &buildCMs.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (dcrh *deviceConfigReconcilerHelper) handleKMMModule(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error {
@@ -261,50 +755,609 @@ func (dcrh *deviceConfigReconcilerHelper) handleKMMModule(ctx context.Context, d
 		},
 	}
 	logger := log.FromContext(ctx)
+	if devConfig.Spec.UseInTreeDrivers {
+		logger.Info("in-tree drivers are used, KMM Module is not needed", "name", kmmMod.Name)
+		return dcrh.deleteIfExists(ctx, devConfig, "KMM Module", kmmMod)
+	}
+
+	nodes, err := dcrh.getSelectedNodes(ctx, devConfig)
+	if err != nil {
+		return err
+	}
+
+	validated, err := dcrh.handlePreflight(ctx, devConfig, nodes)
+	if err != nil || !validated {
+		return err
+	}
+
 	opRes, err := controllerutil.CreateOrPatch(ctx, dcrh.client, kmmMod, func() error {
-		return dcrh.kmmHandler.SetKMMModuleAsDesired(kmmMod, devConfig)
+		return dcrh.kmmHandler.SetKMMModuleAsDesired(kmmMod, devConfig, nodes)
 	})
 
 	if err == nil {
 		logger.Info("Reconciled KMM Module", "name", kmmMod.Name, "result", opRes)
+		dcrh.recordOperationEvent(devConfig, "KMM Module", kmmMod.Name, opRes)
 	}
 
 	return err
 
 }
 
+// handlePreflight validates the desired KMM Module with KMM PreflightValidations when preflight is enabled, and
+// persists the results in the DeviceConfig status. It returns true once the KMM Module can be created or patched
+func (dcrh *deviceConfigReconcilerHelper) handlePreflight(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, nodes []v1.Node) (bool, error) {
+	devConfigCopy := devConfig.DeepCopy()
+	validated := true
+	var preflightErr error
+	if devConfig.Spec.Driver.Preflight.Enable {
+		desiredMod := &kmmv1beta1.Module{
+			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name},
+		}
+		if err := dcrh.kmmHandler.SetKMMModuleAsDesired(desiredMod, devConfig, nodes); err != nil {
+			return false, fmt.Errorf("failed to set the preflight KMM Module: %v", err)
+		}
+		validated, preflightErr = dcrh.preflightHandler.ValidateModule(ctx, devConfig, desiredMod, nodes)
+	} else if devConfig.Status.Preflight != nil {
+		if err := dcrh.preflightHandler.DeleteValidation(ctx, devConfig); err != nil {
+			return false, err
+		}
+		devConfig.Status.Preflight = nil
+	}
+
+	if equality.Semantic.DeepEqual(devConfigCopy.Status.Preflight, devConfig.Status.Preflight) {
+		return validated, preflightErr
+	}
+
+	if status := devConfig.Status.Preflight; status != nil && (devConfigCopy.Status.Preflight == nil || devConfigCopy.Status.Preflight.State != status.State) {
+		eventType := v1.EventTypeNormal
+		if status.State == amdv1alpha1.PreflightStateFailed {
+			eventType = v1.EventTypeWarning
+		}
+		dcrh.recorder.Eventf(devConfig, eventType, eventReasonPreflight, "Preflight validation of drivers version %s: %s",
+			status.DriversVersion, status.State)
+	}
+
+	if err := dcrh.client.Status().Patch(ctx, devConfig, client.MergeFrom(devConfigCopy)); err != nil {
+		return false, errors.Join(preflightErr, fmt.Errorf("failed to patch the preflight status: %v", err))
+	}
+
+	return validated, preflightErr
+}
+
+// handleUpgrade moves the nodes through the drivers upgrade states, and persists their states in the
+// DeviceConfig status. It returns true while an upgrade is in progress
+func (dcrh *deviceConfigReconcilerHelper) handleUpgrade(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) (bool, error) {
+	devConfigCopy := devConfig.DeepCopy()
+	inProgress, upgradeErr := dcrh.upgradeHandler.HandleUpgrade(ctx, devConfig)
+
+	if equality.Semantic.DeepEqual(devConfigCopy.Status.NodeUpgrades, devConfig.Status.NodeUpgrades) {
+		return inProgress, upgradeErr
+	}
+
+	previousStates := map[string]string{}
+	for _, nodeStatus := range devConfigCopy.Status.NodeUpgrades {
+		previousStates[nodeStatus.NodeName] = nodeStatus.State
+	}
+	for _, nodeStatus := range devConfig.Status.NodeUpgrades {
+		if previousStates[nodeStatus.NodeName] == nodeStatus.State {
+			continue
+		}
+		eventType := v1.EventTypeNormal
+		if nodeStatus.State == amdv1alpha1.UpgradeStateFailed {
+			eventType = v1.EventTypeWarning
+		}
+		dcrh.recorder.Eventf(devConfig, eventType, eventReasonUpgrade, "Node %s drivers upgrade to %s: %s",
+			nodeStatus.NodeName, nodeStatus.DriversVersion, nodeStatus.State)
+	}
+
+	if err := dcrh.client.Status().Patch(ctx, devConfig, client.MergeFrom(devConfigCopy)); err != nil {
+		return inProgress, errors.Join(upgradeErr, fmt.Errorf("failed to patch the nodes upgrade status: %v", err))
+	}
+
+	return inProgress, upgradeErr
+}
+
+// handlePartitioning deploys the partition agent DaemonSet when a partitioning profile is set, moves the nodes
+// through the partitioning states and persists their states in the DeviceConfig status.
+// It returns true while the partitioning is in progress
+func (dcrh *deviceConfigReconcilerHelper) handlePartitioning(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) (bool, error) {
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-partition-agent"},
+	}
+	if devConfig.Spec.Partitioning == nil {
+		if err := dcrh.deleteIfExists(ctx, devConfig, "partition agent DaemonSet", ds); err != nil {
+			return false, err
+		}
+	} else {
+		opRes, err := controllerutil.CreateOrPatch(ctx, dcrh.client, ds, func() error {
+			return dcrh.partitionHandler.SetAgentDaemonSetAsDesired(ds, devConfig)
+		})
+		if err != nil {
+			return false, err
+		}
+		log.FromContext(ctx).Info("Reconciled partition agent", "namespace", ds.Namespace, "name", ds.Name, "result", opRes)
+		dcrh.recordOperationEvent(devConfig, "partition agent DaemonSet", ds.Name, opRes)
+	}
+
+	devConfigCopy := devConfig.DeepCopy()
+	inProgress, partitionErr := dcrh.partitionHandler.HandlePartitioning(ctx, devConfig)
+
+	if equality.Semantic.DeepEqual(devConfigCopy.Status.NodePartitions, devConfig.Status.NodePartitions) {
+		return inProgress, partitionErr
+	}
+
+	previousStates := map[string]string{}
+	for _, nodeStatus := range devConfigCopy.Status.NodePartitions {
+		previousStates[nodeStatus.NodeName] = nodeStatus.State
+	}
+	for _, nodeStatus := range devConfig.Status.NodePartitions {
+		if previousStates[nodeStatus.NodeName] == nodeStatus.State {
+			continue
+		}
+		eventType := v1.EventTypeNormal
+		if nodeStatus.State == amdv1alpha1.PartitionStateFailed {
+			eventType = v1.EventTypeWarning
+		}
+		dcrh.recorder.Eventf(devConfig, eventType, eventReasonPartition, "Node %s partitioning to %s: %s",
+			nodeStatus.NodeName, nodeStatus.Profile, nodeStatus.State)
+	}
+
+	if err := dcrh.client.Status().Patch(ctx, devConfig, client.MergeFrom(devConfigCopy)); err != nil {
+		return inProgress, errors.Join(partitionErr, fmt.Errorf("failed to patch the nodes partitioning status: %v", err))
+	}
+
+	return inProgress, partitionErr
+}
+
+// handleDevicePlugin deploys the device plugin DaemonSet when in-tree drivers are used.
+// For OOT drivers the device plugin is deployed by KMM as part of the Module
+func (dcrh *deviceConfigReconcilerHelper) handleDevicePlugin(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error {
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-device-plugin"},
+	}
+	if !devConfig.Spec.UseInTreeDrivers {
+		return dcrh.deleteIfExists(ctx, devConfig, "device plugin DaemonSet", ds)
+	}
+
+	logger := log.FromContext(ctx)
+	opRes, err := controllerutil.CreateOrPatch(ctx, dcrh.client, ds, func() error {
+		return dcrh.kmmHandler.SetDevicePluginAsDesired(ds, devConfig)
+	})
+
+	if err == nil {
+		logger.Info("Reconciled device plugin", "namespace", ds.Namespace, "name", ds.Name, "result", opRes)
+		dcrh.recordOperationEvent(devConfig, "device plugin DaemonSet", ds.Name, opRes)
+	}
+
+	return err
+}
+
 func (dcrh *deviceConfigReconcilerHelper) handleNodeLabeller(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error {
 	ds := &appsv1.DaemonSet{
 		ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-labeller"},
 	}
 	logger := log.FromContext(ctx)
+	if !nodelabeller.IsEnabled(devConfig) {
+		logger.Info("node labeller is disabled", "name", ds.Name)
+		return dcrh.deleteIfExists(ctx, devConfig, "node labeller DaemonSet", ds)
+	}
+
 	opRes, err := controllerutil.CreateOrPatch(ctx, dcrh.client, ds, func() error {
 		return dcrh.nlHandler.SetNodeLabellerAsDesired(ds, devConfig)
 	})
 
 	if err == nil {
 		logger.Info("Reconciled node labeller", "namespace", ds.Namespace, "name", ds.Name, "result", opRes)
+		dcrh.recordOperationEvent(devConfig, "node labeller DaemonSet", ds.Name, opRes)
 	}
 
 	return err
 }
 
+// handleNodeMetrics deploys the metrics exporter DaemonSet, and the Service and ServiceMonitor exposing it.
+// When kube-rbac-proxy is used, it also deploys the ClusterRole allowing to read the metrics.
+// The ServiceMonitor is skipped if the prometheus-operator CRDs are not installed in the cluster
 func (dcrh *deviceConfigReconcilerHelper) handleNodeMetrics(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error {
 	ds := &appsv1.DaemonSet{
 		ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"},
 	}
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"},
+	}
+	sm := newServiceMonitor(devConfig)
+	cr := newMetricsReaderClusterRole(devConfig)
+
 	logger := log.FromContext(ctx)
+	if !nodemetrics.IsEnabled(devConfig) {
+		logger.Info("metrics exporter is disabled", "name", ds.Name)
+		if err := dcrh.deleteIfExists(ctx, devConfig, "node metrics DaemonSet", ds); err != nil {
+			return err
+		}
+		if err := dcrh.deleteIfExists(ctx, devConfig, "node metrics Service", svc); err != nil {
+			return err
+		}
+		if err := dcrh.deleteIfExists(ctx, devConfig, "node metrics reader ClusterRole", cr); err != nil {
+			return err
+		}
+		return dcrh.deleteIfExists(ctx, devConfig, "node metrics ServiceMonitor", sm)
+	}
+
 	opRes, err := controllerutil.CreateOrPatch(ctx, dcrh.client, ds, func() error {
 		return dcrh.nmHandler.SetNodeMetricsAsDesired(ds, devConfig)
 	})
+	if err != nil {
+		return err
+	}
+	logger.Info("Reconciled node metrics", "namespace", ds.Namespace, "name", ds.Name, "result", opRes)
+	dcrh.recordOperationEvent(devConfig, "node metrics DaemonSet", ds.Name, opRes)
 
+	opRes, err = controllerutil.CreateOrPatch(ctx, dcrh.client, svc, func() error {
+		return dcrh.nmHandler.SetMetricsServiceAsDesired(svc, devConfig)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reconcile metrics service: %v", err)
+	}
+	logger.Info("Reconciled node metrics service", "namespace", svc.Namespace, "name", svc.Name, "result", opRes)
+	dcrh.recordOperationEvent(devConfig, "node metrics Service", svc.Name, opRes)
+
+	if devConfig.Spec.MetricsExporter.RbacProxy == nil {
+		if err = dcrh.deleteIfExists(ctx, devConfig, "node metrics reader ClusterRole", cr); err != nil {
+			return err
+		}
+	} else {
+		opRes, err = controllerutil.CreateOrPatch(ctx, dcrh.client, cr, func() error {
+			return dcrh.nmHandler.SetMetricsReaderClusterRoleAsDesired(cr, devConfig)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to reconcile metrics reader cluster role: %v", err)
+		}
+		logger.Info("Reconciled node metrics reader cluster role", "name", cr.Name, "result", opRes)
+		dcrh.recordOperationEvent(devConfig, "node metrics reader ClusterRole", cr.Name, opRes)
+	}
+
+	opRes, err = controllerutil.CreateOrPatch(ctx, dcrh.client, sm, func() error {
+		return dcrh.nmHandler.SetServiceMonitorAsDesired(sm, devConfig)
+	})
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			logger.Info("ServiceMonitor CRD is not installed, skipping the node metrics ServiceMonitor")
+			return nil
+		}
+		return fmt.Errorf("failed to reconcile metrics service monitor: %v", err)
+	}
+	logger.Info("Reconciled node metrics service monitor", "namespace", sm.GetNamespace(), "name", sm.GetName(), "result", opRes)
+	dcrh.recordOperationEvent(devConfig, "node metrics ServiceMonitor", sm.GetName(), opRes)
+
+	return nil
+}
+
+func (dcrh *deviceConfigReconcilerHelper) handleDeviceConfigStatus(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error {
+	devConfigCopy := devConfig.DeepCopy()
+
+	mod := kmmv1beta1.Module{}
+	namespacedName := types.NamespacedName{
+		Namespace: devConfig.Namespace,
+		Name:      devConfig.Name,
+	}
+	err := dcrh.client.Get(ctx, namespacedName, &mod)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get the requested Module %s: %v", namespacedName, err)
+	}
+
+	devConfig.Status.Drivers = amdv1alpha1.DeploymentStatus(mod.Status.ModuleLoader)
+	devConfig.Status.DevicePlugin = amdv1alpha1.DeploymentStatus(mod.Status.DevicePlugin)
+
+	// the operand daemonsets are targeting the same nodes as the KMM Module
+	nodesMatchingSelectorNumber := mod.Status.ModuleLoader.NodesMatchingSelectorNumber
+
+	if devConfig.Spec.UseInTreeDrivers {
+		// no KMM Module is deployed, the device plugin daemonset is owned by the operator
+		nodes := v1.NodeList{}
+		if err = dcrh.client.List(ctx, &nodes, client.MatchingLabels(utils.GetNodeSelector(devConfig))); err != nil {
+			return fmt.Errorf("failed to list nodes matching DeviceConfig selector: %v", err)
+		}
+		nodesMatchingSelectorNumber = int32(len(nodes.Items))
+
+		devConfig.Status.DevicePlugin, err = dcrh.getDaemonSetStatus(ctx, devConfig.Namespace, devConfig.Name+"-device-plugin", nodesMatchingSelectorNumber)
+		if err != nil {
+			return err
+		}
+	}
+
+	devConfig.Status.NodeLabeller, err = dcrh.getDaemonSetStatus(ctx, devConfig.Namespace, devConfig.Name+"-node-labeller", nodesMatchingSelectorNumber)
+	if err != nil {
+		return err
+	}
+
+	devConfig.Status.NodeMetrics, err = dcrh.getDaemonSetStatus(ctx, devConfig.Namespace, devConfig.Name+"-node-metrics", nodesMatchingSelectorNumber)
+	if err != nil {
+		return err
+	}
+
+	devConfig.Status.RebootPendingNodes = nil
+	if devConfig.Spec.Blacklist.Enable {
+		devConfig.Status.RebootPendingNodes, err = dcrh.getRebootPendingNodes(ctx, devConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	if devConfig.Spec.Driver.Build.Policy == amdv1alpha1.BuildPolicyNever && !devConfig.Spec.UseInTreeDrivers {
+		nodes, err := dcrh.getSelectedNodes(ctx, devConfig)
+		if err != nil {
+			return err
+		}
+		setPrebuiltImagesCondition(devConfig, &mod, nodes)
+	} else {
+		meta.RemoveStatusCondition(&devConfig.Status.Conditions, amdv1alpha1.ConditionTypePrebuiltImagesMissing)
+	}
+
+	setAvailabilityConditions(devConfig)
+
+	return dcrh.client.Status().Patch(ctx, devConfig, client.MergeFrom(devConfigCopy))
+}
+
+// setPrebuiltImagesCondition reports the nodes without a prebuilt drivers image, when the drivers are never built:
+// the nodes whose kernel matches none of the KMM Module kernel mappings, and the nodes on which KMM did not load
+// the drivers, most likely because the image of their kernel was not pushed to the registry
+func setPrebuiltImagesCondition(devConfig *amdv1alpha1.DeviceConfig, mod *kmmv1beta1.Module, nodes []v1.Node) {
+	readyLabel := kmmlabels.GetKernelModuleReadyNodeLabel(devConfig.Namespace, devConfig.Name)
+	unmatched := []string{}
+	notLoaded := []string{}
+	for _, node := range nodes {
+		if _, ok := node.Labels[readyLabel]; ok {
+			continue
+		}
+		if kernelMappingsMatch(mod.Spec.ModuleLoader.Container.KernelMappings, node.Status.NodeInfo.KernelVersion) {
+			notLoaded = append(notLoaded, node.Name)
+		} else {
+			unmatched = append(unmatched, node.Name)
+		}
+	}
+
+	if len(unmatched) == 0 && len(notLoaded) == 0 {
+		setCondition(devConfig, amdv1alpha1.ConditionTypePrebuiltImagesMissing, metav1.ConditionFalse, amdv1alpha1.ReasonPrebuiltImagesFound, "the drivers are loaded on all the nodes")
+		return
+	}
+
+	messages := []string{}
+	if len(unmatched) > 0 {
+		sort.Strings(unmatched)
+		messages = append(messages, "no kernel mapping matches the kernel of nodes "+strings.Join(unmatched, ", "))
+	}
+	if len(notLoaded) > 0 {
+		sort.Strings(notLoaded)
+		messages = append(messages, "the drivers are not loaded on nodes "+strings.Join(notLoaded, ", ")+", check that the drivers image of their kernel exists")
+	}
+	setCondition(devConfig, amdv1alpha1.ConditionTypePrebuiltImagesMissing, metav1.ConditionTrue, amdv1alpha1.ReasonPrebuiltImagesMissing, strings.Join(messages, "; "))
+}
+
+func kernelMappingsMatch(kernelMappings []kmmv1beta1.KernelMapping, kernel string) bool {
+	for _, km := range kernelMappings {
+		if km.Literal != "" && km.Literal == kernel {
+			return true
+		}
+		if km.Regexp != "" {
+			if matched, err := regexp.MatchString(km.Regexp, kernel); err == nil && matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getRebootPendingNodes returns the selected nodes that were not rebooted since the inbox driver was
+// blacklisted: the nodes on which the machine config operator did not apply the desired configuration
+// yet, and the nodes on which the blacklist DaemonSet pod is not ready
+func (dcrh *deviceConfigReconcilerHelper) getRebootPendingNodes(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) ([]string, error) {
+	nodes, err := dcrh.getSelectedNodes(ctx, devConfig)
+	if err != nil {
+		return nil, err
+	}
+	pending := map[string]bool{}
+	for i := range nodes {
+		if blacklist.IsMachineConfigPending(&nodes[i]) {
+			pending[nodes[i].Name] = true
+		}
+	}
+
+	pods := v1.PodList{}
+	err = dcrh.client.List(ctx, &pods, client.InNamespace(devConfig.Namespace), client.MatchingLabels(blacklist.GetBlacklistPodLabels(devConfig)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blacklist pods: %v", err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != "" && !isPodReady(&pod) {
+			pending[pod.Spec.NodeName] = true
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	nodeNames := make([]string, 0, len(pending))
+	for name := range pending {
+		nodeNames = append(nodeNames, name)
+	}
+	sort.Strings(nodeNames)
+	return nodeNames, nil
+}
+
+func isPodReady(pod *v1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == v1.PodReady {
+			return cond.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// setDegradedStatus marks the DeviceConfig as Degraded because of the failure of the reconciliation step
+// identified by reason, and records a warning event. Failure to update the status is only logged, since
+// the step error is the one returned to the controller
+func (dcrh *deviceConfigReconcilerHelper) setDegradedStatus(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, reason string, stepErr error) {
+	logger := log.FromContext(ctx)
+	devConfigCopy := devConfig.DeepCopy()
+
+	dcrh.recorder.Event(devConfig, v1.EventTypeWarning, reason, stepErr.Error())
+
+	setCondition(devConfig, amdv1alpha1.ConditionTypeDegraded, metav1.ConditionTrue, reason, stepErr.Error())
+	setCondition(devConfig, amdv1alpha1.ConditionTypeReady, metav1.ConditionFalse, reason, stepErr.Error())
+	setCondition(devConfig, amdv1alpha1.ConditionTypeProgressing, metav1.ConditionFalse, reason, stepErr.Error())
+
+	if err := dcrh.client.Status().Patch(ctx, devConfig, client.MergeFrom(devConfigCopy)); err != nil {
+		logger.Error(err, "failed to update DeviceConfig degraded status", "reason", reason)
+	}
+}
+
+// setAvailabilityConditions sets the Ready and Progressing conditions based on the deployment status of the
+// operands. Since all the reconciliation steps succeeded, the DeviceConfig is only Degraded when the preflight
+// validation of the drivers failed, in which case the nodes keep the current drivers
+func setAvailabilityConditions(devConfig *amdv1alpha1.DeviceConfig) {
+	if preflight := devConfig.Status.Preflight; preflight != nil && preflight.State == amdv1alpha1.PreflightStateFailed {
+		failedKernels := []string{}
+		for _, kernelStatus := range preflight.Kernels {
+			if kernelStatus.VerificationStatus != kmmv1beta1.VerificationTrue && kernelStatus.VerificationStage == kmmv1beta1.VerificationStageDone {
+				failedKernels = append(failedKernels, kernelStatus.Kernel)
+			}
+		}
+		setCondition(devConfig, amdv1alpha1.ConditionTypeDegraded, metav1.ConditionTrue, amdv1alpha1.ReasonPreflightFailed,
+			fmt.Sprintf("preflight validation of drivers version %s failed for kernels %s, the nodes keep the current drivers",
+				preflight.DriversVersion, strings.Join(failedKernels, ", ")))
+	} else {
+		setCondition(devConfig, amdv1alpha1.ConditionTypeDegraded, metav1.ConditionFalse, amdv1alpha1.ReasonReconcileSucceeded, "all reconciliation steps succeeded")
+	}
+
+	notAvailable := []string{}
+	operands := []struct {
+		name   string
+		status amdv1alpha1.DeploymentStatus
+	}{
+		{name: "drivers", status: devConfig.Status.Drivers},
+		{name: "device-plugin", status: devConfig.Status.DevicePlugin},
+		{name: "node-labeller", status: devConfig.Status.NodeLabeller},
+		{name: "node-metrics", status: devConfig.Status.NodeMetrics},
+	}
+	desired := int32(0)
+	for _, operand := range operands {
+		desired += operand.status.DesiredNumber
+		if operand.status.AvailableNumber < operand.status.DesiredNumber {
+			notAvailable = append(notAvailable, fmt.Sprintf("%s (%d/%d)", operand.name, operand.status.AvailableNumber, operand.status.DesiredNumber))
+		}
+	}
+
+	if desired == 0 {
+		message := "no node matching the selector runs the operands yet"
+		setCondition(devConfig, amdv1alpha1.ConditionTypeReady, metav1.ConditionFalse, amdv1alpha1.ReasonNoMatchingNodes, message)
+		setCondition(devConfig, amdv1alpha1.ConditionTypeProgressing, metav1.ConditionFalse, amdv1alpha1.ReasonNoMatchingNodes, message)
+		return
+	}
+
+	// the device plugin runs on all the nodes of the DeviceConfig, it is only missing while they are not ready
+	if devConfig.Status.DevicePlugin.DesiredNumber == 0 {
+		notAvailable = append(notAvailable, "device-plugin (0/0)")
+	}
+
+	if len(notAvailable) == 0 {
+		setCondition(devConfig, amdv1alpha1.ConditionTypeReady, metav1.ConditionTrue, amdv1alpha1.ReasonOperandsAvailable, "all operands are available")
+		setCondition(devConfig, amdv1alpha1.ConditionTypeProgressing, metav1.ConditionFalse, amdv1alpha1.ReasonOperandsAvailable, "all operands are available")
+		return
+	}
+
+	message := "operands not available yet: " + strings.Join(notAvailable, ", ")
+	setCondition(devConfig, amdv1alpha1.ConditionTypeReady, metav1.ConditionFalse, amdv1alpha1.ReasonOperandsNotAvailable, message)
+	setCondition(devConfig, amdv1alpha1.ConditionTypeProgressing, metav1.ConditionTrue, amdv1alpha1.ReasonOperandsNotAvailable, message)
+}
+
+func setCondition(devConfig *amdv1alpha1.DeviceConfig, condType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&devConfig.Status.Conditions, metav1.Condition{
+		Type:               condType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: devConfig.Generation,
+	})
+}
+
+func (dcrh *deviceConfigReconcilerHelper) getDaemonSetStatus(ctx context.Context,
+	namespace string,
+	name string,
+	nodesMatchingSelectorNumber int32) (amdv1alpha1.DeploymentStatus, error) {
+	ds := appsv1.DaemonSet{}
+	namespacedName := types.NamespacedName{
+		Namespace: namespace,
+		Name:      name,
+	}
+
+	err := dcrh.client.Get(ctx, namespacedName, &ds)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return amdv1alpha1.DeploymentStatus{}, nil
+		}
+		return amdv1alpha1.DeploymentStatus{}, fmt.Errorf("failed to get daemonset %s: %v", namespacedName, err)
+	}
+
+	return amdv1alpha1.DeploymentStatus{
+		NodesMatchingSelectorNumber: nodesMatchingSelectorNumber,
+		DesiredNumber:               ds.Status.DesiredNumberScheduled,
+		AvailableNumber:             ds.Status.NumberAvailable,
+	}, nil
+}
+
+// getSelectedNodes returns the nodes matching the selector of the DeviceConfig
+func (dcrh *deviceConfigReconcilerHelper) getSelectedNodes(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) ([]v1.Node, error) {
+	nodes := v1.NodeList{}
+	if err := dcrh.client.List(ctx, &nodes, client.MatchingLabels(utils.GetNodeSelector(devConfig))); err != nil {
+		return nil, fmt.Errorf("failed to list nodes matching DeviceConfig selector: %v", err)
+	}
+	return nodes.Items, nil
+}
+
+func (dcrh *deviceConfigReconcilerHelper) deleteIfExists(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, kind string, obj client.Object) error {
+	err := dcrh.client.Delete(ctx, obj)
+	if err != nil && !k8serrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+		return fmt.Errorf("failed to delete %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
 	if err == nil {
-		logger.Info("Reconciled node metrics", "namespace", ds.Namespace, "name", ds.Name, "result", opRes)
+		log.FromContext(ctx).Info("deleted object", "namespace", obj.GetNamespace(), "name", obj.GetName())
+		dcrh.recorder.Eventf(devConfig, v1.EventTypeNormal, eventReasonDeleted, "Deleted %s %s", kind, obj.GetName())
 	}
+	return nil
+}
 
-	return err
+// recordOperationEvent records an event on the DeviceConfig when an owned resource was created or patched
+func (dcrh *deviceConfigReconcilerHelper) recordOperationEvent(devConfig *amdv1alpha1.DeviceConfig, kind, name string, opRes controllerutil.OperationResult) {
+	switch opRes {
+	case controllerutil.OperationResultCreated:
+		dcrh.recorder.Eventf(devConfig, v1.EventTypeNormal, eventReasonCreated, "Created %s %s", kind, name)
+	case controllerutil.OperationResultUpdated:
+		dcrh.recorder.Eventf(devConfig, v1.EventTypeNormal, eventReasonPatched, "Patched %s %s", kind, name)
+	}
+}
+
+func newServiceMonitor(devConfig *amdv1alpha1.DeviceConfig) *unstructured.Unstructured {
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(nodemetrics.ServiceMonitorGVK)
+	sm.SetNamespace(devConfig.Namespace)
+	sm.SetName(devConfig.Name + "-node-metrics")
+	return sm
+}
+
+func newMetricsReaderClusterRole(devConfig *amdv1alpha1.DeviceConfig) *rbacv1.ClusterRole {
+	return &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: nodemetrics.GetMetricsReaderClusterRoleName(devConfig)},
+	}
+}
+
+func newBlacklistDaemonSet(devConfig *amdv1alpha1.DeviceConfig) *appsv1.DaemonSet {
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-blacklist"},
+	}
 }
 
-func getDockerfileCMName(devConfig *amdv1alpha1.DeviceConfig) string {
-	return "dockerfile-" + devConfig.Name
+func newMachineConfig(devConfig *amdv1alpha1.DeviceConfig, role string) *unstructured.Unstructured {
+	mc := &unstructured.Unstructured{}
+	mc.SetGroupVersionKind(blacklist.MachineConfigGVK)
+	mc.SetName(blacklist.GetMachineConfigName(devConfig, role))
+	return mc
 }
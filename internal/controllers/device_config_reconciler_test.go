@@ -19,25 +19,36 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	kmmv1beta1 "github.com/rh-ecosystem-edge/kernel-module-management/api/v1beta1"
 	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/blacklist"
 	mock_client "github.com/yevgeny-shnaidman/amd-gpu-operator/internal/client"
 	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/kmmmodule"
 	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/nodelabeller"
 	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/nodemetrics"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/partition"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/preflight"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/upgrade"
 	"go.uber.org/mock/gomock"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 const (
@@ -70,8 +81,10 @@ var _ = Describe("Reconcile", func() {
 		setFinalizerError,
 		buildConfigMapError,
 		handleKMMModuleError,
+		handleDevicePluginError,
 		handleNodeLabellerError,
-		handleMetricsError bool) {
+		handleMetricsError,
+		handleStatusError bool) {
 		devConfig := &amdv1alpha1.DeviceConfig{}
 		if getDeviceError {
 			mockHelper.EXPECT().getRequestedDeviceConfig(ctx, nn).Return(nil, fmt.Errorf("some error"))
@@ -83,52 +96,201 @@ var _ = Describe("Reconcile", func() {
 			goto executeTestFunction
 		}
 		mockHelper.EXPECT().setFinalizer(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().getOverlappingNodes(ctx, devConfig).Return(nil, nil)
+		mockHelper.EXPECT().handleBlacklist(ctx, devConfig).Return(nil)
 		if buildConfigMapError {
 			mockHelper.EXPECT().handleBuildConfigMap(ctx, devConfig).Return(fmt.Errorf("some error"))
+			mockHelper.EXPECT().setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonBuildConfigMapFailed, gomock.Any())
 			goto executeTestFunction
 		}
 		mockHelper.EXPECT().handleBuildConfigMap(ctx, devConfig).Return(nil)
 		if handleKMMModuleError {
 			mockHelper.EXPECT().handleKMMModule(ctx, devConfig).Return(fmt.Errorf("some error"))
+			mockHelper.EXPECT().setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonKMMModuleFailed, gomock.Any())
 			goto executeTestFunction
 		}
 		mockHelper.EXPECT().handleKMMModule(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().handleUpgrade(ctx, devConfig).Return(false, nil)
+		mockHelper.EXPECT().handlePartitioning(ctx, devConfig).Return(false, nil)
+		if handleDevicePluginError {
+			mockHelper.EXPECT().handleDevicePlugin(ctx, devConfig).Return(fmt.Errorf("some error"))
+			mockHelper.EXPECT().setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonDevicePluginFailed, gomock.Any())
+			goto executeTestFunction
+		}
+		mockHelper.EXPECT().handleDevicePlugin(ctx, devConfig).Return(nil)
 		if handleNodeLabellerError {
 			mockHelper.EXPECT().handleNodeLabeller(ctx, devConfig).Return(fmt.Errorf("some error"))
+			mockHelper.EXPECT().setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonNodeLabellerFailed, gomock.Any())
 			goto executeTestFunction
 		}
 		mockHelper.EXPECT().handleNodeLabeller(ctx, devConfig).Return(nil)
 		if handleMetricsError {
 			mockHelper.EXPECT().handleNodeMetrics(ctx, devConfig).Return(fmt.Errorf("some error"))
+			mockHelper.EXPECT().setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonNodeMetricsFailed, gomock.Any())
 			goto executeTestFunction
 		}
 		mockHelper.EXPECT().handleNodeMetrics(ctx, devConfig).Return(nil)
+		if handleStatusError {
+			mockHelper.EXPECT().handleDeviceConfigStatus(ctx, devConfig).Return(fmt.Errorf("some error"))
+			goto executeTestFunction
+		}
+		mockHelper.EXPECT().handleDeviceConfigStatus(ctx, devConfig).Return(nil)
 
 	executeTestFunction:
 
 		res, err := dcr.Reconcile(ctx, req)
-		if getDeviceError || setFinalizerError || buildConfigMapError || handleKMMModuleError || handleNodeLabellerError || handleMetricsError {
+		if getDeviceError || setFinalizerError || buildConfigMapError || handleKMMModuleError || handleDevicePluginError || handleNodeLabellerError || handleMetricsError || handleStatusError {
 			Expect(err).To(HaveOccurred())
 		} else {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(res).To(Equal(ctrl.Result{}))
 		}
 	},
-		Entry("good flow, no requeue", false, false, false, false, false, false),
-		Entry("getDeviceConfigFailed", true, false, false, false, false, false),
-		Entry("setFinalizer failed", false, true, false, false, false, false),
-		Entry("buildConfigMap failed", false, false, true, false, false, false),
-		Entry("handleKMMModule failed", false, false, false, true, false, false),
-		Entry("handleNodeLabeller failed", false, false, false, false, true, false),
-		Entry("handleMetrics failed", false, false, false, false, false, true),
+		Entry("good flow, no requeue", false, false, false, false, false, false, false, false),
+		Entry("getDeviceConfigFailed", true, false, false, false, false, false, false, false),
+		Entry("setFinalizer failed", false, true, false, false, false, false, false, false),
+		Entry("buildConfigMap failed", false, false, true, false, false, false, false, false),
+		Entry("handleKMMModule failed", false, false, false, true, false, false, false, false),
+		Entry("handleDevicePlugin failed", false, false, false, false, true, false, false, false),
+		Entry("handleNodeLabeller failed", false, false, false, false, false, true, false, false),
+		Entry("handleMetrics failed", false, false, false, false, false, false, true, false),
+		Entry("handleDeviceConfigStatus failed", false, false, false, false, false, false, false, true),
 	)
 
+	It("overlapping nodes", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+
+		mockHelper.EXPECT().getRequestedDeviceConfig(ctx, req.NamespacedName).Return(devConfig, nil)
+		mockHelper.EXPECT().setFinalizer(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().getOverlappingNodes(ctx, devConfig).Return([]string{"node1", "node2"}, nil)
+		mockHelper.EXPECT().setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonNodesOverlap, gomock.Any()).Do(
+			func(_ interface{}, _ *amdv1alpha1.DeviceConfig, _ string, stepErr error) {
+				Expect(stepErr.Error()).To(ContainSubstring("node1, node2"))
+			},
+		)
+
+		res, err := dcr.Reconcile(ctx, req)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(Equal(ctrl.Result{}))
+	})
+
+	It("drivers upgrade in progress", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+
+		gomock.InOrder(
+			mockHelper.EXPECT().getRequestedDeviceConfig(ctx, req.NamespacedName).Return(devConfig, nil),
+			mockHelper.EXPECT().setFinalizer(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().getOverlappingNodes(ctx, devConfig).Return(nil, nil),
+			mockHelper.EXPECT().handleBlacklist(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().handleBuildConfigMap(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().handleKMMModule(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().handleUpgrade(ctx, devConfig).Return(true, nil),
+			mockHelper.EXPECT().handlePartitioning(ctx, devConfig).Return(false, nil),
+			mockHelper.EXPECT().handleDevicePlugin(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().handleNodeLabeller(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().handleNodeMetrics(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().handleDeviceConfigStatus(ctx, devConfig).Return(nil),
+		)
+
+		res, err := dcr.Reconcile(ctx, req)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(Equal(ctrl.Result{RequeueAfter: upgradeRequeueInterval}))
+	})
+
+	It("drivers upgrade failed", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+
+		mockHelper.EXPECT().getRequestedDeviceConfig(ctx, req.NamespacedName).Return(devConfig, nil)
+		mockHelper.EXPECT().setFinalizer(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().getOverlappingNodes(ctx, devConfig).Return(nil, nil)
+		mockHelper.EXPECT().handleBlacklist(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().handleBuildConfigMap(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().handleKMMModule(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().handleUpgrade(ctx, devConfig).Return(false, fmt.Errorf("some error"))
+		mockHelper.EXPECT().setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonUpgradeFailed, gomock.Any())
+
+		_, err := dcr.Reconcile(ctx, req)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("GPU partitioning in progress", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+
+		gomock.InOrder(
+			mockHelper.EXPECT().getRequestedDeviceConfig(ctx, req.NamespacedName).Return(devConfig, nil),
+			mockHelper.EXPECT().setFinalizer(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().getOverlappingNodes(ctx, devConfig).Return(nil, nil),
+			mockHelper.EXPECT().handleBlacklist(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().handleBuildConfigMap(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().handleKMMModule(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().handleUpgrade(ctx, devConfig).Return(false, nil),
+			mockHelper.EXPECT().handlePartitioning(ctx, devConfig).Return(true, nil),
+			mockHelper.EXPECT().handleDevicePlugin(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().handleNodeLabeller(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().handleNodeMetrics(ctx, devConfig).Return(nil),
+			mockHelper.EXPECT().handleDeviceConfigStatus(ctx, devConfig).Return(nil),
+		)
+
+		res, err := dcr.Reconcile(ctx, req)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(Equal(ctrl.Result{RequeueAfter: upgradeRequeueInterval}))
+	})
+
+	It("GPU partitioning failed", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+
+		mockHelper.EXPECT().getRequestedDeviceConfig(ctx, req.NamespacedName).Return(devConfig, nil)
+		mockHelper.EXPECT().setFinalizer(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().getOverlappingNodes(ctx, devConfig).Return(nil, nil)
+		mockHelper.EXPECT().handleBlacklist(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().handleBuildConfigMap(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().handleKMMModule(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().handleUpgrade(ctx, devConfig).Return(false, nil)
+		mockHelper.EXPECT().handlePartitioning(ctx, devConfig).Return(false, fmt.Errorf("some error"))
+		mockHelper.EXPECT().setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonPartitioningFailed, gomock.Any())
+
+		_, err := dcr.Reconcile(ctx, req)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("inbox driver blacklist failed", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+
+		mockHelper.EXPECT().getRequestedDeviceConfig(ctx, req.NamespacedName).Return(devConfig, nil)
+		mockHelper.EXPECT().setFinalizer(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().getOverlappingNodes(ctx, devConfig).Return(nil, nil)
+		mockHelper.EXPECT().handleBlacklist(ctx, devConfig).Return(fmt.Errorf("some error"))
+		mockHelper.EXPECT().setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonBlacklistFailed, gomock.Any())
+
+		_, err := dcr.Reconcile(ctx, req)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("node overlap check failed", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+
+		mockHelper.EXPECT().getRequestedDeviceConfig(ctx, req.NamespacedName).Return(devConfig, nil)
+		mockHelper.EXPECT().setFinalizer(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().getOverlappingNodes(ctx, devConfig).Return(nil, fmt.Errorf("some error"))
+		mockHelper.EXPECT().setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonNodeOverlapCheckFailed, gomock.Any())
+
+		_, err := dcr.Reconcile(ctx, req)
+
+		Expect(err).To(HaveOccurred())
+	})
+
 	It("device config finalization", func() {
 		devConfig := &amdv1alpha1.DeviceConfig{}
 		devConfig.SetDeletionTimestamp(&metav1.Time{})
 
 		mockHelper.EXPECT().getRequestedDeviceConfig(ctx, req.NamespacedName).Return(devConfig, nil)
-		mockHelper.EXPECT().finalizeDeviceConfig(ctx, devConfig).Return(nil)
+		mockHelper.EXPECT().finalizeDeviceConfig(ctx, devConfig).Return(true, nil)
 
 		res, err := dcr.Reconcile(ctx, req)
 
@@ -136,7 +298,15 @@ var _ = Describe("Reconcile", func() {
 		Expect(res).To(Equal(ctrl.Result{}))
 
 		mockHelper.EXPECT().getRequestedDeviceConfig(ctx, req.NamespacedName).Return(devConfig, nil)
-		mockHelper.EXPECT().finalizeDeviceConfig(ctx, devConfig).Return(fmt.Errorf("some error"))
+		mockHelper.EXPECT().finalizeDeviceConfig(ctx, devConfig).Return(false, nil)
+
+		res, err = dcr.Reconcile(ctx, req)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(Equal(ctrl.Result{RequeueAfter: finalizeRequeueInterval}))
+
+		mockHelper.EXPECT().getRequestedDeviceConfig(ctx, req.NamespacedName).Return(devConfig, nil)
+		mockHelper.EXPECT().finalizeDeviceConfig(ctx, devConfig).Return(false, fmt.Errorf("some error"))
 
 		res, err = dcr.Reconcile(ctx, req)
 		Expect(err).To(HaveOccurred())
@@ -153,7 +323,7 @@ var _ = Describe("getLabelsPerModules", func() {
 	BeforeEach(func() {
 		ctrl := gomock.NewController(GinkgoT())
 		kubeClient = mock_client.NewMockClient(ctrl)
-		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil, nil, nil, nil, nil, &record.FakeRecorder{})
 	})
 
 	ctx := context.Background()
@@ -198,7 +368,7 @@ var _ = Describe("setFinalizer", func() {
 	BeforeEach(func() {
 		ctrl := gomock.NewController(GinkgoT())
 		kubeClient = mock_client.NewMockClient(ctrl)
-		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil, nil, nil, nil, nil, &record.FakeRecorder{})
 	})
 
 	ctx := context.Background()
@@ -225,7 +395,7 @@ var _ = Describe("setFinalizer", func() {
 	})
 })
 
-var _ = Describe("finalizeDeviceConfig", func() {
+var _ = Describe("getOverlappingNodes", func() {
 	var (
 		kubeClient *mock_client.MockClient
 		dcrh       deviceConfigReconcilerHelperAPI
@@ -234,260 +404,419 @@ var _ = Describe("finalizeDeviceConfig", func() {
 	BeforeEach(func() {
 		ctrl := gomock.NewController(GinkgoT())
 		kubeClient = mock_client.NewMockClient(ctrl)
-		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil, nil, nil, nil, nil, &record.FakeRecorder{})
 	})
 
 	ctx := context.Background()
-	devConfig := &amdv1alpha1.DeviceConfig{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      devConfigName,
-			Namespace: devConfigNamespace,
-		},
-	}
-
-	nodeLabellerNN := types.NamespacedName{
-		Name:      devConfigName + "-node-labeller",
-		Namespace: devConfigNamespace,
+	older := metav1.NewTime(time.Unix(1000, 0))
+	newer := metav1.NewTime(time.Unix(2000, 0))
+	newDevConfig := func(name string, creation metav1.Time, selector map[string]string) amdv1alpha1.DeviceConfig {
+		return amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         devConfigNamespace,
+				CreationTimestamp: creation,
+			},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				Selector: selector,
+			},
+		}
 	}
-
-	metricsNN := types.NamespacedName{
-		Name:      devConfigName + "-node-metrics",
-		Namespace: devConfigNamespace,
+	nodes := []v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{"gpu": "true", "pool": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"gpu": "true", "pool": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node3", Labels: map[string]string{"gpu": "true", "pool": "b"}}},
 	}
 
-	nn := types.NamespacedName{
-		Name:      devConfigName,
-		Namespace: devConfigNamespace,
-	}
+	It("overlap with an older DeviceConfig", func() {
+		devConfig := newDevConfig(devConfigName, newer, map[string]string{"gpu": "true"})
+		kubeClient.EXPECT().List(ctx, gomock.Any()).Do(
+			func(_ interface{}, list *amdv1alpha1.DeviceConfigList, _ ...client.ListOption) {
+				list.Items = []amdv1alpha1.DeviceConfig{devConfig, newDevConfig("other", older, map[string]string{"pool": "a"})}
+			},
+		)
+		kubeClient.EXPECT().List(ctx, gomock.Any(), client.MatchingLabels{"gpu": "true"}).Do(
+			func(_ interface{}, list *v1.NodeList, _ ...client.ListOption) {
+				list.Items = nodes
+			},
+		)
 
-	It("failed to get NodeLabeller daemonset", func() {
-		kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(fmt.Errorf("some error"))
+		res, err := dcrh.getOverlappingNodes(ctx, &devConfig)
 
-		err := dcrh.finalizeDeviceConfig(ctx, devConfig)
-		Expect(err).To(HaveOccurred())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(Equal([]string{"node1", "node2"}))
 	})
 
-	It("node labeller daemonset exists", func() {
-		gomock.InOrder(
-			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(nil),
-			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+	It("overlap with a newer DeviceConfig", func() {
+		devConfig := newDevConfig(devConfigName, older, map[string]string{"gpu": "true"})
+		kubeClient.EXPECT().List(ctx, gomock.Any()).Do(
+			func(_ interface{}, list *amdv1alpha1.DeviceConfigList, _ ...client.ListOption) {
+				list.Items = []amdv1alpha1.DeviceConfig{devConfig, newDevConfig("other", newer, map[string]string{"pool": "a"})}
+			},
 		)
 
-		err := dcrh.finalizeDeviceConfig(ctx, devConfig)
-		Expect(err).To(BeNil())
+		res, err := dcrh.getOverlappingNodes(ctx, &devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(BeEmpty())
 	})
 
-	It("failed to get Metrics daemonset", func() {
-		gomock.InOrder(
-			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "dsName")),
-			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(fmt.Errorf("some error")),
-		)
+	It("failed to list DeviceConfigs", func() {
+		devConfig := newDevConfig(devConfigName, newer, nil)
+		kubeClient.EXPECT().List(ctx, gomock.Any()).Return(fmt.Errorf("some error"))
+
+		_, err := dcrh.getOverlappingNodes(ctx, &devConfig)
 
-		err := dcrh.finalizeDeviceConfig(ctx, devConfig)
 		Expect(err).To(HaveOccurred())
 	})
 
-	It("node metrics daemonset exists", func() {
-		gomock.InOrder(
-			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "dsName")),
-			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(nil),
-			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+	It("failed to list nodes", func() {
+		devConfig := newDevConfig(devConfigName, newer, nil)
+		kubeClient.EXPECT().List(ctx, gomock.Any()).Do(
+			func(_ interface{}, list *amdv1alpha1.DeviceConfigList, _ ...client.ListOption) {
+				list.Items = []amdv1alpha1.DeviceConfig{newDevConfig("other", older, nil)}
+			},
 		)
+		kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(fmt.Errorf("some error"))
+
+		_, err := dcrh.getOverlappingNodes(ctx, &devConfig)
 
-		err := dcrh.finalizeDeviceConfig(ctx, devConfig)
-		Expect(err).To(BeNil())
+		Expect(err).To(HaveOccurred())
 	})
+})
 
-	It("failed to get KMM Module", func() {
-		gomock.InOrder(
-			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "dsName")),
-			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "dsName")),
-			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Return(fmt.Errorf("some error")),
-		)
+var _ = Describe("getAllDeviceConfigsRequests", func() {
+	var (
+		kubeClient *mock_client.MockClient
+		dcrh       deviceConfigReconcilerHelperAPI
+	)
 
-		err := dcrh.finalizeDeviceConfig(ctx, devConfig)
-		Expect(err).To(HaveOccurred())
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil, nil, nil, nil, nil, &record.FakeRecorder{})
 	})
 
-	It("KMM module not found, removing finalizer", func() {
-		expectedDevConfig := devConfig.DeepCopy()
-		expectedDevConfig.SetFinalizers([]string{})
-		controllerutil.AddFinalizer(devConfig, deviceConfigFinalizer)
+	ctx := context.Background()
 
-		gomock.InOrder(
-			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "dsName")),
-			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "dsName")),
-			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "moduleName")),
-			kubeClient.EXPECT().Patch(ctx, expectedDevConfig, gomock.Any()).Return(nil),
+	It("good flow", func() {
+		kubeClient.EXPECT().List(ctx, gomock.Any()).Do(
+			func(_ interface{}, list *amdv1alpha1.DeviceConfigList, _ ...client.ListOption) {
+				list.Items = []amdv1alpha1.DeviceConfig{
+					{ObjectMeta: metav1.ObjectMeta{Name: "first", Namespace: devConfigNamespace}},
+					{ObjectMeta: metav1.ObjectMeta{Name: "second", Namespace: devConfigNamespace}},
+				}
+			},
 		)
 
-		err := dcrh.finalizeDeviceConfig(ctx, devConfig)
-		Expect(err).ToNot(HaveOccurred())
-	})
+		res := dcrh.getAllDeviceConfigsRequests(ctx, &v1.Node{})
 
-	It("KMM module found, deleting it", func() {
-		mod := kmmv1beta1.Module{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      devConfigName,
-				Namespace: devConfigNamespace,
-			},
-		}
+		Expect(res).To(Equal([]reconcile.Request{
+			{NamespacedName: types.NamespacedName{Name: "first", Namespace: devConfigNamespace}},
+			{NamespacedName: types.NamespacedName{Name: "second", Namespace: devConfigNamespace}},
+		}))
+	})
 
-		expectedDevConfig := devConfig.DeepCopy()
-		expectedDevConfig.SetFinalizers([]string{})
-		controllerutil.AddFinalizer(devConfig, deviceConfigFinalizer)
+	It("error flow", func() {
+		kubeClient.EXPECT().List(ctx, gomock.Any()).Return(fmt.Errorf("some error"))
 
-		gomock.InOrder(
-			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "dsName")),
-			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "dsName")),
-			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Do(
-				func(_ interface{}, _ interface{}, mod *kmmv1beta1.Module, _ ...client.GetOption) {
-					mod.Name = nn.Name
-					mod.Namespace = nn.Namespace
-				},
-			),
-			kubeClient.EXPECT().Delete(ctx, &mod).Return(nil),
-		)
+		res := dcrh.getAllDeviceConfigsRequests(ctx, &v1.Node{})
 
-		err := dcrh.finalizeDeviceConfig(ctx, devConfig)
-		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(BeEmpty())
 	})
 })
 
-var _ = Describe("handleKMMModule", func() {
+var _ = Describe("getNodeDeviceConfigsRequests", func() {
 	var (
 		kubeClient *mock_client.MockClient
-		kmmHelper  *kmmmodule.MockKMMModuleAPI
 		dcrh       deviceConfigReconcilerHelperAPI
 	)
 
 	BeforeEach(func() {
 		ctrl := gomock.NewController(GinkgoT())
 		kubeClient = mock_client.NewMockClient(ctrl)
-		kmmHelper = kmmmodule.NewMockKMMModuleAPI(ctrl)
-		dcrh = newDeviceConfigReconcilerHelper(kubeClient, kmmHelper, nil, nil)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil, nil, nil, nil, nil, &record.FakeRecorder{})
 	})
 
 	ctx := context.Background()
-	devConfig := &amdv1alpha1.DeviceConfig{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      devConfigName,
-			Namespace: devConfigNamespace,
-		},
-	}
-
-	It("KMM Module does not exist", func() {
-		newMod := &kmmv1beta1.Module{
-			ObjectMeta: metav1.ObjectMeta{
-				Namespace: devConfig.Namespace,
-				Name:      devConfig.Name,
+	expectDeviceConfigs := func() *gomock.Call {
+		return kubeClient.EXPECT().List(ctx, gomock.Any()).Do(
+			func(_ interface{}, list *amdv1alpha1.DeviceConfigList, _ ...client.ListOption) {
+				list.Items = []amdv1alpha1.DeviceConfig{
+					{
+						ObjectMeta: metav1.ObjectMeta{Name: "first", Namespace: devConfigNamespace},
+						Spec:       amdv1alpha1.DeviceConfigSpec{Selector: map[string]string{"gpu": "true"}},
+					},
+					{
+						ObjectMeta: metav1.ObjectMeta{Name: "second", Namespace: devConfigNamespace},
+						Spec:       amdv1alpha1.DeviceConfigSpec{Selector: map[string]string{"zone": "a"}},
+					},
+				}
 			},
-		}
-		gomock.InOrder(
-			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever")),
-			kmmHelper.EXPECT().SetKMMModuleAsDesired(newMod, devConfig).Return(nil),
-			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
 		)
+	}
 
-		err := dcrh.handleKMMModule(ctx, devConfig)
-		Expect(err).ToNot(HaveOccurred())
+	It("label change not affecting the selectors match", func() {
+		expectDeviceConfigs()
+
+		res := dcrh.getNodeDeviceConfigsRequests(ctx, map[string]string{"gpu": "true", "x": "1"}, map[string]string{"gpu": "true", "x": "2"})
+
+		Expect(res).To(BeEmpty())
 	})
 
-	It("KMM Module exists", func() {
-		existingMod := &kmmv1beta1.Module{
-			ObjectMeta: metav1.ObjectMeta{
-				Namespace: devConfig.Namespace,
-				Name:      devConfig.Name,
-			},
-		}
-		gomock.InOrder(
-			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Do(
-				func(_ interface{}, _ interface{}, mod *kmmv1beta1.Module, _ ...client.GetOption) {
-					mod.Name = devConfig.Name
-					mod.Namespace = devConfig.Namespace
-				},
-			),
-			kmmHelper.EXPECT().SetKMMModuleAsDesired(existingMod, devConfig).Return(nil),
-		)
+	It("node starts matching a DeviceConfig", func() {
+		expectDeviceConfigs()
 
-		err := dcrh.handleKMMModule(ctx, devConfig)
-		Expect(err).ToNot(HaveOccurred())
+		res := dcrh.getNodeDeviceConfigsRequests(ctx, map[string]string{"gpu": "true"}, map[string]string{"gpu": "true", "zone": "a"})
+
+		Expect(res).To(Equal([]reconcile.Request{
+			{NamespacedName: types.NamespacedName{Name: "first", Namespace: devConfigNamespace}},
+			{NamespacedName: types.NamespacedName{Name: "second", Namespace: devConfigNamespace}},
+		}))
+	})
+
+	It("new node only concerns the DeviceConfigs matching it", func() {
+		expectDeviceConfigs()
+
+		res := dcrh.getNodeDeviceConfigsRequests(ctx, nil, map[string]string{"gpu": "true"})
+
+		Expect(res).To(Equal([]reconcile.Request{
+			{NamespacedName: types.NamespacedName{Name: "first", Namespace: devConfigNamespace}},
+		}))
+	})
+
+	It("error flow", func() {
+		kubeClient.EXPECT().List(ctx, gomock.Any()).Return(fmt.Errorf("some error"))
+
+		res := dcrh.getNodeDeviceConfigsRequests(ctx, nil, map[string]string{"gpu": "true"})
+
+		Expect(res).To(BeEmpty())
 	})
 })
 
-var _ = Describe("handleBuildConfigMap", func() {
+var _ = Describe("finalizeDeviceConfig", func() {
 	var (
 		kubeClient *mock_client.MockClient
-		kmmHelper  *kmmmodule.MockKMMModuleAPI
+		recorder   *record.FakeRecorder
 		dcrh       deviceConfigReconcilerHelperAPI
 	)
 
 	BeforeEach(func() {
 		ctrl := gomock.NewController(GinkgoT())
 		kubeClient = mock_client.NewMockClient(ctrl)
-		kmmHelper = kmmmodule.NewMockKMMModuleAPI(ctrl)
-		dcrh = newDeviceConfigReconcilerHelper(kubeClient, kmmHelper, nil, nil)
+		recorder = record.NewFakeRecorder(20)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil, nil, nil, nil, nil, recorder)
 	})
 
 	ctx := context.Background()
-	devConfig := &amdv1alpha1.DeviceConfig{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      devConfigName,
-			Namespace: devConfigNamespace,
-		},
-	}
-
-	It("BuildConfig does not exist", func() {
-		newBuildCM := &v1.ConfigMap{
+	newDevConfig := func() *amdv1alpha1.DeviceConfig {
+		devConfig := &amdv1alpha1.DeviceConfig{
 			ObjectMeta: metav1.ObjectMeta{
-				Namespace: devConfig.Namespace,
-				Name:      "dockerfile-" + devConfig.Name,
+				Name:      devConfigName,
+				Namespace: devConfigNamespace,
 			},
 		}
-		gomock.InOrder(
-			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever")),
-			kmmHelper.EXPECT().SetBuildConfigMapAsDesired(newBuildCM, devConfig).Return(nil),
-			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
-		)
+		controllerutil.AddFinalizer(devConfig, deviceConfigFinalizer)
+		return devConfig
+	}
 
-		err := dcrh.handleBuildConfigMap(ctx, devConfig)
-		Expect(err).ToNot(HaveOccurred())
-	})
+	nodeLabellerNN := types.NamespacedName{Name: devConfigName + "-node-labeller", Namespace: devConfigNamespace}
+	metricsNN := types.NamespacedName{Name: devConfigName + "-node-metrics", Namespace: devConfigNamespace}
+	metricsReaderNN := types.NamespacedName{Name: devConfigNamespace + "-" + devConfigName + "-metrics-reader"}
+	devicePluginNN := types.NamespacedName{Name: devConfigName + "-device-plugin", Namespace: devConfigNamespace}
+	blacklistNN := types.NamespacedName{Name: devConfigName + "-blacklist", Namespace: devConfigNamespace}
+	partitionAgentNN := types.NamespacedName{Name: devConfigName + "-partition-agent", Namespace: devConfigNamespace}
+	nn := types.NamespacedName{Name: devConfigName, Namespace: devConfigNamespace}
+	preflightNN := types.NamespacedName{Name: devConfigName + "-preflight", Namespace: devConfigNamespace}
+	buildCMNN := types.NamespacedName{Name: "dockerfile-" + devConfigName, Namespace: devConfigNamespace}
+	notFound := k8serrors.NewNotFound(schema.GroupResource{}, "name")
+
+	It("all owned resources exist, deleting all of them", func() {
+		devConfig := newDevConfig()
+		mcNN := types.NamespacedName{Name: "99-worker-amdgpu-blacklist-" + devConfigNamespace + "-" + devConfigName}
+		pfvNN := types.NamespacedName{Name: "amd-gpu-" + devConfigNamespace + "-" + devConfigName + "-kernel"}
 
-	It("BuildConfig exists", func() {
-		existingBuildCM := &v1.ConfigMap{
-			ObjectMeta: metav1.ObjectMeta{
-				Namespace: devConfig.Namespace,
-				Name:      "dockerfile-" + devConfig.Name,
-			},
-		}
 		gomock.InOrder(
-			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Do(
-				func(_ interface{}, _ interface{}, buildCM *v1.ConfigMap, _ ...client.GetOption) {
-					buildCM.Name = "dockerfile-" + devConfig.Name
-					buildCM.Namespace = devConfig.Namespace
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, list *unstructured.UnstructuredList, _ ...client.ListOption) {
+					mc := unstructured.Unstructured{}
+					mc.SetName(mcNN.Name)
+					list.Items = []unstructured.Unstructured{mc}
 				},
 			),
-			kmmHelper.EXPECT().SetBuildConfigMapAsDesired(existingBuildCM, devConfig).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, list *kmmv1beta1.PreflightValidationList, _ ...client.ListOption) {
+					list.Items = []kmmv1beta1.PreflightValidation{{ObjectMeta: metav1.ObjectMeta{Name: pfvNN.Name}}}
+				},
+			),
+			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, metricsReaderNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, devicePluginNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, blacklistNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, partitionAgentNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, preflightNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, buildCMNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, mcNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, pfvNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
 		)
 
-		err := dcrh.handleBuildConfigMap(ctx, devConfig)
+		finalized, err := dcrh.finalizeDeviceConfig(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(finalized).To(BeFalse())
+		Expect(recorder.Events).To(HaveLen(13))
+		Expect(controllerutil.ContainsFinalizer(devConfig, deviceConfigFinalizer)).To(BeTrue())
+	})
+
+	It("owned resources are being deleted, waiting", func() {
+		devConfig := newDevConfig()
+
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, metricsReaderNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, devicePluginNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, blacklistNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, partitionAgentNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Do(
+				func(_ interface{}, _ interface{}, mod *kmmv1beta1.Module, _ ...client.GetOption) {
+					mod.SetDeletionTimestamp(&metav1.Time{})
+				},
+			),
+			kubeClient.EXPECT().Get(ctx, preflightNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, buildCMNN, gomock.Any()).Return(notFound),
+		)
+
+		finalized, err := dcrh.finalizeDeviceConfig(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(finalized).To(BeFalse())
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("failures do not stop the deletion of the other resources", func() {
+		devConfig := newDevConfig()
+
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(&meta.NoKindMatchError{}),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(fmt.Errorf("some error")),
+			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(fmt.Errorf("some error")),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(fmt.Errorf("some error")),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(&meta.NoKindMatchError{}),
+			kubeClient.EXPECT().Get(ctx, metricsReaderNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, devicePluginNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, blacklistNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, partitionAgentNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, preflightNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, buildCMNN, gomock.Any()).Return(notFound),
+		)
+
+		finalized, err := dcrh.finalizeDeviceConfig(ctx, devConfig)
+
+		Expect(err).To(HaveOccurred())
+		Expect(finalized).To(BeFalse())
+		Expect(recorder.Events).To(HaveLen(1))
+	})
+
+	It("all owned resources deleted, removing finalizer", func() {
+		devConfig := newDevConfig()
+		expectedDevConfig := devConfig.DeepCopy()
+		controllerutil.RemoveFinalizer(expectedDevConfig, deviceConfigFinalizer)
+
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, metricsReaderNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, devicePluginNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, blacklistNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, partitionAgentNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, preflightNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, buildCMNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Patch(ctx, expectedDevConfig, gomock.Any()).Return(nil),
+		)
+
+		finalized, err := dcrh.finalizeDeviceConfig(ctx, devConfig)
+
 		Expect(err).ToNot(HaveOccurred())
+		Expect(finalized).To(BeTrue())
+		Expect(recorder.Events).To(HaveLen(1))
+	})
+
+	It("failed to remove finalizer", func() {
+		devConfig := newDevConfig()
+
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, metricsReaderNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, devicePluginNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, blacklistNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, partitionAgentNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, preflightNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, buildCMNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Return(fmt.Errorf("some error")),
+		)
+
+		finalized, err := dcrh.finalizeDeviceConfig(ctx, devConfig)
+
+		Expect(err).To(HaveOccurred())
+		Expect(finalized).To(BeFalse())
 	})
 })
 
-var _ = Describe("handleNodeLabeller", func() {
+var _ = Describe("handleKMMModule", func() {
 	var (
-		kubeClient         *mock_client.MockClient
-		nodeLabellerHelper *nodelabeller.MockNodeLabeller
-		dcrh               deviceConfigReconcilerHelperAPI
+		kubeClient       *mock_client.MockClient
+		statusWriter     *mock_client.MockStatusWriter
+		kmmHelper        *kmmmodule.MockKMMModuleAPI
+		preflightHandler *preflight.MockPreflightManager
+		recorder         *record.FakeRecorder
+		dcrh             deviceConfigReconcilerHelperAPI
 	)
 
 	BeforeEach(func() {
 		ctrl := gomock.NewController(GinkgoT())
 		kubeClient = mock_client.NewMockClient(ctrl)
-		nodeLabellerHelper = nodelabeller.NewMockNodeLabeller(ctrl)
-		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nodeLabellerHelper, nil)
+		statusWriter = mock_client.NewMockStatusWriter(ctrl)
+		kmmHelper = kmmmodule.NewMockKMMModuleAPI(ctrl)
+		preflightHandler = preflight.NewMockPreflightManager(ctrl)
+		recorder = record.NewFakeRecorder(10)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, kmmHelper, nil, nil, nil, nil, preflightHandler, nil, recorder)
 	})
 
 	ctx := context.Background()
@@ -498,53 +827,152 @@ var _ = Describe("handleNodeLabeller", func() {
 		},
 	}
 
-	It("NodeLabeller DaemonSet does not exist", func() {
-		newDS := &appsv1.DaemonSet{
-			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-labeller"},
+	It("KMM Module does not exist", func() {
+		newMod := &kmmv1beta1.Module{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: devConfig.Namespace,
+				Name:      devConfig.Name,
+			},
 		}
-
 		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
 			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever")),
-			nodeLabellerHelper.EXPECT().SetNodeLabellerAsDesired(newDS, devConfig).Return(nil),
+			kmmHelper.EXPECT().SetKMMModuleAsDesired(newMod, devConfig, gomock.Any()).Return(nil),
 			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
 		)
 
-		err := dcrh.handleNodeLabeller(ctx, devConfig)
+		err := dcrh.handleKMMModule(ctx, devConfig)
 		Expect(err).ToNot(HaveOccurred())
 	})
 
-	It("NodeLabeller DaemonSet exists", func() {
-		existingDS := &appsv1.DaemonSet{
-			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-labeller"},
+	It("KMM Module exists", func() {
+		existingMod := &kmmv1beta1.Module{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: devConfig.Namespace,
+				Name:      devConfig.Name,
+			},
 		}
-
 		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
 			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Do(
-				func(_ interface{}, _ interface{}, ds *appsv1.DaemonSet, _ ...client.GetOption) {
-					ds.Name = devConfig.Name + "-node-labeller"
-					ds.Namespace = devConfig.Namespace
+				func(_ interface{}, _ interface{}, mod *kmmv1beta1.Module, _ ...client.GetOption) {
+					mod.Name = devConfig.Name
+					mod.Namespace = devConfig.Namespace
 				},
 			),
-			nodeLabellerHelper.EXPECT().SetNodeLabellerAsDesired(existingDS, devConfig).Return(nil),
+			kmmHelper.EXPECT().SetKMMModuleAsDesired(existingMod, devConfig, gomock.Any()).Return(nil),
 		)
 
-		err := dcrh.handleNodeLabeller(ctx, devConfig)
+		err := dcrh.handleKMMModule(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("in-tree drivers, KMM Module is deleted", func() {
+		inTreeDevConfig := devConfig.DeepCopy()
+		inTreeDevConfig.Spec.UseInTreeDrivers = true
+
+		kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever"))
+
+		err := dcrh.handleKMMModule(ctx, inTreeDevConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("preflight validation in progress, KMM Module is not patched", func() {
+		preflightDevConfig := devConfig.DeepCopy()
+		preflightDevConfig.Spec.DriversVersion = "6.2"
+		preflightDevConfig.Spec.Driver.Preflight.Enable = true
+
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kmmHelper.EXPECT().SetKMMModuleAsDesired(gomock.Any(), preflightDevConfig, gomock.Any()).Return(nil),
+			preflightHandler.EXPECT().ValidateModule(ctx, preflightDevConfig, gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, dc *amdv1alpha1.DeviceConfig, _ *kmmv1beta1.Module, _ []v1.Node) (bool, error) {
+					dc.Status.Preflight = &amdv1alpha1.PreflightStatus{DriversVersion: "6.2", State: amdv1alpha1.PreflightStateRunning}
+					return false, nil
+				},
+			),
+			kubeClient.EXPECT().Status().Return(statusWriter),
+			statusWriter.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleKMMModule(ctx, preflightDevConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recorder.Events).To(HaveLen(1))
+	})
+
+	It("preflight validation failed, a warning event is recorded", func() {
+		preflightDevConfig := devConfig.DeepCopy()
+		preflightDevConfig.Spec.DriversVersion = "6.2"
+		preflightDevConfig.Spec.Driver.Preflight.Enable = true
+		preflightDevConfig.Status.Preflight = &amdv1alpha1.PreflightStatus{DriversVersion: "6.2", State: amdv1alpha1.PreflightStateRunning}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kmmHelper.EXPECT().SetKMMModuleAsDesired(gomock.Any(), preflightDevConfig, gomock.Any()).Return(nil),
+			preflightHandler.EXPECT().ValidateModule(ctx, preflightDevConfig, gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, dc *amdv1alpha1.DeviceConfig, _ *kmmv1beta1.Module, _ []v1.Node) (bool, error) {
+					dc.Status.Preflight.State = amdv1alpha1.PreflightStateFailed
+					return false, nil
+				},
+			),
+			kubeClient.EXPECT().Status().Return(statusWriter),
+			statusWriter.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleKMMModule(ctx, preflightDevConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(<-recorder.Events).To(HavePrefix(v1.EventTypeWarning))
+	})
+
+	It("preflight validation succeeded, KMM Module is patched", func() {
+		preflightDevConfig := devConfig.DeepCopy()
+		preflightDevConfig.Spec.Driver.Preflight.Enable = true
+		preflightDevConfig.Status.Preflight = &amdv1alpha1.PreflightStatus{State: amdv1alpha1.PreflightStateSucceeded}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kmmHelper.EXPECT().SetKMMModuleAsDesired(gomock.Any(), preflightDevConfig, gomock.Any()).Return(nil),
+			preflightHandler.EXPECT().ValidateModule(ctx, preflightDevConfig, gomock.Any(), gomock.Any()).Return(true, nil),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kmmHelper.EXPECT().SetKMMModuleAsDesired(gomock.Any(), preflightDevConfig, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleKMMModule(ctx, preflightDevConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("preflight disabled, the previous validation is deleted", func() {
+		preflightDevConfig := devConfig.DeepCopy()
+		preflightDevConfig.Status.Preflight = &amdv1alpha1.PreflightStatus{State: amdv1alpha1.PreflightStateRunning}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			preflightHandler.EXPECT().DeleteValidation(ctx, preflightDevConfig).Return(nil),
+			kubeClient.EXPECT().Status().Return(statusWriter),
+			statusWriter.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kmmHelper.EXPECT().SetKMMModuleAsDesired(gomock.Any(), preflightDevConfig, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleKMMModule(ctx, preflightDevConfig)
 		Expect(err).ToNot(HaveOccurred())
+		Expect(preflightDevConfig.Status.Preflight).To(BeNil())
 	})
 })
 
-var _ = Describe("handleNodeMetrics", func() {
+var _ = Describe("handleBlacklist", func() {
 	var (
-		kubeClient        *mock_client.MockClient
-		nodeMetricsHelper *nodemetrics.MockNodeMetrics
-		dcrh              deviceConfigReconcilerHelperAPI
+		kubeClient      *mock_client.MockClient
+		blacklistHelper *blacklist.MockBlacklist
+		dcrh            deviceConfigReconcilerHelperAPI
 	)
 
 	BeforeEach(func() {
 		ctrl := gomock.NewController(GinkgoT())
 		kubeClient = mock_client.NewMockClient(ctrl)
-		nodeMetricsHelper = nodemetrics.NewMockNodeMetrics(ctrl)
-		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nodeMetricsHelper)
+		blacklistHelper = blacklist.NewMockBlacklist(ctrl)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil, nil, blacklistHelper, nil, nil, &record.FakeRecorder{})
 	})
 
 	ctx := context.Background()
@@ -553,39 +981,1110 @@ var _ = Describe("handleNodeMetrics", func() {
 			Name:      devConfigName,
 			Namespace: devConfigNamespace,
 		},
+		Spec: amdv1alpha1.DeviceConfigSpec{
+			Blacklist: amdv1alpha1.BlacklistSpec{Enable: true},
+		},
+	}
+	notFound := k8serrors.NewNotFound(schema.GroupResource{}, "whatever")
+	listNodes := func(_ interface{}, list *v1.NodeList, _ ...client.ListOption) {
+		list.Items = []v1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"node-role.kubernetes.io/worker": ""}}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{"node-role.kubernetes.io/master": ""}}},
+		}
 	}
 
-	It("NodeMetrics DaemonSet does not exist", func() {
-		newDS := &appsv1.DaemonSet{
-			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"},
+	It("OpenShift, MachineConfigs are created per role and stale ones deleted", func() {
+		recorder := record.NewFakeRecorder(10)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil, nil, blacklistHelper, nil, nil, recorder)
+		devConfig := devConfig.DeepCopy()
+		devConfig.Spec.Selector = map[string]string{"gpu": "true"}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(listNodes),
+			kubeClient.EXPECT().Get(ctx, types.NamespacedName{Name: "99-master-amdgpu-blacklist-devConfigNamespace-devConfigName"}, gomock.Any()).Return(notFound),
+			blacklistHelper.EXPECT().SetMachineConfigAsDesired(gomock.Any(), devConfig, "master").Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any()).Do(
+				func(_ interface{}, list *v1.NodeList, _ ...client.ListOption) {
+					list.Items = []v1.Node{
+						{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"node-role.kubernetes.io/worker": "", "gpu": "true"}}},
+						{ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{"node-role.kubernetes.io/master": "", "gpu": "true"}}},
+						{ObjectMeta: metav1.ObjectMeta{Name: "node3", Labels: map[string]string{"node-role.kubernetes.io/worker": ""}}},
+					}
+				},
+			),
+			kubeClient.EXPECT().Get(ctx, types.NamespacedName{Name: "99-worker-amdgpu-blacklist-devConfigNamespace-devConfigName"}, gomock.Any()).Return(notFound),
+			blacklistHelper.EXPECT().SetMachineConfigAsDesired(gomock.Any(), devConfig, "worker").Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, list *unstructured.UnstructuredList, _ ...client.ListOption) {
+					worker := unstructured.Unstructured{}
+					worker.SetName("99-worker-amdgpu-blacklist-devConfigNamespace-devConfigName")
+					worker.SetLabels(map[string]string{"machineconfiguration.openshift.io/role": "worker"})
+					gpu := unstructured.Unstructured{}
+					gpu.SetName("99-gpu-amdgpu-blacklist-devConfigNamespace-devConfigName")
+					gpu.SetLabels(map[string]string{"machineconfiguration.openshift.io/role": "gpu"})
+					list.Items = []unstructured.Unstructured{worker, gpu}
+				},
+			),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Do(
+				func(_ interface{}, obj client.Object, _ ...client.DeleteOption) {
+					Expect(obj.GetName()).To(Equal("99-gpu-amdgpu-blacklist-devConfigNamespace-devConfigName"))
+				},
+			),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(notFound),
+		)
+
+		err := dcrh.handleBlacklist(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+
+		events := []string{}
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
 		}
+		Expect(events).To(ContainElement("Warning Blacklist MachineConfig pool worker also contains nodes not selected by the DeviceConfig, amdgpu is blacklisted on them and they are rebooted: node3"))
+		Expect(events).ToNot(ContainElement(ContainSubstring("pool master")))
+	})
 
+	It("MachineConfig CRD is not installed, DaemonSet is created", func() {
 		gomock.InOrder(
-			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever")),
-			nodeMetricsHelper.EXPECT().SetNodeMetricsAsDesired(newDS, devConfig).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(listNodes),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(&meta.NoKindMatchError{}),
+			kubeClient.EXPECT().Get(ctx, types.NamespacedName{Namespace: devConfigNamespace, Name: devConfigName + "-blacklist"}, gomock.Any()).Return(notFound),
+			blacklistHelper.EXPECT().SetBlacklistDaemonSetAsDesired(gomock.Any(), devConfig).Return(nil),
 			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
 		)
 
-		err := dcrh.handleNodeMetrics(ctx, devConfig)
+		err := dcrh.handleBlacklist(ctx, devConfig)
 		Expect(err).ToNot(HaveOccurred())
 	})
 
-	It("NodeMetrcis DaemonSet exists", func() {
-		existingDS := &appsv1.DaemonSet{
-			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"},
+	It("failed to reconcile MachineConfig", func() {
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(listNodes),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(fmt.Errorf("some error")),
+		)
+
+		err := dcrh.handleBlacklist(ctx, devConfig)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("blacklist is disabled, MachineConfigs and DaemonSet are deleted", func() {
+		disabledDevConfig := devConfig.DeepCopy()
+		disabledDevConfig.Spec.Blacklist.Enable = false
+
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(&meta.NoKindMatchError{}),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(notFound),
+		)
+
+		err := dcrh.handleBlacklist(ctx, disabledDevConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
+
+var _ = Describe("handleBuildConfigMap", func() {
+	var (
+		kubeClient *mock_client.MockClient
+		kmmHelper  *kmmmodule.MockKMMModuleAPI
+		dcrh       deviceConfigReconcilerHelperAPI
+	)
+
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		kmmHelper = kmmmodule.NewMockKMMModuleAPI(ctrl)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, kmmHelper, nil, nil, nil, nil, nil, nil, &record.FakeRecorder{})
+	})
+
+	ctx := context.Background()
+	devConfig := &amdv1alpha1.DeviceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      devConfigName,
+			Namespace: devConfigNamespace,
+		},
+	}
+
+	It("BuildConfig does not exist", func() {
+		newBuildCM := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: devConfig.Namespace,
+				Name:      "dockerfile-" + devConfig.Name,
+			},
 		}
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever")),
+			kmmHelper.EXPECT().SetBuildConfigMapAsDesired(newBuildCM, devConfig, kmmmodule.NodeOS{}).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleBuildConfigMap(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
 
+	It("BuildConfig exists", func() {
+		existingBuildCM := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: devConfig.Namespace,
+				Name:      "dockerfile-" + devConfig.Name,
+			},
+		}
 		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
 			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Do(
-				func(_ interface{}, _ interface{}, ds *appsv1.DaemonSet, _ ...client.GetOption) {
-					ds.Name = devConfig.Name + "-node-metrics"
-					ds.Namespace = devConfig.Namespace
+				func(_ interface{}, _ interface{}, buildCM *v1.ConfigMap, _ ...client.GetOption) {
+					buildCM.Name = "dockerfile-" + devConfig.Name
+					buildCM.Namespace = devConfig.Namespace
 				},
 			),
-			nodeMetricsHelper.EXPECT().SetNodeMetricsAsDesired(existingDS, devConfig).Return(nil),
+			kmmHelper.EXPECT().SetBuildConfigMapAsDesired(existingBuildCM, devConfig, kmmmodule.NodeOS{}).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
 		)
 
-		err := dcrh.handleNodeMetrics(ctx, devConfig)
+		err := dcrh.handleBuildConfigMap(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Ubuntu nodes, OS BuildConfig is created and stale one deleted", func() {
+		ubuntuOS := kmmmodule.NodeOS{ID: "ubuntu", VersionID: "22.04"}
+		ubuntuBuildCM := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: devConfig.Namespace,
+				Name:      "dockerfile-" + devConfig.Name + "-ubuntu-22.04",
+			},
+		}
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, list *v1.NodeList, _ ...client.ListOption) {
+					list.Items = []v1.Node{
+						{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: "node1",
+								Labels: map[string]string{
+									"feature.node.kubernetes.io/system-os_release.ID":         "ubuntu",
+									"feature.node.kubernetes.io/system-os_release.VERSION_ID": "22.04",
+								},
+							},
+						},
+					}
+				},
+			),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever")),
+			kmmHelper.EXPECT().SetBuildConfigMapAsDesired(gomock.Any(), devConfig, kmmmodule.NodeOS{}).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever")),
+			kmmHelper.EXPECT().SetBuildConfigMapAsDesired(ubuntuBuildCM, devConfig, ubuntuOS).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, list *v1.ConfigMapList, _ ...client.ListOption) {
+					list.Items = []v1.ConfigMap{
+						*ubuntuBuildCM,
+						{
+							ObjectMeta: metav1.ObjectMeta{
+								Namespace: devConfig.Namespace,
+								Name:      "dockerfile-" + devConfig.Name + "-ubuntu-20.04",
+							},
+						},
+					}
+				},
+			),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleBuildConfigMap(ctx, devConfig)
 		Expect(err).ToNot(HaveOccurred())
 	})
+
+	It("failed to list nodes", func() {
+		kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(fmt.Errorf("some error"))
+
+		err := dcrh.handleBuildConfigMap(ctx, devConfig)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("in-tree drivers, BuildConfig is deleted", func() {
+		inTreeDevConfig := devConfig.DeepCopy()
+		inTreeDevConfig.Spec.UseInTreeDrivers = true
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleBuildConfigMap(ctx, inTreeDevConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("user BuildConfig, managed BuildConfigs are deleted", func() {
+		userDevConfig := devConfig.DeepCopy()
+		userDevConfig.Spec.Driver.Build.DockerfileConfigMap = &v1.LocalObjectReference{Name: "my-dockerfile"}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever")),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, list *v1.ConfigMapList, _ ...client.ListOption) {
+					list.Items = []v1.ConfigMap{
+						{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: "dockerfile-" + devConfig.Name + "-ubuntu-22.04"}},
+					}
+				},
+			),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleBuildConfigMap(ctx, userDevConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("user BuildConfig previously managed by the operator is kept", func() {
+		userDevConfig := devConfig.DeepCopy()
+		userDevConfig.Spec.Driver.Build.DockerfileConfigMap = &v1.LocalObjectReference{Name: "dockerfile-" + devConfig.Name}
+
+		kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+			func(_ interface{}, list *v1.ConfigMapList, _ ...client.ListOption) {
+				list.Items = []v1.ConfigMap{
+					{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: "dockerfile-" + devConfig.Name}},
+				}
+			},
+		)
+
+		err := dcrh.handleBuildConfigMap(ctx, userDevConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("prebuilt drivers images, BuildConfig is deleted", func() {
+		prebuiltDevConfig := devConfig.DeepCopy()
+		prebuiltDevConfig.Spec.Driver.Build.Policy = amdv1alpha1.BuildPolicyNever
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleBuildConfigMap(ctx, prebuiltDevConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("in-tree drivers, failed to delete BuildConfig", func() {
+		inTreeDevConfig := devConfig.DeepCopy()
+		inTreeDevConfig.Spec.UseInTreeDrivers = true
+
+		kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(fmt.Errorf("some error"))
+
+		err := dcrh.handleBuildConfigMap(ctx, inTreeDevConfig)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("handleDevicePlugin", func() {
+	var (
+		kubeClient *mock_client.MockClient
+		kmmHelper  *kmmmodule.MockKMMModuleAPI
+		dcrh       deviceConfigReconcilerHelperAPI
+	)
+
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		kmmHelper = kmmmodule.NewMockKMMModuleAPI(ctrl)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, kmmHelper, nil, nil, nil, nil, nil, nil, &record.FakeRecorder{})
+	})
+
+	ctx := context.Background()
+	devConfig := &amdv1alpha1.DeviceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      devConfigName,
+			Namespace: devConfigNamespace,
+		},
+	}
+
+	It("OOT drivers, device plugin DaemonSet is not needed", func() {
+		kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever"))
+
+		err := dcrh.handleDevicePlugin(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("in-tree drivers, device plugin DaemonSet does not exist", func() {
+		inTreeDevConfig := devConfig.DeepCopy()
+		inTreeDevConfig.Spec.UseInTreeDrivers = true
+		newDS := &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-device-plugin"},
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever")),
+			kmmHelper.EXPECT().SetDevicePluginAsDesired(newDS, inTreeDevConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleDevicePlugin(ctx, inTreeDevConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
+
+var _ = Describe("handleUpgrade", func() {
+	var (
+		kubeClient     *mock_client.MockClient
+		statusWriter   *mock_client.MockStatusWriter
+		upgradeHandler *upgrade.MockUpgradeManager
+		recorder       *record.FakeRecorder
+		dcrh           deviceConfigReconcilerHelperAPI
+	)
+
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		statusWriter = mock_client.NewMockStatusWriter(ctrl)
+		upgradeHandler = upgrade.NewMockUpgradeManager(ctrl)
+		recorder = record.NewFakeRecorder(10)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil, upgradeHandler, nil, nil, nil, recorder)
+	})
+
+	ctx := context.Background()
+
+	It("node states changed, status is patched", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace},
+			Status: amdv1alpha1.DeviceConfigStatus{
+				NodeUpgrades: []amdv1alpha1.NodeUpgradeStatus{
+					{NodeName: "node1", State: amdv1alpha1.UpgradeStateDrain, DriversVersion: "v2"},
+					{NodeName: "node2", State: amdv1alpha1.UpgradeStateDone, DriversVersion: "v2"},
+				},
+			},
+		}
+
+		gomock.InOrder(
+			upgradeHandler.EXPECT().HandleUpgrade(ctx, devConfig).Do(
+				func(_ interface{}, devConfig *amdv1alpha1.DeviceConfig) {
+					devConfig.Status.NodeUpgrades[0].State = amdv1alpha1.UpgradeStateModuleReload
+				},
+			).Return(true, nil),
+			kubeClient.EXPECT().Status().Return(statusWriter),
+			statusWriter.EXPECT().Patch(ctx, devConfig, gomock.Any()).Return(nil),
+		)
+
+		inProgress, err := dcrh.handleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(recorder.Events).To(HaveLen(1))
+		Expect(<-recorder.Events).To(ContainSubstring("node1"))
+	})
+
+	It("node states did not change", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace},
+		}
+
+		upgradeHandler.EXPECT().HandleUpgrade(ctx, devConfig).Return(false, nil)
+
+		inProgress, err := dcrh.handleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(recorder.Events).To(BeEmpty())
+	})
+})
+
+var _ = Describe("handlePartitioning", func() {
+	var (
+		kubeClient       *mock_client.MockClient
+		statusWriter     *mock_client.MockStatusWriter
+		partitionHandler *partition.MockPartitioner
+		recorder         *record.FakeRecorder
+		dcrh             deviceConfigReconcilerHelperAPI
+	)
+
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		statusWriter = mock_client.NewMockStatusWriter(ctrl)
+		partitionHandler = partition.NewMockPartitioner(ctrl)
+		recorder = record.NewFakeRecorder(10)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil, nil, nil, nil, partitionHandler, recorder)
+	})
+
+	ctx := context.Background()
+
+	It("no partitioning profile, the partition agent is deleted", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace},
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever")),
+			partitionHandler.EXPECT().HandlePartitioning(ctx, devConfig).Return(false, nil),
+		)
+
+		inProgress, err := dcrh.handlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("node states changed, status is patched", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				Partitioning: &amdv1alpha1.PartitioningSpec{ComputePartition: "CPX"},
+			},
+			Status: amdv1alpha1.DeviceConfigStatus{
+				NodePartitions: []amdv1alpha1.NodePartitionStatus{
+					{NodeName: "node1", State: amdv1alpha1.PartitionStateApply, Profile: "CPX"},
+				},
+			},
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			partitionHandler.EXPECT().SetAgentDaemonSetAsDesired(gomock.Any(), devConfig).Return(nil),
+			partitionHandler.EXPECT().HandlePartitioning(ctx, devConfig).Do(
+				func(_ interface{}, devConfig *amdv1alpha1.DeviceConfig) {
+					devConfig.Status.NodePartitions[0].State = amdv1alpha1.PartitionStateFailed
+				},
+			).Return(false, nil),
+			kubeClient.EXPECT().Status().Return(statusWriter),
+			statusWriter.EXPECT().Patch(ctx, devConfig, gomock.Any()).Return(nil),
+		)
+
+		inProgress, err := dcrh.handlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(recorder.Events).To(HaveLen(1))
+		Expect(<-recorder.Events).To(HavePrefix(v1.EventTypeWarning))
+	})
+})
+
+var _ = Describe("handleNodeLabeller", func() {
+	var (
+		kubeClient         *mock_client.MockClient
+		nodeLabellerHelper *nodelabeller.MockNodeLabeller
+		recorder           *record.FakeRecorder
+		dcrh               deviceConfigReconcilerHelperAPI
+	)
+
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		nodeLabellerHelper = nodelabeller.NewMockNodeLabeller(ctrl)
+		recorder = record.NewFakeRecorder(10)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nodeLabellerHelper, nil, nil, nil, nil, nil, recorder)
+	})
+
+	ctx := context.Background()
+	devConfig := &amdv1alpha1.DeviceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      devConfigName,
+			Namespace: devConfigNamespace,
+		},
+	}
+
+	It("NodeLabeller DaemonSet does not exist", func() {
+		newDS := &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-labeller"},
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever")),
+			nodeLabellerHelper.EXPECT().SetNodeLabellerAsDesired(newDS, devConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleNodeLabeller(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recorder.Events).To(Receive(Equal("Normal Created Created node labeller DaemonSet " + newDS.Name)))
+	})
+
+	It("NodeLabeller DaemonSet exists", func() {
+		existingDS := &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-labeller"},
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, _ interface{}, ds *appsv1.DaemonSet, _ ...client.GetOption) {
+					ds.Name = devConfig.Name + "-node-labeller"
+					ds.Namespace = devConfig.Namespace
+				},
+			),
+			nodeLabellerHelper.EXPECT().SetNodeLabellerAsDesired(existingDS, devConfig).Return(nil),
+		)
+
+		err := dcrh.handleNodeLabeller(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("NodeLabeller is disabled", func() {
+		disabledDevConfig := devConfig.DeepCopy()
+		disabledDevConfig.Spec.NodeLabeller.Enable = pointer.Bool(false)
+
+		kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "whatever"))
+
+		err := dcrh.handleNodeLabeller(ctx, disabledDevConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
+
+var _ = Describe("handleNodeMetrics", func() {
+	var (
+		kubeClient        *mock_client.MockClient
+		nodeMetricsHelper *nodemetrics.MockNodeMetrics
+		dcrh              deviceConfigReconcilerHelperAPI
+	)
+
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		nodeMetricsHelper = nodemetrics.NewMockNodeMetrics(ctrl)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nodeMetricsHelper, nil, nil, nil, nil, &record.FakeRecorder{})
+	})
+
+	ctx := context.Background()
+	devConfig := &amdv1alpha1.DeviceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      devConfigName,
+			Namespace: devConfigNamespace,
+		},
+	}
+	notFound := k8serrors.NewNotFound(schema.GroupResource{}, "whatever")
+
+	It("NodeMetrics DaemonSet, Service and ServiceMonitor do not exist", func() {
+		newDS := &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"},
+		}
+		newSvc := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"},
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(notFound),
+			nodeMetricsHelper.EXPECT().SetNodeMetricsAsDesired(newDS, devConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(notFound),
+			nodeMetricsHelper.EXPECT().SetMetricsServiceAsDesired(newSvc, devConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(notFound),
+			nodeMetricsHelper.EXPECT().SetServiceMonitorAsDesired(gomock.Any(), devConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleNodeMetrics(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("NodeMetrcis DaemonSet exists", func() {
+		existingDS := &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"},
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, _ interface{}, ds *appsv1.DaemonSet, _ ...client.GetOption) {
+					ds.Name = devConfig.Name + "-node-metrics"
+					ds.Namespace = devConfig.Namespace
+				},
+			),
+			nodeMetricsHelper.EXPECT().SetNodeMetricsAsDesired(existingDS, devConfig).Return(nil),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(notFound),
+			nodeMetricsHelper.EXPECT().SetMetricsServiceAsDesired(gomock.Any(), devConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(notFound),
+			nodeMetricsHelper.EXPECT().SetServiceMonitorAsDesired(gomock.Any(), devConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleNodeMetrics(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("kube-rbac-proxy is used, metrics reader ClusterRole is created", func() {
+		proxyDevConfig := devConfig.DeepCopy()
+		proxyDevConfig.Spec.MetricsExporter.RbacProxy = &amdv1alpha1.MetricsRbacProxySpec{}
+		newCR := &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: devConfig.Namespace + "-" + devConfig.Name + "-metrics-reader"},
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(notFound),
+			nodeMetricsHelper.EXPECT().SetNodeMetricsAsDesired(gomock.Any(), proxyDevConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(notFound),
+			nodeMetricsHelper.EXPECT().SetMetricsServiceAsDesired(gomock.Any(), proxyDevConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, types.NamespacedName{Name: newCR.Name}, gomock.Any()).Return(notFound),
+			nodeMetricsHelper.EXPECT().SetMetricsReaderClusterRoleAsDesired(newCR, proxyDevConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(notFound),
+			nodeMetricsHelper.EXPECT().SetServiceMonitorAsDesired(gomock.Any(), proxyDevConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleNodeMetrics(ctx, proxyDevConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("ServiceMonitor CRD is not installed", func() {
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(notFound),
+			nodeMetricsHelper.EXPECT().SetNodeMetricsAsDesired(gomock.Any(), devConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(notFound),
+			nodeMetricsHelper.EXPECT().SetMetricsServiceAsDesired(gomock.Any(), devConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(&meta.NoKindMatchError{}),
+		)
+
+		err := dcrh.handleNodeMetrics(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("failed to reconcile the Service", func() {
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(notFound),
+			nodeMetricsHelper.EXPECT().SetNodeMetricsAsDesired(gomock.Any(), devConfig).Return(nil),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(fmt.Errorf("some error")),
+		)
+
+		err := dcrh.handleNodeMetrics(ctx, devConfig)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("metrics exporter is disabled", func() {
+		disabledDevConfig := devConfig.DeepCopy()
+		disabledDevConfig.Spec.MetricsExporter.Enable = pointer.Bool(false)
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(&meta.NoKindMatchError{}),
+		)
+
+		err := dcrh.handleNodeMetrics(ctx, disabledDevConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
+
+var _ = Describe("handleDeviceConfigStatus", func() {
+	var (
+		kubeClient   *mock_client.MockClient
+		statusWriter *mock_client.MockStatusWriter
+		dcrh         deviceConfigReconcilerHelperAPI
+	)
+
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		statusWriter = mock_client.NewMockStatusWriter(ctrl)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil, nil, nil, nil, nil, &record.FakeRecorder{})
+	})
+
+	ctx := context.Background()
+
+	nn := types.NamespacedName{
+		Name:      devConfigName,
+		Namespace: devConfigNamespace,
+	}
+
+	nodeLabellerNN := types.NamespacedName{
+		Name:      devConfigName + "-node-labeller",
+		Namespace: devConfigNamespace,
+	}
+
+	metricsNN := types.NamespacedName{
+		Name:      devConfigName + "-node-metrics",
+		Namespace: devConfigNamespace,
+	}
+
+	It("good flow", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      devConfigName,
+				Namespace: devConfigNamespace,
+			},
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Do(
+				func(_ interface{}, _ interface{}, mod *kmmv1beta1.Module, _ ...client.GetOption) {
+					mod.Status.ModuleLoader = kmmv1beta1.DaemonSetStatus{
+						NodesMatchingSelectorNumber: 3,
+						DesiredNumber:               3,
+						AvailableNumber:             2,
+					}
+					mod.Status.DevicePlugin = kmmv1beta1.DaemonSetStatus{
+						NodesMatchingSelectorNumber: 3,
+						DesiredNumber:               2,
+						AvailableNumber:             1,
+					}
+				},
+			),
+			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Do(
+				func(_ interface{}, _ interface{}, ds *appsv1.DaemonSet, _ ...client.GetOption) {
+					ds.Status.DesiredNumberScheduled = 2
+					ds.Status.NumberAvailable = 2
+				},
+			),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "dsName")),
+			kubeClient.EXPECT().Status().Return(statusWriter),
+			statusWriter.EXPECT().Patch(ctx, devConfig, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleDeviceConfigStatus(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeProgressing)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeDegraded)).To(BeTrue())
+		Expect(devConfig.Status.Drivers).To(Equal(amdv1alpha1.DeploymentStatus{NodesMatchingSelectorNumber: 3, DesiredNumber: 3, AvailableNumber: 2}))
+		Expect(devConfig.Status.DevicePlugin).To(Equal(amdv1alpha1.DeploymentStatus{NodesMatchingSelectorNumber: 3, DesiredNumber: 2, AvailableNumber: 1}))
+		Expect(devConfig.Status.NodeLabeller).To(Equal(amdv1alpha1.DeploymentStatus{NodesMatchingSelectorNumber: 3, DesiredNumber: 2, AvailableNumber: 2}))
+		Expect(devConfig.Status.NodeMetrics).To(Equal(amdv1alpha1.DeploymentStatus{}))
+	})
+
+	It("in-tree drivers", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      devConfigName,
+				Namespace: devConfigNamespace,
+			},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				UseInTreeDrivers: true,
+			},
+		}
+		devicePluginNN := types.NamespacedName{
+			Name:      devConfigName + "-device-plugin",
+			Namespace: devConfigNamespace,
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Return(k8serrors.NewNotFound(schema.GroupResource{}, "moduleName")),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, list *v1.NodeList, _ ...client.ListOption) {
+					list.Items = []v1.Node{{}, {}}
+				},
+			),
+			kubeClient.EXPECT().Get(ctx, devicePluginNN, gomock.Any()).Do(
+				func(_ interface{}, _ interface{}, ds *appsv1.DaemonSet, _ ...client.GetOption) {
+					ds.Status.DesiredNumberScheduled = 2
+					ds.Status.NumberAvailable = 2
+				},
+			),
+			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Status().Return(statusWriter),
+			statusWriter.EXPECT().Patch(ctx, devConfig, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleDeviceConfigStatus(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(devConfig.Status.Drivers).To(Equal(amdv1alpha1.DeploymentStatus{}))
+		Expect(devConfig.Status.DevicePlugin).To(Equal(amdv1alpha1.DeploymentStatus{NodesMatchingSelectorNumber: 2, DesiredNumber: 2, AvailableNumber: 2}))
+	})
+
+	It("inbox driver blacklisted, reboot pending nodes", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      devConfigName,
+				Namespace: devConfigNamespace,
+			},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				Blacklist: amdv1alpha1.BlacklistSpec{Enable: true},
+			},
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, list *v1.NodeList, _ ...client.ListOption) {
+					list.Items = []v1.Node{
+						{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: "node2",
+								Annotations: map[string]string{
+									"machineconfiguration.openshift.io/currentConfig": "rendered-worker-1",
+									"machineconfiguration.openshift.io/desiredConfig": "rendered-worker-2",
+									"machineconfiguration.openshift.io/state":         "Working",
+								},
+							},
+						},
+						{ObjectMeta: metav1.ObjectMeta{Name: "node3"}},
+					}
+				},
+			),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, list *v1.PodList, _ ...client.ListOption) {
+					list.Items = []v1.Pod{
+						{Spec: v1.PodSpec{NodeName: "node1"}},
+						{
+							Spec: v1.PodSpec{NodeName: "node3"},
+							Status: v1.PodStatus{
+								Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}},
+							},
+						},
+					}
+				},
+			),
+			kubeClient.EXPECT().Status().Return(statusWriter),
+			statusWriter.EXPECT().Patch(ctx, devConfig, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleDeviceConfigStatus(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(devConfig.Status.RebootPendingNodes).To(Equal([]string{"node1", "node2"}))
+	})
+
+	It("prebuilt drivers images, nodes without image are reported", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      devConfigName,
+				Namespace: devConfigNamespace,
+			},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				Driver: amdv1alpha1.DriverSpec{
+					Build: amdv1alpha1.DriverBuildSpec{Policy: amdv1alpha1.BuildPolicyNever},
+				},
+			},
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Do(
+				func(_ interface{}, _ interface{}, mod *kmmv1beta1.Module, _ ...client.GetOption) {
+					mod.Spec.ModuleLoader.Container.KernelMappings = []kmmv1beta1.KernelMapping{{Regexp: "^5\\.14.*$"}}
+				},
+			),
+			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, list *v1.NodeList, _ ...client.ListOption) {
+					list.Items = []v1.Node{
+						newKernelNode("node1", "5.14.0-284.el9.x86_64", true),
+						newKernelNode("node2", "5.14.0-427.el9.x86_64", false),
+						newKernelNode("node3", "6.8.0-45-generic", false),
+					}
+				},
+			),
+			kubeClient.EXPECT().Status().Return(statusWriter),
+			statusWriter.EXPECT().Patch(ctx, devConfig, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleDeviceConfigStatus(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+		cond := meta.FindStatusCondition(devConfig.Status.Conditions, amdv1alpha1.ConditionTypePrebuiltImagesMissing)
+		Expect(cond).ToNot(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal(amdv1alpha1.ReasonPrebuiltImagesMissing))
+		Expect(cond.Message).To(Equal("no kernel mapping matches the kernel of nodes node3; " +
+			"the drivers are not loaded on nodes node2, check that the drivers image of their kernel exists"))
+	})
+
+	It("prebuilt images condition is removed when the drivers are built", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      devConfigName,
+				Namespace: devConfigNamespace,
+			},
+			Status: amdv1alpha1.DeviceConfigStatus{
+				Conditions: []metav1.Condition{{Type: amdv1alpha1.ConditionTypePrebuiltImagesMissing, Status: metav1.ConditionTrue}},
+			},
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Status().Return(statusWriter),
+			statusWriter.EXPECT().Patch(ctx, devConfig, gomock.Any()).Return(nil),
+		)
+
+		err := dcrh.handleDeviceConfigStatus(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(meta.FindStatusCondition(devConfig.Status.Conditions, amdv1alpha1.ConditionTypePrebuiltImagesMissing)).To(BeNil())
+	})
+
+	It("failed to get KMM Module", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      devConfigName,
+				Namespace: devConfigNamespace,
+			},
+		}
+
+		kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Return(fmt.Errorf("some error"))
+
+		err := dcrh.handleDeviceConfigStatus(ctx, devConfig)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("failed to patch status", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      devConfigName,
+				Namespace: devConfigNamespace,
+			},
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, nodeLabellerNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Get(ctx, metricsNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Status().Return(statusWriter),
+			statusWriter.EXPECT().Patch(ctx, devConfig, gomock.Any()).Return(fmt.Errorf("some error")),
+		)
+
+		err := dcrh.handleDeviceConfigStatus(ctx, devConfig)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+func newKernelNode(name, kernel string, driversLoaded bool) v1.Node {
+	node := v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
+		Status:     v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{KernelVersion: kernel}},
+	}
+	if driversLoaded {
+		node.Labels["kmm.node.kubernetes.io/"+devConfigNamespace+"."+devConfigName+".ready"] = ""
+	}
+	return node
+}
+
+var _ = Describe("setPrebuiltImagesCondition", func() {
+	It("the drivers are loaded on all the nodes", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace}}
+		mod := &kmmv1beta1.Module{}
+		mod.Spec.ModuleLoader.Container.KernelMappings = []kmmv1beta1.KernelMapping{{Literal: "6.8.0-45-generic"}}
+
+		setPrebuiltImagesCondition(devConfig, mod, []v1.Node{newKernelNode("node1", "6.8.0-45-generic", true)})
+
+		cond := meta.FindStatusCondition(devConfig.Status.Conditions, amdv1alpha1.ConditionTypePrebuiltImagesMissing)
+		Expect(cond).ToNot(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(amdv1alpha1.ReasonPrebuiltImagesFound))
+	})
+})
+
+var _ = Describe("setDegradedStatus", func() {
+	var (
+		kubeClient   *mock_client.MockClient
+		statusWriter *mock_client.MockStatusWriter
+		recorder     *record.FakeRecorder
+		dcrh         deviceConfigReconcilerHelperAPI
+	)
+
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		statusWriter = mock_client.NewMockStatusWriter(ctrl)
+		recorder = record.NewFakeRecorder(10)
+		dcrh = newDeviceConfigReconcilerHelper(kubeClient, nil, nil, nil, nil, nil, nil, nil, recorder)
+	})
+
+	ctx := context.Background()
+
+	It("sets Degraded with the failing step", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Status().Return(statusWriter),
+			statusWriter.EXPECT().Patch(ctx, devConfig, gomock.Any()).Return(fmt.Errorf("some error")),
+		)
+
+		dcrh.setDegradedStatus(ctx, devConfig, amdv1alpha1.ReasonKMMModuleFailed, fmt.Errorf("handleKMMModule: some error"))
+
+		cond := meta.FindStatusCondition(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeDegraded)
+		Expect(cond).ToNot(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal(amdv1alpha1.ReasonKMMModuleFailed))
+		Expect(cond.Message).To(ContainSubstring("handleKMMModule"))
+		Expect(meta.IsStatusConditionFalse(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeProgressing)).To(BeTrue())
+		Expect(recorder.Events).To(Receive(Equal("Warning KMMModuleFailed handleKMMModule: some error")))
+	})
+})
+
+var _ = Describe("setAvailabilityConditions", func() {
+	It("all operands available", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+		devConfig.Status.Drivers = amdv1alpha1.DeploymentStatus{DesiredNumber: 2, AvailableNumber: 2}
+		devConfig.Status.DevicePlugin = amdv1alpha1.DeploymentStatus{DesiredNumber: 2, AvailableNumber: 2}
+		setCondition(devConfig, amdv1alpha1.ConditionTypeDegraded, metav1.ConditionTrue, amdv1alpha1.ReasonKMMModuleFailed, "some error")
+
+		setAvailabilityConditions(devConfig)
+
+		Expect(meta.IsStatusConditionTrue(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeProgressing)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeDegraded)).To(BeTrue())
+	})
+
+	It("preflight validation failed", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+		devConfig.Status.Drivers = amdv1alpha1.DeploymentStatus{DesiredNumber: 2, AvailableNumber: 2}
+		devConfig.Status.DevicePlugin = amdv1alpha1.DeploymentStatus{DesiredNumber: 2, AvailableNumber: 2}
+		devConfig.Status.Preflight = &amdv1alpha1.PreflightStatus{
+			DriversVersion: "v2",
+			State:          amdv1alpha1.PreflightStateFailed,
+			Kernels: []amdv1alpha1.PreflightKernelStatus{
+				{Kernel: "5.14.0-1", VerificationStatus: kmmv1beta1.VerificationTrue, VerificationStage: kmmv1beta1.VerificationStageDone},
+				{Kernel: "5.14.0-2", VerificationStatus: kmmv1beta1.VerificationFalse, VerificationStage: kmmv1beta1.VerificationStageDone},
+			},
+		}
+
+		setAvailabilityConditions(devConfig)
+
+		cond := meta.FindStatusCondition(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeDegraded)
+		Expect(cond).ToNot(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal(amdv1alpha1.ReasonPreflightFailed))
+		Expect(cond.Message).To(ContainSubstring("v2"))
+		Expect(cond.Message).To(ContainSubstring("5.14.0-2"))
+		Expect(cond.Message).ToNot(ContainSubstring("5.14.0-1"))
+		Expect(meta.IsStatusConditionTrue(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeReady)).To(BeTrue())
+	})
+
+	It("no operand is desired on any node", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+
+		setAvailabilityConditions(devConfig)
+
+		cond := meta.FindStatusCondition(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeReady)
+		Expect(cond).ToNot(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(amdv1alpha1.ReasonNoMatchingNodes))
+	})
+
+	It("drivers loaded, device plugin not deployed yet", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+		devConfig.Status.Drivers = amdv1alpha1.DeploymentStatus{DesiredNumber: 2, AvailableNumber: 2}
+
+		setAvailabilityConditions(devConfig)
+
+		cond := meta.FindStatusCondition(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeReady)
+		Expect(cond).ToNot(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Message).To(ContainSubstring("device-plugin (0/0)"))
+	})
+
+	It("some operands are not available", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+		devConfig.Status.Drivers = amdv1alpha1.DeploymentStatus{DesiredNumber: 2, AvailableNumber: 2}
+		devConfig.Status.NodeMetrics = amdv1alpha1.DeploymentStatus{DesiredNumber: 2, AvailableNumber: 1}
+
+		setAvailabilityConditions(devConfig)
+
+		cond := meta.FindStatusCondition(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeProgressing)
+		Expect(cond).ToNot(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Message).To(ContainSubstring("node-metrics (1/2)"))
+		Expect(meta.IsStatusConditionFalse(devConfig.Status.Conditions, amdv1alpha1.ConditionTypeReady)).To(BeTrue())
+	})
 })
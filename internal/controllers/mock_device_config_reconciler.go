@@ -15,6 +15,8 @@ import (
 	v1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
 	gomock "go.uber.org/mock/gomock"
 	types "k8s.io/apimachinery/pkg/types"
+	client "sigs.k8s.io/controller-runtime/pkg/client"
+	reconcile "sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // MockdeviceConfigReconcilerHelperAPI is a mock of deviceConfigReconcilerHelperAPI interface.
@@ -41,11 +43,12 @@ func (m *MockdeviceConfigReconcilerHelperAPI) EXPECT() *MockdeviceConfigReconcil
 }
 
 // finalizeDeviceConfig mocks base method.
-func (m *MockdeviceConfigReconcilerHelperAPI) finalizeDeviceConfig(ctx context.Context, devConfig *v1alpha1.DeviceConfig) error {
+func (m *MockdeviceConfigReconcilerHelperAPI) finalizeDeviceConfig(ctx context.Context, devConfig *v1alpha1.DeviceConfig) (bool, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "finalizeDeviceConfig", ctx, devConfig)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // finalizeDeviceConfig indicates an expected call of finalizeDeviceConfig.
@@ -54,6 +57,49 @@ func (mr *MockdeviceConfigReconcilerHelperAPIMockRecorder) finalizeDeviceConfig(
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "finalizeDeviceConfig", reflect.TypeOf((*MockdeviceConfigReconcilerHelperAPI)(nil).finalizeDeviceConfig), ctx, devConfig)
 }
 
+// getAllDeviceConfigsRequests mocks base method.
+func (m *MockdeviceConfigReconcilerHelperAPI) getAllDeviceConfigsRequests(ctx context.Context, obj client.Object) []reconcile.Request {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "getAllDeviceConfigsRequests", ctx, obj)
+	ret0, _ := ret[0].([]reconcile.Request)
+	return ret0
+}
+
+// getAllDeviceConfigsRequests indicates an expected call of getAllDeviceConfigsRequests.
+func (mr *MockdeviceConfigReconcilerHelperAPIMockRecorder) getAllDeviceConfigsRequests(ctx, obj any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "getAllDeviceConfigsRequests", reflect.TypeOf((*MockdeviceConfigReconcilerHelperAPI)(nil).getAllDeviceConfigsRequests), ctx, obj)
+}
+
+// getNodeDeviceConfigsRequests mocks base method.
+func (m *MockdeviceConfigReconcilerHelperAPI) getNodeDeviceConfigsRequests(ctx context.Context, oldLabels, newLabels map[string]string) []reconcile.Request {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "getNodeDeviceConfigsRequests", ctx, oldLabels, newLabels)
+	ret0, _ := ret[0].([]reconcile.Request)
+	return ret0
+}
+
+// getNodeDeviceConfigsRequests indicates an expected call of getNodeDeviceConfigsRequests.
+func (mr *MockdeviceConfigReconcilerHelperAPIMockRecorder) getNodeDeviceConfigsRequests(ctx, oldLabels, newLabels any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "getNodeDeviceConfigsRequests", reflect.TypeOf((*MockdeviceConfigReconcilerHelperAPI)(nil).getNodeDeviceConfigsRequests), ctx, oldLabels, newLabels)
+}
+
+// getOverlappingNodes mocks base method.
+func (m *MockdeviceConfigReconcilerHelperAPI) getOverlappingNodes(ctx context.Context, devConfig *v1alpha1.DeviceConfig) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "getOverlappingNodes", ctx, devConfig)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// getOverlappingNodes indicates an expected call of getOverlappingNodes.
+func (mr *MockdeviceConfigReconcilerHelperAPIMockRecorder) getOverlappingNodes(ctx, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "getOverlappingNodes", reflect.TypeOf((*MockdeviceConfigReconcilerHelperAPI)(nil).getOverlappingNodes), ctx, devConfig)
+}
+
 // getRequestedDeviceConfig mocks base method.
 func (m *MockdeviceConfigReconcilerHelperAPI) getRequestedDeviceConfig(ctx context.Context, namespacedName types.NamespacedName) (*v1alpha1.DeviceConfig, error) {
 	m.ctrl.T.Helper()
@@ -69,6 +115,20 @@ func (mr *MockdeviceConfigReconcilerHelperAPIMockRecorder) getRequestedDeviceCon
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "getRequestedDeviceConfig", reflect.TypeOf((*MockdeviceConfigReconcilerHelperAPI)(nil).getRequestedDeviceConfig), ctx, namespacedName)
 }
 
+// handleBlacklist mocks base method.
+func (m *MockdeviceConfigReconcilerHelperAPI) handleBlacklist(ctx context.Context, devConfig *v1alpha1.DeviceConfig) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "handleBlacklist", ctx, devConfig)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// handleBlacklist indicates an expected call of handleBlacklist.
+func (mr *MockdeviceConfigReconcilerHelperAPIMockRecorder) handleBlacklist(ctx, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleBlacklist", reflect.TypeOf((*MockdeviceConfigReconcilerHelperAPI)(nil).handleBlacklist), ctx, devConfig)
+}
+
 // handleBuildConfigMap mocks base method.
 func (m *MockdeviceConfigReconcilerHelperAPI) handleBuildConfigMap(ctx context.Context, devConfig *v1alpha1.DeviceConfig) error {
 	m.ctrl.T.Helper()
@@ -83,6 +143,34 @@ func (mr *MockdeviceConfigReconcilerHelperAPIMockRecorder) handleBuildConfigMap(
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleBuildConfigMap", reflect.TypeOf((*MockdeviceConfigReconcilerHelperAPI)(nil).handleBuildConfigMap), ctx, devConfig)
 }
 
+// handleDeviceConfigStatus mocks base method.
+func (m *MockdeviceConfigReconcilerHelperAPI) handleDeviceConfigStatus(ctx context.Context, devConfig *v1alpha1.DeviceConfig) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "handleDeviceConfigStatus", ctx, devConfig)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// handleDeviceConfigStatus indicates an expected call of handleDeviceConfigStatus.
+func (mr *MockdeviceConfigReconcilerHelperAPIMockRecorder) handleDeviceConfigStatus(ctx, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleDeviceConfigStatus", reflect.TypeOf((*MockdeviceConfigReconcilerHelperAPI)(nil).handleDeviceConfigStatus), ctx, devConfig)
+}
+
+// handleDevicePlugin mocks base method.
+func (m *MockdeviceConfigReconcilerHelperAPI) handleDevicePlugin(ctx context.Context, devConfig *v1alpha1.DeviceConfig) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "handleDevicePlugin", ctx, devConfig)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// handleDevicePlugin indicates an expected call of handleDevicePlugin.
+func (mr *MockdeviceConfigReconcilerHelperAPIMockRecorder) handleDevicePlugin(ctx, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleDevicePlugin", reflect.TypeOf((*MockdeviceConfigReconcilerHelperAPI)(nil).handleDevicePlugin), ctx, devConfig)
+}
+
 // handleKMMModule mocks base method.
 func (m *MockdeviceConfigReconcilerHelperAPI) handleKMMModule(ctx context.Context, devConfig *v1alpha1.DeviceConfig) error {
 	m.ctrl.T.Helper()
@@ -125,6 +213,48 @@ func (mr *MockdeviceConfigReconcilerHelperAPIMockRecorder) handleNodeMetrics(ctx
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleNodeMetrics", reflect.TypeOf((*MockdeviceConfigReconcilerHelperAPI)(nil).handleNodeMetrics), ctx, devConfig)
 }
 
+// handlePartitioning mocks base method.
+func (m *MockdeviceConfigReconcilerHelperAPI) handlePartitioning(ctx context.Context, devConfig *v1alpha1.DeviceConfig) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "handlePartitioning", ctx, devConfig)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// handlePartitioning indicates an expected call of handlePartitioning.
+func (mr *MockdeviceConfigReconcilerHelperAPIMockRecorder) handlePartitioning(ctx, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handlePartitioning", reflect.TypeOf((*MockdeviceConfigReconcilerHelperAPI)(nil).handlePartitioning), ctx, devConfig)
+}
+
+// handleUpgrade mocks base method.
+func (m *MockdeviceConfigReconcilerHelperAPI) handleUpgrade(ctx context.Context, devConfig *v1alpha1.DeviceConfig) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "handleUpgrade", ctx, devConfig)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// handleUpgrade indicates an expected call of handleUpgrade.
+func (mr *MockdeviceConfigReconcilerHelperAPIMockRecorder) handleUpgrade(ctx, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleUpgrade", reflect.TypeOf((*MockdeviceConfigReconcilerHelperAPI)(nil).handleUpgrade), ctx, devConfig)
+}
+
+// setDegradedStatus mocks base method.
+func (m *MockdeviceConfigReconcilerHelperAPI) setDegradedStatus(ctx context.Context, devConfig *v1alpha1.DeviceConfig, reason string, stepErr error) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "setDegradedStatus", ctx, devConfig, reason, stepErr)
+}
+
+// setDegradedStatus indicates an expected call of setDegradedStatus.
+func (mr *MockdeviceConfigReconcilerHelperAPIMockRecorder) setDegradedStatus(ctx, devConfig, reason, stepErr any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "setDegradedStatus", reflect.TypeOf((*MockdeviceConfigReconcilerHelperAPI)(nil).setDegradedStatus), ctx, devConfig, reason, stepErr)
+}
+
 // setFinalizer mocks base method.
 func (m *MockdeviceConfigReconcilerHelperAPI) setFinalizer(ctx context.Context, devConfig *v1alpha1.DeviceConfig) error {
 	m.ctrl.T.Helper()
@@ -17,16 +17,27 @@ limitations under the License.
 package kmmmodule
 
 import (
+	"bytes"
 	_ "embed"
+	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"text/template"
 
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	kmmv1beta1 "github.com/rh-ecosystem-edge/kernel-module-management/api/v1beta1"
 	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/config"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/platform"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/utils"
 )
 
 const (
@@ -36,44 +47,213 @@ const (
 	gpuDriverModuleName            = "amdgpu"
 	imageFirmwarePath              = "firmwareDir/updates"
 	defaultDevicePluginImage       = "rocm/k8s-device-plugin"
-	defaultDriversImageTemplate    = "image-registry.openshift-image-registry.svc:5000/$MOD_NAMESPACE/amd_gpu_kmm_modules:%s-$KERNEL_VERSION"
+	devicePluginConfigVolumeName   = "device-plugin-config"
+	devicePluginConfigPath         = "/etc/amd-gpu-device-plugin"
 	defaultDriversVersion          = "el9-6.1.1"
+	defaultSourcesImageRepo        = "quay.io/yshnaidm/amd_gpu_sources"
+
+	openShiftDriversImageRepo = "image-registry.openshift-image-registry.svc:5000/$MOD_NAMESPACE/amd_gpu_kmm_modules"
+	openShiftBaseImage        = "registry.redhat.io/ubi9/ubi-minimal"
+	kubernetesBuilderImage    = "quay.io/centos/centos:stream9"
+	kubernetesBaseImage       = "quay.io/centos/centos:stream9-minimal"
+
+	nodeOSIDLabel        = "feature.node.kubernetes.io/system-os_release.ID"
+	nodeOSVersionIDLabel = "feature.node.kubernetes.io/system-os_release.VERSION_ID"
+
+	// DockerfileCMLabel is set on the build ConfigMaps managed by the operator, with the name of the DeviceConfig
+	DockerfileCMLabel = "amd.io/dockerfile-deviceconfig"
 )
 
 var (
-	//go:embed dockerfiles/driversDockerfile.txt
-	buildDockerfile string
+	//go:embed dockerfiles/openshiftDriversDockerfile.txt
+	openShiftDockerfileTemplate string
+
+	//go:embed dockerfiles/kubernetesDriversDockerfile.txt
+	kubernetesDockerfileTemplate string
+
+	//go:embed dockerfiles/ubuntuDriversDockerfile.txt
+	ubuntuDockerfileTemplate string
+
+	// osDockerfileTemplates are the build Dockerfile templates of the node OSes that cannot use the
+	// platform default one, keyed on the NFD os_release ID of the nodes
+	osDockerfileTemplates = map[string]string{
+		"ubuntu": ubuntuDockerfileTemplate,
+	}
+
+	// kernel modules built by the default dockerfile, as they are located in the drivers image
+	defaultFilesToSign = []string{
+		"/opt/lib/modules/$KERNEL_VERSION/amd/amdgpu/amdgpu.ko",
+		"/opt/lib/modules/$KERNEL_VERSION/amd/amdkcl/amdkcl.ko",
+		"/opt/lib/modules/$KERNEL_VERSION/amd/amdxcp/amdxcp.ko",
+		"/opt/lib/modules/$KERNEL_VERSION/scheduler/amd-sched.ko",
+		"/opt/lib/modules/$KERNEL_VERSION/ttm/amdttm.ko",
+		"/opt/lib/modules/$KERNEL_VERSION/amddrm_buddy.ko",
+		"/opt/lib/modules/$KERNEL_VERSION/amddrm_ttm_helper.ko",
+	}
 )
 
 //go:generate mockgen -source=kmmmodule.go -package=kmmmodule -destination=mock_kmmmodule.go KMMModuleAPI
 type KMMModuleAPI interface {
-	SetBuildConfigMapAsDesired(buildCM *v1.ConfigMap, devConfig *amdv1alpha1.DeviceConfig) error
-	SetKMMModuleAsDesired(mod *kmmv1beta1.Module, devConfig *amdv1alpha1.DeviceConfig) error
+	SetBuildConfigMapAsDesired(buildCM *v1.ConfigMap, devConfig *amdv1alpha1.DeviceConfig, nodeOS NodeOS) error
+	SetKMMModuleAsDesired(mod *kmmv1beta1.Module, devConfig *amdv1alpha1.DeviceConfig, nodes []v1.Node) error
+	SetDevicePluginAsDesired(ds *appsv1.DaemonSet, devConfig *amdv1alpha1.DeviceConfig) error
+}
+
+// BuildDefaults are the defaults of the drivers build, which depend on the platform the operator runs on
+type BuildDefaults struct {
+	// DriversImageRepo is the repository of the drivers images, when the DeviceConfig does not set one.
+	// There is none on Kubernetes, unless it is set in the configuration
+	DriversImageRepo string
+	// BuilderImage is the image the drivers are compiled in
+	BuilderImage string
+	// BaseImage is the base image of the drivers images
+	BaseImage string
+	// DockerfileTemplate is the template of the build Dockerfile, executed with the BuildDefaults
+	DockerfileTemplate string
+	// SourcesImageRepo is the repository of the drivers sources images, when the DeviceConfig does not set one
+	SourcesImageRepo string
+}
+
+// GetBuildDefaults returns the build defaults of the platform, overridden by the values set in the configuration.
+// On OpenShift the drivers are compiled in the Driver Toolkit image provided by KMM, and pushed to the internal registry
+func GetBuildDefaults(p platform.Platform, cfg config.Drivers) BuildDefaults {
+	defaults := BuildDefaults{
+		DriversImageRepo:   openShiftDriversImageRepo,
+		BaseImage:          openShiftBaseImage,
+		DockerfileTemplate: openShiftDockerfileTemplate,
+		SourcesImageRepo:   defaultSourcesImageRepo,
+	}
+	if p == platform.Kubernetes {
+		defaults = BuildDefaults{
+			BuilderImage:       kubernetesBuilderImage,
+			BaseImage:          kubernetesBaseImage,
+			DockerfileTemplate: kubernetesDockerfileTemplate,
+			SourcesImageRepo:   defaultSourcesImageRepo,
+		}
+	}
+
+	if cfg.ImageRepo != "" {
+		defaults.DriversImageRepo = cfg.ImageRepo
+	}
+	if cfg.BuilderImage != "" {
+		defaults.BuilderImage = cfg.BuilderImage
+	}
+	if cfg.BaseImage != "" {
+		defaults.BaseImage = cfg.BaseImage
+	}
+	if cfg.DockerfileTemplate != "" {
+		defaults.DockerfileTemplate = cfg.DockerfileTemplate
+	}
+	if cfg.SourcesImageRepo != "" {
+		defaults.SourcesImageRepo = cfg.SourcesImageRepo
+	}
+	return defaults
+}
+
+// NodeOS is the operating system of a node, as labelled by NFD
+type NodeOS struct {
+	ID        string
+	VersionID string
+}
+
+// GetNodeOS returns the operating system of the node
+func GetNodeOS(node *v1.Node) NodeOS {
+	return NodeOS{
+		ID:        node.Labels[nodeOSIDLabel],
+		VersionID: node.Labels[nodeOSVersionIDLabel],
+	}
+}
+
+// hasDockerfileTemplate returns true if the OS has its own build Dockerfile template
+func (os NodeOS) hasDockerfileTemplate() bool {
+	_, ok := osDockerfileTemplates[os.ID]
+	return ok && os.VersionID != ""
+}
+
+// GetDockerfileCMName returns the name of the build ConfigMap used for the nodes running nodeOS.
+// The OSes without their own template share the ConfigMap of the platform default template
+func GetDockerfileCMName(devConfig *amdv1alpha1.DeviceConfig, nodeOS NodeOS) string {
+	if !nodeOS.hasDockerfileTemplate() {
+		return "dockerfile-" + devConfig.Name
+	}
+	return fmt.Sprintf("dockerfile-%s-%s-%s", devConfig.Name, nodeOS.ID, nodeOS.VersionID)
 }
 
 type kmmModule struct {
-	client client.Client
-	scheme *runtime.Scheme
+	client        client.Client
+	scheme        *runtime.Scheme
+	buildDefaults BuildDefaults
 }
 
-func NewKMMModule(client client.Client, scheme *runtime.Scheme) KMMModuleAPI {
+func NewKMMModule(client client.Client, scheme *runtime.Scheme, buildDefaults BuildDefaults) KMMModuleAPI {
 	return &kmmModule{
-		client: client,
-		scheme: scheme,
+		client:        client,
+		scheme:        scheme,
+		buildDefaults: buildDefaults,
 	}
 }
 
-func (km *kmmModule) SetBuildConfigMapAsDesired(buildCM *v1.ConfigMap, devConfig *amdv1alpha1.DeviceConfig) error {
+// SetDefaults sets the drivers version and the device plugin image the KMM Module falls back to,
+// so that the defaults are visible in the stored DeviceConfig
+func SetDefaults(devConfig *amdv1alpha1.DeviceConfig) {
+	if !devConfig.Spec.UseInTreeDrivers && devConfig.Spec.DriversVersion == "" {
+		devConfig.Spec.DriversVersion = defaultDriversVersion
+	}
+	if devConfig.Spec.DevicePluginImage == "" {
+		devConfig.Spec.DevicePluginImage = defaultDevicePluginImage
+	}
+}
+
+// SetBuildConfigMapAsDesired sets the build Dockerfile of the nodes running nodeOS
+func (km *kmmModule) SetBuildConfigMapAsDesired(buildCM *v1.ConfigMap, devConfig *amdv1alpha1.DeviceConfig, nodeOS NodeOS) error {
 	if buildCM.Data == nil {
 		buildCM.Data = make(map[string]string)
 	}
+	if buildCM.Labels == nil {
+		buildCM.Labels = make(map[string]string)
+	}
+
+	dockerfileTemplate := km.buildDefaults.DockerfileTemplate
+	if nodeOS.hasDockerfileTemplate() {
+		dockerfileTemplate = osDockerfileTemplates[nodeOS.ID]
+	}
+	dockerfile, err := getDockerfile(dockerfileTemplate, dockerfileData{BuildDefaults: km.buildDefaults, OSVersionID: nodeOS.VersionID})
+	if err != nil {
+		return err
+	}
 
-	buildCM.Data["dockerfile"] = buildDockerfile
+	buildCM.Labels[DockerfileCMLabel] = devConfig.Name
+	buildCM.Data["dockerfile"] = dockerfile
 	return controllerutil.SetControllerReference(devConfig, buildCM, km.scheme)
 }
 
-func (km *kmmModule) SetKMMModuleAsDesired(mod *kmmv1beta1.Module, devConfig *amdv1alpha1.DeviceConfig) error {
-	err := setKMMModuleLoader(mod, devConfig)
+// dockerfileData is the data the build Dockerfile templates are executed with
+type dockerfileData struct {
+	BuildDefaults
+	// OSVersionID is the os_release VERSION_ID of the nodes the drivers are built for
+	OSVersionID string
+}
+
+func getDockerfile(dockerfileTemplate string, data dockerfileData) (string, error) {
+	tmpl, err := template.New("dockerfile").Parse(dockerfileTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the dockerfile template: %v", err)
+	}
+
+	dockerfile := bytes.Buffer{}
+	if err = tmpl.Execute(&dockerfile, data); err != nil {
+		return "", fmt.Errorf("failed to execute the dockerfile template: %v", err)
+	}
+	return dockerfile.String(), nil
+}
+
+// SetKMMModuleAsDesired sets the KMM Module of the DeviceConfig. The nodes selected by the DeviceConfig
+// determine the build Dockerfile of each kernel mapping
+func (km *kmmModule) SetKMMModuleAsDesired(mod *kmmv1beta1.Module, devConfig *amdv1alpha1.DeviceConfig, nodes []v1.Node) error {
+	if devConfig.Spec.UseInTreeDrivers {
+		return fmt.Errorf("KMM Module is not used with in-tree drivers")
+	}
+	err := setKMMModuleLoader(mod, devConfig, km.buildDefaults, nodes)
 	if err != nil {
 		return fmt.Errorf("failed to set KMM Module: %v", err)
 	}
@@ -81,57 +261,296 @@ func (km *kmmModule) SetKMMModuleAsDesired(mod *kmmv1beta1.Module, devConfig *am
 	return controllerutil.SetControllerReference(devConfig, mod, km.scheme)
 }
 
-func setKMMModuleLoader(mod *kmmv1beta1.Module, devConfig *amdv1alpha1.DeviceConfig) error {
-	driversVersion := devConfig.Spec.DriversVersion
-	if driversVersion == "" {
-		driversVersion = defaultDriversVersion
+func setKMMModuleLoader(mod *kmmv1beta1.Module, devConfig *amdv1alpha1.DeviceConfig, buildDefaults BuildDefaults, nodes []v1.Node) error {
+	kernelMappings, err := getKernelMappings(devConfig, buildDefaults, nodes)
+	if err != nil {
+		return err
 	}
 
-	driversImage := devConfig.Spec.DriversImage
-	if driversImage == "" {
-		driversImage = fmt.Sprintf(defaultDriversImageTemplate, driversVersion)
+	sign, err := getSign(devConfig)
+	if err != nil {
+		return err
 	}
 
 	mod.Spec.ModuleLoader.Container = kmmv1beta1.ModuleLoaderContainerSpec{
-		Modprobe: kmmv1beta1.ModprobeSpec{
-			ModuleName:   gpuDriverModuleName,
-			FirmwarePath: imageFirmwarePath,
-		},
-		KernelMappings: []kmmv1beta1.KernelMapping{
-			{
-				Regexp:               "^.+$",
+		Modprobe:       getModprobe(devConfig),
+		KernelMappings: kernelMappings,
+		Sign:           sign,
+	}
+	if devConfig.Spec.UpgradePolicy != nil {
+		// KMM ordered upgrade: the drivers are only loaded on the nodes labelled with this version,
+		// and the nodes are relabelled one by one by the operator
+		mod.Spec.ModuleLoader.Container.Version = devConfig.Spec.DriversVersion
+	}
+	mod.Spec.ModuleLoader.ServiceAccountName = "amd-gpu-operator-kmm-module-loader"
+	mod.Spec.ImageRepoSecret = devConfig.Spec.ImageRepoSecret
+	mod.Spec.Selector = utils.GetNodeSelector(devConfig)
+	return nil
+}
+
+// getModprobe returns the KMM modprobe settings of the amdgpu module
+func getModprobe(devConfig *amdv1alpha1.DeviceConfig) kmmv1beta1.ModprobeSpec {
+	specModprobe := devConfig.Spec.Driver.Modprobe
+	modprobe := kmmv1beta1.ModprobeSpec{
+		ModuleName:   gpuDriverModuleName,
+		FirmwarePath: imageFirmwarePath,
+		Parameters:   specModprobe.Parameters,
+	}
+	if specModprobe.RawArgs != nil {
+		modprobe.RawArgs = &kmmv1beta1.ModprobeArgs{
+			Load:   specModprobe.RawArgs.Load,
+			Unload: specModprobe.RawArgs.Unload,
+		}
+	}
+	// KMM expects the modules from the loaded module down to its first dependency, the reverse of the load order
+	for i := len(specModprobe.LoadOrder) - 1; i >= 0; i-- {
+		modprobe.ModulesLoadingOrder = append(modprobe.ModulesLoadingOrder, specModprobe.LoadOrder[i])
+	}
+	return modprobe
+}
+
+// getKernelMappings translates the DeviceConfig kernel mappings into KMM kernel mappings.
+// If the DeviceConfig does not define any, a single mapping matching all the kernels is returned.
+// Unless the user provides the Dockerfile, the build Dockerfile of a mapping is the one of the OS of the nodes
+// running the kernels it matches. If these nodes run different OSes, a literal mapping is added per kernel before
+// the mapping
+func getKernelMappings(devConfig *amdv1alpha1.DeviceConfig, buildDefaults BuildDefaults, nodes []v1.Node) ([]kmmv1beta1.KernelMapping, error) {
+	specMappings := devConfig.Spec.KernelMappings
+	if len(specMappings) == 0 {
+		specMappings = []amdv1alpha1.KernelMapping{{Regexp: "^.+$"}}
+	}
+
+	sourcesImageRepo := devConfig.Spec.Driver.Build.SourcesImageRepo
+	if sourcesImageRepo == "" {
+		sourcesImageRepo = buildDefaults.SourcesImageRepo
+	}
+
+	// KMM uses the first mapping matching a kernel, so a kernel only affects the first mapping matching it
+	unmatchedKernelsOS := map[string]NodeOS{}
+	for i := range nodes {
+		unmatchedKernelsOS[nodes[i].Status.NodeInfo.KernelVersion] = GetNodeOS(&nodes[i])
+	}
+
+	kernelMappings := make([]kmmv1beta1.KernelMapping, 0, len(specMappings))
+	for i, specMapping := range specMappings {
+		if (specMapping.Regexp == "") == (specMapping.Literal == "") {
+			return nil, fmt.Errorf("kernel mapping %d must define exactly one of regexp and literal", i)
+		}
+
+		kernelRegexp, err := regexp.Compile(specMapping.Regexp)
+		if err != nil {
+			return nil, fmt.Errorf("kernel mapping %d has an invalid regexp: %v", i, err)
+		}
+		kernelsCMName := map[string]string{}
+		cmNames := map[string]bool{}
+		for kernel, nodeOS := range unmatchedKernelsOS {
+			if (specMapping.Literal != "" && kernel == specMapping.Literal) || (specMapping.Regexp != "" && kernelRegexp.MatchString(kernel)) {
+				kernelsCMName[kernel] = GetDockerfileCMName(devConfig, nodeOS)
+				cmNames[kernelsCMName[kernel]] = true
+				delete(unmatchedKernelsOS, kernel)
+			}
+		}
+
+		driversVersion := specMapping.DriversVersion
+		if driversVersion == "" {
+			driversVersion = devConfig.Spec.DriversVersion
+		}
+		if driversVersion == "" {
+			driversVersion = defaultDriversVersion
+		}
+
+		driversImage := specMapping.DriversImage
+		if driversImage == "" {
+			driversImage = devConfig.Spec.DriversImage
+		}
+		if driversImage == "" {
+			// Kubernetes has no registry the drivers images can be pushed to by default
+			if buildDefaults.DriversImageRepo == "" {
+				return nil, errors.New("driversImage must be set, or drivers.imageRepo in the operator configuration, since the platform has no default drivers images repository")
+			}
+			driversImage = fmt.Sprintf("%s:%s-$KERNEL_VERSION", buildDefaults.DriversImageRepo, driversVersion)
+		}
+
+		newKernelMapping := func(regexp, literal string, dockerfileConfigMap *v1.LocalObjectReference) kmmv1beta1.KernelMapping {
+			kernelMapping := kmmv1beta1.KernelMapping{
+				Regexp:               regexp,
+				Literal:              literal,
 				ContainerImage:       driversImage,
 				InTreeModuleToRemove: gpuDriverModuleName,
-				Build: &kmmv1beta1.Build{
-					DockerfileConfigMap: &v1.LocalObjectReference{
-						Name: getDockerfileCMName(devConfig),
-					},
-					BuildArgs: []kmmv1beta1.BuildArg{
-						{
-							Name:  "DRIVERS_VERSION",
-							Value: driversVersion,
-						},
+			}
+			if devConfig.Spec.Driver.Build.Policy != amdv1alpha1.BuildPolicyNever {
+				kernelMapping.Build = getBuild(devConfig, dockerfileConfigMap, driversVersion, sourcesImageRepo)
+			}
+			return kernelMapping
+		}
+
+		dockerfileConfigMap := &v1.LocalObjectReference{
+			Name: GetDockerfileCMName(devConfig, NodeOS{}),
+		}
+		switch {
+		case devConfig.Spec.Driver.Build.Policy == amdv1alpha1.BuildPolicyNever:
+			// nothing is built, the mapping has no Dockerfile
+		case specMapping.DockerfileConfigMap != nil:
+			dockerfileConfigMap = specMapping.DockerfileConfigMap
+		case devConfig.Spec.Driver.Build.DockerfileConfigMap != nil:
+			dockerfileConfigMap = devConfig.Spec.Driver.Build.DockerfileConfigMap
+		case len(cmNames) == 1:
+			for cmName := range cmNames {
+				dockerfileConfigMap.Name = cmName
+			}
+		case len(cmNames) > 1:
+			kernels := make([]string, 0, len(kernelsCMName))
+			for kernel := range kernelsCMName {
+				kernels = append(kernels, kernel)
+			}
+			sort.Strings(kernels)
+			for _, kernel := range kernels {
+				kernelMappings = append(kernelMappings, newKernelMapping("", kernel, &v1.LocalObjectReference{Name: kernelsCMName[kernel]}))
+			}
+		}
+
+		kernelMappings = append(kernelMappings, newKernelMapping(specMapping.Regexp, specMapping.Literal, dockerfileConfigMap))
+	}
+
+	return kernelMappings, nil
+}
+
+// getBuild returns the KMM build of a kernel mapping, with the build settings of the DeviceConfig
+func getBuild(devConfig *amdv1alpha1.DeviceConfig, dockerfileConfigMap *v1.LocalObjectReference, driversVersion, sourcesImageRepo string) *kmmv1beta1.Build {
+	specBuild := devConfig.Spec.Driver.Build
+	build := &kmmv1beta1.Build{
+		DockerfileConfigMap: dockerfileConfigMap,
+		BuildArgs: []kmmv1beta1.BuildArg{
+			{
+				Name:  "DRIVERS_VERSION",
+				Value: driversVersion,
+			},
+			{
+				Name:  "SOURCES_IMAGE_REPO",
+				Value: sourcesImageRepo,
+			},
+		},
+		Secrets: specBuild.Secrets,
+		BaseImageRegistryTLS: kmmv1beta1.TLSOptions{
+			Insecure:              specBuild.BaseImageRegistryTLS.Insecure,
+			InsecureSkipTLSVerify: specBuild.BaseImageRegistryTLS.InsecureSkipTLSVerify,
+		},
+	}
+	for _, arg := range specBuild.ExtraBuildArgs {
+		build.BuildArgs = append(build.BuildArgs, kmmv1beta1.BuildArg{Name: arg.Name, Value: arg.Value})
+	}
+	if specBuild.KanikoParams != nil {
+		build.KanikoParams = &kmmv1beta1.KanikoParams{Tag: specBuild.KanikoParams.Tag}
+	}
+	return build
+}
+
+func getSign(devConfig *amdv1alpha1.DeviceConfig) (*kmmv1beta1.Sign, error) {
+	signing := devConfig.Spec.Signing
+	if signing == nil {
+		return nil, nil
+	}
+
+	if signing.KeySecret == nil || signing.CertSecret == nil {
+		return nil, fmt.Errorf("signing requires both keySecret and certSecret")
+	}
+
+	// KMM only signs the modules it builds, prebuilt drivers images must already be signed
+	if devConfig.Spec.Driver.Build.Policy == amdv1alpha1.BuildPolicyNever {
+		return nil, fmt.Errorf("signing cannot be set when build.policy is Never")
+	}
+
+	filesToSign := signing.FilesToSign
+	if len(filesToSign) == 0 {
+		filesToSign = defaultFilesToSign
+	}
+
+	return &kmmv1beta1.Sign{
+		KeySecret:   signing.KeySecret,
+		CertSecret:  signing.CertSecret,
+		FilesToSign: filesToSign,
+	}, nil
+}
+
+// SetDevicePluginAsDesired sets the device plugin DaemonSet that is deployed by the operator
+// when in-tree drivers are used, and KMM is not deploying the device plugin as part of the Module
+func (km *kmmModule) SetDevicePluginAsDesired(ds *appsv1.DaemonSet, devConfig *amdv1alpha1.DeviceConfig) error {
+	if ds == nil {
+		return fmt.Errorf("daemon set is not initialized, zero pointer")
+	}
+
+	dpSpec := getDevicePluginSpec(devConfig)
+	hostPathDirectory := v1.HostPathDirectory
+	volumes := append(dpSpec.Volumes, v1.Volume{
+		Name: kubeletDevicePluginsVolumeName,
+		VolumeSource: v1.VolumeSource{
+			HostPath: &v1.HostPathVolumeSource{
+				Path: kubeletDevicePluginsPath,
+				Type: &hostPathDirectory,
+			},
+		},
+	})
+	volumeMounts := append(dpSpec.Container.VolumeMounts, v1.VolumeMount{
+		Name:      kubeletDevicePluginsVolumeName,
+		MountPath: kubeletDevicePluginsPath,
+	})
+
+	matchLabels := map[string]string{"daemonset-name": devConfig.Name + "-device-plugin"}
+	ds.Spec = appsv1.DaemonSetSpec{
+		Selector: &metav1.LabelSelector{MatchLabels: matchLabels},
+		Template: v1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: matchLabels,
+			},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{
+					{
+						Name:            "device-plugin",
+						Image:           dpSpec.Container.Image,
+						ImagePullPolicy: dpSpec.Container.ImagePullPolicy,
+						Args:            dpSpec.Container.Args,
+						Env:             dpSpec.Container.Env,
+						Resources:       dpSpec.Container.Resources,
+						SecurityContext: &v1.SecurityContext{Privileged: pointer.Bool(true)},
+						VolumeMounts:    volumeMounts,
 					},
 				},
+				Affinity:           utils.GetAffinity(devConfig),
+				PriorityClassName:  utils.GetPriorityClassName(devConfig),
+				NodeSelector:       utils.GetOperandsNodeSelector(devConfig),
+				ServiceAccountName: dpSpec.ServiceAccountName,
+				Tolerations:        devConfig.Spec.Tolerations,
+				Volumes:            volumes,
 			},
 		},
 	}
-	mod.Spec.ModuleLoader.ServiceAccountName = "amd-gpu-operator-kmm-module-loader"
-	mod.Spec.ImageRepoSecret = devConfig.Spec.ImageRepoSecret
-	mod.Spec.Selector = getNodeSelector(devConfig)
-	return nil
+
+	return controllerutil.SetControllerReference(devConfig, ds, km.scheme)
 }
 
 func setKMMDevicePlugin(mod *kmmv1beta1.Module, devConfig *amdv1alpha1.DeviceConfig) {
+	mod.Spec.DevicePlugin = getDevicePluginSpec(devConfig)
+}
+
+func getDevicePluginSpec(devConfig *amdv1alpha1.DeviceConfig) *kmmv1beta1.DevicePluginSpec {
 	devicePluginImage := devConfig.Spec.DevicePluginImage
 	if devicePluginImage == "" {
 		devicePluginImage = defaultDevicePluginImage
 	}
+	spec := devConfig.Spec.DevicePlugin
+	resources := devConfig.Spec.Resources
+	if spec.Resources != nil {
+		resources = *spec.Resources
+	}
 	hostPathDirectory := v1.HostPathDirectory
-	mod.Spec.DevicePlugin = &kmmv1beta1.DevicePluginSpec{
+	dpSpec := &kmmv1beta1.DevicePluginSpec{
 		ServiceAccountName: "amd-gpu-operator-kmm-device-plugin",
 		Container: kmmv1beta1.DevicePluginContainerSpec{
-			Image: devicePluginImage,
+			Image:           devicePluginImage,
+			ImagePullPolicy: utils.GetImagePullPolicy(devicePluginImage, spec.ImagePullPolicy),
+			Args:            getDevicePluginArgs(spec),
+			Env:             spec.Env,
+			Resources:       resources,
 			VolumeMounts: []v1.VolumeMount{
 				{
 					Name:      "sys",
@@ -151,18 +570,33 @@ func setKMMDevicePlugin(mod *kmmv1beta1.Module, devConfig *amdv1alpha1.DeviceCon
 			},
 		},
 	}
-}
 
-func getDockerfileCMName(devConfig *amdv1alpha1.DeviceConfig) string {
-	return "dockerfile-" + devConfig.Name
+	if spec.ConfigMap != nil {
+		dpSpec.Container.VolumeMounts = append(dpSpec.Container.VolumeMounts, v1.VolumeMount{
+			Name:      devicePluginConfigVolumeName,
+			MountPath: devicePluginConfigPath,
+			ReadOnly:  true,
+		})
+		dpSpec.Volumes = append(dpSpec.Volumes, v1.Volume{
+			Name: devicePluginConfigVolumeName,
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: *spec.ConfigMap},
+			},
+		})
+	}
+
+	return dpSpec
 }
 
-func getNodeSelector(devConfig *amdv1alpha1.DeviceConfig) map[string]string {
-	if devConfig.Spec.Selector != nil {
-		return devConfig.Spec.Selector
+// getDevicePluginArgs returns the device plugin flags of the configured settings, followed by the user arguments.
+// Unset settings are not passed, so that the device plugin defaults apply
+func getDevicePluginArgs(spec amdv1alpha1.DevicePluginSpec) []string {
+	var args []string
+	if spec.ResourceNamingStrategy != "" {
+		args = append(args, "-resource_naming_strategy="+string(spec.ResourceNamingStrategy))
 	}
-
-	ns := make(map[string]string, 0)
-	ns[fmt.Sprintf("feature.node.kubernetes.io/pci-%s.present", amdv1alpha1.AMDPCIVendorID)] = "true"
-	return ns
+	if spec.HealthCheckInterval != nil {
+		args = append(args, fmt.Sprintf("-pulse=%d", *spec.HealthCheckInterval))
+	}
+	return append(args, spec.Args...)
 }
@@ -25,11 +25,123 @@ import (
 	. "github.com/onsi/gomega"
 	kmmv1beta1 "github.com/rh-ecosystem-edge/kernel-module-management/api/v1beta1"
 	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/config"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/platform"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/utils"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
 	"sigs.k8s.io/yaml"
 )
 
+var openShiftBuildDefaults = GetBuildDefaults(platform.OpenShift, config.Drivers{})
+
+var _ = Describe("GetBuildDefaults", func() {
+	It("OpenShift defaults", func() {
+		defaults := GetBuildDefaults(platform.OpenShift, config.Drivers{})
+
+		Expect(defaults.DriversImageRepo).To(Equal("image-registry.openshift-image-registry.svc:5000/$MOD_NAMESPACE/amd_gpu_kmm_modules"))
+		Expect(defaults.BuilderImage).To(BeEmpty())
+		Expect(defaults.BaseImage).To(Equal("registry.redhat.io/ubi9/ubi-minimal"))
+		Expect(defaults.DockerfileTemplate).To(ContainSubstring("FROM ${DTK_AUTO} as builder"))
+		Expect(defaults.SourcesImageRepo).To(Equal("quay.io/yshnaidm/amd_gpu_sources"))
+	})
+
+	It("Kubernetes defaults", func() {
+		defaults := GetBuildDefaults(platform.Kubernetes, config.Drivers{})
+
+		Expect(defaults.DriversImageRepo).To(BeEmpty())
+		Expect(defaults.BuilderImage).To(Equal("quay.io/centos/centos:stream9"))
+		Expect(defaults.BaseImage).To(Equal("quay.io/centos/centos:stream9-minimal"))
+		Expect(defaults.DockerfileTemplate).To(ContainSubstring("FROM {{.BuilderImage}} as builder"))
+	})
+
+	It("configuration overrides", func() {
+		cfg := config.Drivers{
+			ImageRepo:          "registry.example.com/drivers",
+			BuilderImage:       "registry.example.com/builder",
+			BaseImage:          "registry.example.com/base",
+			DockerfileTemplate: "FROM {{.BaseImage}}",
+			SourcesImageRepo:   "registry.example.com/sources",
+		}
+
+		defaults := GetBuildDefaults(platform.Kubernetes, cfg)
+
+		Expect(defaults).To(Equal(BuildDefaults{
+			DriversImageRepo:   "registry.example.com/drivers",
+			BuilderImage:       "registry.example.com/builder",
+			BaseImage:          "registry.example.com/base",
+			DockerfileTemplate: "FROM {{.BaseImage}}",
+			SourcesImageRepo:   "registry.example.com/sources",
+		}))
+	})
+})
+
+var _ = Describe("SetBuildConfigMapAsDesired", func() {
+	devConfig := amdv1alpha1.DeviceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "devConfigName",
+			Namespace: "devConfigNamespace",
+		},
+	}
+
+	It("OpenShift dockerfile", func() {
+		km := NewKMMModule(nil, scheme, openShiftBuildDefaults)
+		buildCM := v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: "dockerfile-" + devConfig.Name}}
+
+		err := km.SetBuildConfigMapAsDesired(&buildCM, &devConfig, NodeOS{})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buildCM.Data["dockerfile"]).To(ContainSubstring("FROM ${DTK_AUTO} as builder"))
+		Expect(buildCM.Data["dockerfile"]).To(ContainSubstring("FROM registry.redhat.io/ubi9/ubi-minimal\n"))
+		Expect(buildCM.Data["dockerfile"]).To(ContainSubstring("FROM ${SOURCES_IMAGE_REPO}:${DRIVERS_VERSION} as sources"))
+	})
+
+	It("Kubernetes dockerfile", func() {
+		km := NewKMMModule(nil, scheme, GetBuildDefaults(platform.Kubernetes, config.Drivers{}))
+		buildCM := v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: "dockerfile-" + devConfig.Name}}
+
+		err := km.SetBuildConfigMapAsDesired(&buildCM, &devConfig, NodeOS{})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buildCM.Data["dockerfile"]).To(ContainSubstring("FROM quay.io/centos/centos:stream9 as builder"))
+		Expect(buildCM.Data["dockerfile"]).To(ContainSubstring("FROM quay.io/centos/centos:stream9-minimal\n"))
+	})
+
+	It("Ubuntu dockerfile", func() {
+		km := NewKMMModule(nil, scheme, openShiftBuildDefaults)
+		buildCM := v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: "dockerfile-" + devConfig.Name + "-ubuntu-22.04"}}
+
+		err := km.SetBuildConfigMapAsDesired(&buildCM, &devConfig, NodeOS{ID: "ubuntu", VersionID: "22.04"})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buildCM.Labels).To(HaveKeyWithValue(DockerfileCMLabel, devConfig.Name))
+		Expect(buildCM.Data["dockerfile"]).To(ContainSubstring("FROM ubuntu:22.04 as builder"))
+		Expect(buildCM.Data["dockerfile"]).To(ContainSubstring("linux-headers-${KERNEL_VERSION}"))
+	})
+
+	It("OS without its own dockerfile uses the platform one", func() {
+		km := NewKMMModule(nil, scheme, openShiftBuildDefaults)
+		buildCM := v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: "dockerfile-" + devConfig.Name}}
+
+		err := km.SetBuildConfigMapAsDesired(&buildCM, &devConfig, NodeOS{ID: "rhcos", VersionID: "4.15"})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buildCM.Data["dockerfile"]).To(ContainSubstring("FROM ${DTK_AUTO} as builder"))
+	})
+
+	It("invalid dockerfile template", func() {
+		km := NewKMMModule(nil, scheme, BuildDefaults{DockerfileTemplate: "FROM {{.BaseImage"})
+		buildCM := v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: "dockerfile-" + devConfig.Name}}
+
+		err := km.SetBuildConfigMapAsDesired(&buildCM, &devConfig, NodeOS{})
+
+		Expect(err).To(HaveOccurred())
+	})
+})
+
 var _ = Describe("setKMMModuleLoader", func() {
 	It("KMM module creation - default input values", func() {
 		mod := kmmv1beta1.Module{
@@ -55,12 +167,12 @@ var _ = Describe("setKMMModuleLoader", func() {
 		fmt.Printf("<%s>\n", expectedMod.Spec.ModuleLoader.Container.Modprobe.ModuleName)
 		Expect(len(expectedMod.Spec.ModuleLoader.Container.KernelMappings)).To(Equal(1))
 
-		expectedMod.Spec.ModuleLoader.Container.KernelMappings[0].ContainerImage = fmt.Sprintf(defaultDriversImageTemplate, defaultDriversVersion)
+		expectedMod.Spec.ModuleLoader.Container.KernelMappings[0].ContainerImage = "image-registry.openshift-image-registry.svc:5000/$MOD_NAMESPACE/amd_gpu_kmm_modules:" + defaultDriversVersion + "-$KERNEL_VERSION"
 		expectedMod.Spec.ModuleLoader.Container.KernelMappings[0].Build.DockerfileConfigMap.Name = "dockerfile-" + input.Name
 		expectedMod.Spec.ModuleLoader.Container.KernelMappings[0].Build.BuildArgs[0].Value = defaultDriversVersion
 		expectedMod.Spec.Selector = map[string]string{"feature.node.kubernetes.io/pci-1002.present": "true"}
 
-		err = setKMMModuleLoader(&mod, &input)
+		err = setKMMModuleLoader(&mod, &input, openShiftBuildDefaults, nil)
 
 		Expect(err).To(BeNil())
 		Expect(mod).To(Equal(expectedMod))
@@ -84,6 +196,9 @@ var _ = Describe("setKMMModuleLoader", func() {
 				DriversVersion:   "some driver version",
 				Selector:         map[string]string{"some label": "some label value"},
 				ImageRepoSecret:  &v1.LocalObjectReference{Name: "image repo secret name"},
+				Driver: amdv1alpha1.DriverSpec{
+					Build: amdv1alpha1.DriverBuildSpec{SourcesImageRepo: "registry.example.com/sources"},
+				},
 			},
 		}
 
@@ -101,14 +216,429 @@ var _ = Describe("setKMMModuleLoader", func() {
 		expectedMod.Spec.ModuleLoader.Container.KernelMappings[0].ContainerImage = "some driver image"
 		expectedMod.Spec.ModuleLoader.Container.KernelMappings[0].Build.DockerfileConfigMap.Name = "dockerfile-" + input.Name
 		expectedMod.Spec.ModuleLoader.Container.KernelMappings[0].Build.BuildArgs[0].Value = "some driver version"
+		expectedMod.Spec.ModuleLoader.Container.KernelMappings[0].Build.BuildArgs[1].Value = "registry.example.com/sources"
 		expectedMod.Spec.Selector = map[string]string{"some label": "some label value"}
 		expectedMod.Spec.ImageRepoSecret = &v1.LocalObjectReference{Name: "image repo secret name"}
 
-		err = setKMMModuleLoader(&mod, &input)
+		err = setKMMModuleLoader(&mod, &input, openShiftBuildDefaults, nil)
 
 		Expect(err).To(BeNil())
 		Expect(mod).To(Equal(expectedMod))
 	})
+
+	It("KMM module creation - upgrade policy", func() {
+		mod := kmmv1beta1.Module{}
+		input := amdv1alpha1.DeviceConfig{
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				DriversVersion: "some driver version",
+				UpgradePolicy:  &amdv1alpha1.UpgradePolicySpec{},
+			},
+		}
+
+		err := setKMMModuleLoader(&mod, &input, openShiftBuildDefaults, nil)
+
+		Expect(err).To(BeNil())
+		Expect(mod.Spec.ModuleLoader.Container.Version).To(Equal("some driver version"))
+	})
+})
+
+var _ = Describe("getKernelMappings", func() {
+	It("per kernel mappings", func() {
+		input := amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "devConfigName",
+			},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				DriversVersion: "default driver version",
+				KernelMappings: []amdv1alpha1.KernelMapping{
+					{
+						Regexp:         "^5\\.14\\.0-284.*$",
+						DriversVersion: "el9.2 driver version",
+					},
+					{
+						Literal:             "5.15.0-94-generic",
+						DriversImage:        "ubuntu driver image",
+						DockerfileConfigMap: &v1.LocalObjectReference{Name: "ubuntu dockerfile"},
+					},
+				},
+			},
+		}
+
+		kernelMappings, err := getKernelMappings(&input, openShiftBuildDefaults, nil)
+		Expect(err).To(BeNil())
+		Expect(kernelMappings).To(Equal([]kmmv1beta1.KernelMapping{
+			{
+				Regexp:               "^5\\.14\\.0-284.*$",
+				ContainerImage:       "image-registry.openshift-image-registry.svc:5000/$MOD_NAMESPACE/amd_gpu_kmm_modules:el9.2 driver version-$KERNEL_VERSION",
+				InTreeModuleToRemove: "amdgpu",
+				Build: &kmmv1beta1.Build{
+					DockerfileConfigMap: &v1.LocalObjectReference{Name: "dockerfile-devConfigName"},
+					BuildArgs: []kmmv1beta1.BuildArg{
+						{Name: "DRIVERS_VERSION", Value: "el9.2 driver version"},
+						{Name: "SOURCES_IMAGE_REPO", Value: "quay.io/yshnaidm/amd_gpu_sources"},
+					},
+				},
+			},
+			{
+				Literal:              "5.15.0-94-generic",
+				ContainerImage:       "ubuntu driver image",
+				InTreeModuleToRemove: "amdgpu",
+				Build: &kmmv1beta1.Build{
+					DockerfileConfigMap: &v1.LocalObjectReference{Name: "ubuntu dockerfile"},
+					BuildArgs: []kmmv1beta1.BuildArg{
+						{Name: "DRIVERS_VERSION", Value: "default driver version"},
+						{Name: "SOURCES_IMAGE_REPO", Value: "quay.io/yshnaidm/amd_gpu_sources"},
+					},
+				},
+			},
+		}))
+	})
+
+	It("nodes running a single OS use its dockerfile", func() {
+		input := amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "devConfigName",
+			},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				DriversVersion: "driver version",
+			},
+		}
+		nodes := []v1.Node{
+			newOSNode("5.15.0-94-generic", "ubuntu", "22.04"),
+			newOSNode("5.15.0-95-generic", "ubuntu", "22.04"),
+		}
+
+		kernelMappings, err := getKernelMappings(&input, openShiftBuildDefaults, nodes)
+		Expect(err).To(BeNil())
+		Expect(kernelMappings).To(HaveLen(1))
+		Expect(kernelMappings[0].Regexp).To(Equal("^.+$"))
+		Expect(kernelMappings[0].Build.DockerfileConfigMap.Name).To(Equal("dockerfile-devConfigName-ubuntu-22.04"))
+	})
+
+	It("nodes running different OSes get a mapping per kernel", func() {
+		input := amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "devConfigName",
+			},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				DriversVersion: "driver version",
+			},
+		}
+		nodes := []v1.Node{
+			newOSNode("6.8.0-45-generic", "ubuntu", "24.04"),
+			newOSNode("5.14.0-284.11.1.el9_2.x86_64", "rhcos", "4.15"),
+			newOSNode("5.15.0-94-generic", "ubuntu", "22.04"),
+		}
+
+		kernelMappings, err := getKernelMappings(&input, openShiftBuildDefaults, nodes)
+		Expect(err).To(BeNil())
+		Expect(kernelMappings).To(HaveLen(4))
+		Expect(kernelMappings[0].Literal).To(Equal("5.14.0-284.11.1.el9_2.x86_64"))
+		Expect(kernelMappings[0].Build.DockerfileConfigMap.Name).To(Equal("dockerfile-devConfigName"))
+		Expect(kernelMappings[1].Literal).To(Equal("5.15.0-94-generic"))
+		Expect(kernelMappings[1].Build.DockerfileConfigMap.Name).To(Equal("dockerfile-devConfigName-ubuntu-22.04"))
+		Expect(kernelMappings[2].Literal).To(Equal("6.8.0-45-generic"))
+		Expect(kernelMappings[2].Build.DockerfileConfigMap.Name).To(Equal("dockerfile-devConfigName-ubuntu-24.04"))
+		Expect(kernelMappings[3].Regexp).To(Equal("^.+$"))
+		Expect(kernelMappings[3].Build.DockerfileConfigMap.Name).To(Equal("dockerfile-devConfigName"))
+	})
+
+	It("user dockerfile is used for all the OSes", func() {
+		input := amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "devConfigName",
+			},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				DriversVersion: "driver version",
+				KernelMappings: []amdv1alpha1.KernelMapping{
+					{Regexp: "^6\\..*$"},
+					{
+						Regexp:              "^5\\..*$",
+						DockerfileConfigMap: &v1.LocalObjectReference{Name: "mapping dockerfile"},
+					},
+				},
+				Driver: amdv1alpha1.DriverSpec{
+					Build: amdv1alpha1.DriverBuildSpec{
+						DockerfileConfigMap: &v1.LocalObjectReference{Name: "user dockerfile"},
+					},
+				},
+			},
+		}
+		nodes := []v1.Node{
+			newOSNode("6.8.0-45-generic", "ubuntu", "24.04"),
+			newOSNode("6.1.0-18-amd64", "debian", "12"),
+			newOSNode("5.15.0-94-generic", "ubuntu", "22.04"),
+		}
+
+		kernelMappings, err := getKernelMappings(&input, openShiftBuildDefaults, nodes)
+		Expect(err).To(BeNil())
+		Expect(kernelMappings).To(HaveLen(2))
+		Expect(kernelMappings[0].Build.DockerfileConfigMap.Name).To(Equal("user dockerfile"))
+		Expect(kernelMappings[1].Build.DockerfileConfigMap.Name).To(Equal("mapping dockerfile"))
+	})
+
+	It("prebuilt drivers images are not built", func() {
+		input := amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "devConfigName",
+			},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				DriversImage: "registry.example.com/drivers:$KERNEL_VERSION",
+				Driver: amdv1alpha1.DriverSpec{
+					Build: amdv1alpha1.DriverBuildSpec{Policy: amdv1alpha1.BuildPolicyNever},
+				},
+			},
+		}
+		nodes := []v1.Node{
+			newOSNode("6.8.0-45-generic", "ubuntu", "24.04"),
+			newOSNode("5.14.0-284.11.1.el9_2.x86_64", "rhcos", "4.15"),
+		}
+
+		kernelMappings, err := getKernelMappings(&input, openShiftBuildDefaults, nodes)
+		Expect(err).To(BeNil())
+		Expect(kernelMappings).To(Equal([]kmmv1beta1.KernelMapping{
+			{
+				Regexp:               "^.+$",
+				ContainerImage:       "registry.example.com/drivers:$KERNEL_VERSION",
+				InTreeModuleToRemove: "amdgpu",
+			},
+		}))
+	})
+
+	It("no drivers image and no default drivers images repository", func() {
+		input := amdv1alpha1.DeviceConfig{}
+
+		_, err := getKernelMappings(&input, GetBuildDefaults(platform.Kubernetes, config.Drivers{}), nil)
+		Expect(err).To(HaveOccurred())
+
+		input.Spec.DriversImage = "registry.example.com/drivers:$KERNEL_VERSION"
+		_, err = getKernelMappings(&input, GetBuildDefaults(platform.Kubernetes, config.Drivers{}), nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("kernel mapping without regexp and literal", func() {
+		input := amdv1alpha1.DeviceConfig{
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				KernelMappings: []amdv1alpha1.KernelMapping{{DriversVersion: "some driver version"}},
+			},
+		}
+
+		_, err := getKernelMappings(&input, openShiftBuildDefaults, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("kernel mapping with both regexp and literal", func() {
+		input := amdv1alpha1.DeviceConfig{
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				KernelMappings: []amdv1alpha1.KernelMapping{{Regexp: "^.+$", Literal: "5.15.0-94-generic"}},
+			},
+		}
+
+		_, err := getKernelMappings(&input, openShiftBuildDefaults, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("getModprobe", func() {
+	It("default modprobe", func() {
+		modprobe := getModprobe(&amdv1alpha1.DeviceConfig{})
+
+		Expect(modprobe).To(Equal(kmmv1beta1.ModprobeSpec{
+			ModuleName:   "amdgpu",
+			FirmwarePath: "firmwareDir/updates",
+		}))
+	})
+
+	It("user parameters and load order", func() {
+		input := amdv1alpha1.DeviceConfig{
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				Driver: amdv1alpha1.DriverSpec{
+					Modprobe: amdv1alpha1.ModprobeSpec{
+						Parameters: []string{"sched_policy=1", "noretry=0"},
+						LoadOrder:  []string{"amdkcl", "amdxcp", "amd-sched", "amdttm", "amdgpu"},
+					},
+				},
+			},
+		}
+
+		modprobe := getModprobe(&input)
+
+		Expect(modprobe).To(Equal(kmmv1beta1.ModprobeSpec{
+			ModuleName:          "amdgpu",
+			FirmwarePath:        "firmwareDir/updates",
+			Parameters:          []string{"sched_policy=1", "noretry=0"},
+			ModulesLoadingOrder: []string{"amdgpu", "amdttm", "amd-sched", "amdxcp", "amdkcl"},
+		}))
+	})
+
+	It("user raw args", func() {
+		input := amdv1alpha1.DeviceConfig{
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				Driver: amdv1alpha1.DriverSpec{
+					Modprobe: amdv1alpha1.ModprobeSpec{
+						RawArgs: &amdv1alpha1.ModprobeArgs{
+							Load:   []string{"-v", "amdgpu", "ras_enable=0"},
+							Unload: []string{"-r", "amdgpu"},
+						},
+					},
+				},
+			},
+		}
+
+		modprobe := getModprobe(&input)
+
+		Expect(modprobe.RawArgs).To(Equal(&kmmv1beta1.ModprobeArgs{
+			Load:   []string{"-v", "amdgpu", "ras_enable=0"},
+			Unload: []string{"-r", "amdgpu"},
+		}))
+	})
+})
+
+var _ = Describe("getBuild", func() {
+	dockerfileConfigMap := &v1.LocalObjectReference{Name: "dockerfile"}
+
+	It("default build", func() {
+		build := getBuild(&amdv1alpha1.DeviceConfig{}, dockerfileConfigMap, "driver version", "sources repo")
+
+		Expect(build).To(Equal(&kmmv1beta1.Build{
+			DockerfileConfigMap: dockerfileConfigMap,
+			BuildArgs: []kmmv1beta1.BuildArg{
+				{Name: "DRIVERS_VERSION", Value: "driver version"},
+				{Name: "SOURCES_IMAGE_REPO", Value: "sources repo"},
+			},
+		}))
+	})
+
+	It("user build settings", func() {
+		input := amdv1alpha1.DeviceConfig{
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				Driver: amdv1alpha1.DriverSpec{
+					Build: amdv1alpha1.DriverBuildSpec{
+						Secrets:              []v1.LocalObjectReference{{Name: "sources token"}},
+						BaseImageRegistryTLS: amdv1alpha1.RegistryTLS{Insecure: true, InsecureSkipTLSVerify: true},
+						KanikoParams:         &amdv1alpha1.KanikoParams{Tag: "v1.23.0"},
+						ExtraBuildArgs:       []amdv1alpha1.BuildArg{{Name: "HTTP_PROXY", Value: "http://proxy:3128"}},
+					},
+				},
+			},
+		}
+
+		build := getBuild(&input, dockerfileConfigMap, "driver version", "sources repo")
+
+		Expect(build).To(Equal(&kmmv1beta1.Build{
+			DockerfileConfigMap: dockerfileConfigMap,
+			BuildArgs: []kmmv1beta1.BuildArg{
+				{Name: "DRIVERS_VERSION", Value: "driver version"},
+				{Name: "SOURCES_IMAGE_REPO", Value: "sources repo"},
+				{Name: "HTTP_PROXY", Value: "http://proxy:3128"},
+			},
+			Secrets:              []v1.LocalObjectReference{{Name: "sources token"}},
+			BaseImageRegistryTLS: kmmv1beta1.TLSOptions{Insecure: true, InsecureSkipTLSVerify: true},
+			KanikoParams:         &kmmv1beta1.KanikoParams{Tag: "v1.23.0"},
+		}))
+	})
+})
+
+var _ = Describe("GetDockerfileCMName", func() {
+	devConfig := amdv1alpha1.DeviceConfig{ObjectMeta: metav1.ObjectMeta{Name: "devConfigName"}}
+
+	It("OS with its own dockerfile", func() {
+		Expect(GetDockerfileCMName(&devConfig, NodeOS{ID: "ubuntu", VersionID: "24.04"})).To(Equal("dockerfile-devConfigName-ubuntu-24.04"))
+	})
+
+	It("OS without its own dockerfile", func() {
+		Expect(GetDockerfileCMName(&devConfig, NodeOS{ID: "rhcos", VersionID: "4.15"})).To(Equal("dockerfile-devConfigName"))
+		Expect(GetDockerfileCMName(&devConfig, NodeOS{ID: "ubuntu"})).To(Equal("dockerfile-devConfigName"))
+	})
+})
+
+func newOSNode(kernelVersion, osID, osVersionID string) v1.Node {
+	return v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				"feature.node.kubernetes.io/system-os_release.ID":         osID,
+				"feature.node.kubernetes.io/system-os_release.VERSION_ID": osVersionID,
+			},
+		},
+		Status: v1.NodeStatus{
+			NodeInfo: v1.NodeSystemInfo{KernelVersion: kernelVersion},
+		},
+	}
+}
+
+var _ = Describe("getSign", func() {
+	It("signing is not requested", func() {
+		sign, err := getSign(&amdv1alpha1.DeviceConfig{})
+		Expect(err).To(BeNil())
+		Expect(sign).To(BeNil())
+	})
+
+	It("default files to sign", func() {
+		input := amdv1alpha1.DeviceConfig{
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				Signing: &amdv1alpha1.ModuleSigning{
+					KeySecret:  &v1.LocalObjectReference{Name: "key secret"},
+					CertSecret: &v1.LocalObjectReference{Name: "cert secret"},
+				},
+			},
+		}
+
+		sign, err := getSign(&input)
+		Expect(err).To(BeNil())
+		Expect(sign.KeySecret.Name).To(Equal("key secret"))
+		Expect(sign.CertSecret.Name).To(Equal("cert secret"))
+		Expect(sign.FilesToSign).To(HaveLen(7))
+		Expect(sign.FilesToSign).To(ContainElement("/opt/lib/modules/$KERNEL_VERSION/amd/amdgpu/amdgpu.ko"))
+	})
+
+	It("user files to sign", func() {
+		input := amdv1alpha1.DeviceConfig{
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				Signing: &amdv1alpha1.ModuleSigning{
+					KeySecret:   &v1.LocalObjectReference{Name: "key secret"},
+					CertSecret:  &v1.LocalObjectReference{Name: "cert secret"},
+					FilesToSign: []string{"some file"},
+				},
+			},
+		}
+
+		sign, err := getSign(&input)
+		Expect(err).To(BeNil())
+		Expect(sign.FilesToSign).To(Equal([]string{"some file"}))
+	})
+
+	It("missing cert secret", func() {
+		input := amdv1alpha1.DeviceConfig{
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				Signing: &amdv1alpha1.ModuleSigning{
+					KeySecret: &v1.LocalObjectReference{Name: "key secret"},
+				},
+			},
+		}
+
+		_, err := getSign(&input)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("signing with prebuilt drivers images", func() {
+		km := NewKMMModule(nil, scheme, openShiftBuildDefaults)
+		mod := kmmv1beta1.Module{}
+		input := amdv1alpha1.DeviceConfig{
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				DriversImage: "registry.example.com/drivers:$KERNEL_VERSION",
+				Driver: amdv1alpha1.DriverSpec{
+					Build: amdv1alpha1.DriverBuildSpec{Policy: amdv1alpha1.BuildPolicyNever},
+				},
+				Signing: &amdv1alpha1.ModuleSigning{
+					KeySecret:  &v1.LocalObjectReference{Name: "key secret"},
+					CertSecret: &v1.LocalObjectReference{Name: "cert secret"},
+				},
+			},
+		}
+
+		err := km.SetKMMModuleAsDesired(&mod, &input, nil)
+		Expect(err).To(HaveOccurred())
+	})
 })
 
 var _ = Describe("setKMMDevicePlugin", func() {
@@ -171,4 +701,132 @@ var _ = Describe("setKMMDevicePlugin", func() {
 
 		Expect(mod).To(Equal(expectedMod))
 	})
+
+	It("KMM module creation - device plugin configuration", func() {
+		mod := kmmv1beta1.Module{}
+		resources := v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("128Mi")}}
+		input := amdv1alpha1.DeviceConfig{
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				DevicePluginImage: "rocm/k8s-device-plugin:1.31.0.2",
+				DevicePlugin: amdv1alpha1.DevicePluginSpec{
+					ResourceNamingStrategy: amdv1alpha1.ResourceNamingStrategyMixed,
+					HealthCheckInterval:    pointer.Int32(0),
+					ConfigMap:              &v1.LocalObjectReference{Name: "dp-config"},
+					Args:                   []string{"-driver_type=container"},
+					Env:                    []v1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}},
+					Resources:              &resources,
+				},
+			},
+		}
+
+		setKMMDevicePlugin(&mod, &input)
+
+		container := mod.Spec.DevicePlugin.Container
+		Expect(container.ImagePullPolicy).To(Equal(v1.PullIfNotPresent))
+		Expect(container.Args).To(Equal([]string{"-resource_naming_strategy=mixed", "-pulse=0", "-driver_type=container"}))
+		Expect(container.Env).To(Equal(input.Spec.DevicePlugin.Env))
+		Expect(container.Resources).To(Equal(resources))
+		Expect(container.VolumeMounts).To(ContainElement(v1.VolumeMount{
+			Name:      devicePluginConfigVolumeName,
+			MountPath: devicePluginConfigPath,
+			ReadOnly:  true,
+		}))
+		Expect(mod.Spec.DevicePlugin.Volumes).To(ContainElement(v1.Volume{
+			Name: devicePluginConfigVolumeName,
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "dp-config"}},
+			},
+		}))
+	})
+})
+
+var _ = Describe("SetKMMModuleAsDesired", func() {
+	It("in-tree drivers", func() {
+		km := NewKMMModule(nil, scheme, openShiftBuildDefaults)
+		mod := kmmv1beta1.Module{}
+		input := amdv1alpha1.DeviceConfig{
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				UseInTreeDrivers: true,
+			},
+		}
+
+		err := km.SetKMMModuleAsDesired(&mod, &input, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("SetDevicePluginAsDesired", func() {
+	It("in-tree drivers device plugin DaemonSet", func() {
+		km := NewKMMModule(nil, scheme, openShiftBuildDefaults)
+		ds := appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "moduleName-device-plugin",
+				Namespace: "moduleNamespace",
+			},
+		}
+		input := amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "moduleName",
+				Namespace: "moduleNamespace",
+			},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				UseInTreeDrivers:  true,
+				DevicePluginImage: "some device plugin image",
+				Selector:          map[string]string{"some label": "some label value"},
+			},
+		}
+
+		err := km.SetDevicePluginAsDesired(&ds, &input)
+		Expect(err).To(BeNil())
+
+		podSpec := ds.Spec.Template.Spec
+		Expect(podSpec.NodeSelector).To(Equal(map[string]string{
+			"some label":                  "some label value",
+			utils.InTreeModuleLoadedLabel: "true",
+		}))
+		Expect(podSpec.ServiceAccountName).To(Equal("amd-gpu-operator-kmm-device-plugin"))
+		Expect(podSpec.Containers).To(HaveLen(1))
+		Expect(podSpec.Containers[0].Image).To(Equal("some device plugin image"))
+		Expect(podSpec.Containers[0].VolumeMounts).To(ContainElement(v1.VolumeMount{Name: kubeletDevicePluginsVolumeName, MountPath: kubeletDevicePluginsPath}))
+		Expect(podSpec.PriorityClassName).To(Equal("system-node-critical"))
+		Expect(ds.OwnerReferences).To(HaveLen(1))
+	})
+
+	It("scheduling values", func() {
+		km := NewKMMModule(nil, scheme, openShiftBuildDefaults)
+		ds := appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "moduleName-device-plugin",
+				Namespace: "moduleNamespace",
+			},
+		}
+		tolerations := []v1.Toleration{{Key: "amd.com/gpu", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}}
+		resources := v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("64Mi")}}
+		input := amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "moduleName",
+				Namespace: "moduleNamespace",
+			},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				UseInTreeDrivers:  true,
+				Tolerations:       tolerations,
+				PriorityClassName: "gpu-operands",
+				Resources:         resources,
+			},
+		}
+
+		err := km.SetDevicePluginAsDesired(&ds, &input)
+		Expect(err).To(BeNil())
+
+		podSpec := ds.Spec.Template.Spec
+		Expect(podSpec.Tolerations).To(Equal(tolerations))
+		Expect(podSpec.PriorityClassName).To(Equal("gpu-operands"))
+		Expect(podSpec.Containers[0].Resources).To(Equal(resources))
+	})
+
+	It("nil DaemonSet", func() {
+		km := NewKMMModule(nil, scheme, openShiftBuildDefaults)
+		err := km.SetDevicePluginAsDesired(nil, &amdv1alpha1.DeviceConfig{})
+		Expect(err).To(HaveOccurred())
+	})
 })
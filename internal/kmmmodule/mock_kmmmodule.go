@@ -14,7 +14,8 @@ import (
 	v1beta1 "github.com/rh-ecosystem-edge/kernel-module-management/api/v1beta1"
 	v1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
 	gomock "go.uber.org/mock/gomock"
-	v1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/apps/v1"
+	v10 "k8s.io/api/core/v1"
 )
 
 // MockKMMModuleAPI is a mock of KMMModuleAPI interface.
@@ -41,29 +42,43 @@ func (m *MockKMMModuleAPI) EXPECT() *MockKMMModuleAPIMockRecorder {
 }
 
 // SetBuildConfigMapAsDesired mocks base method.
-func (m *MockKMMModuleAPI) SetBuildConfigMapAsDesired(buildCM *v1.ConfigMap, devConfig *v1alpha1.DeviceConfig) error {
+func (m *MockKMMModuleAPI) SetBuildConfigMapAsDesired(buildCM *v10.ConfigMap, devConfig *v1alpha1.DeviceConfig, nodeOS NodeOS) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetBuildConfigMapAsDesired", buildCM, devConfig)
+	ret := m.ctrl.Call(m, "SetBuildConfigMapAsDesired", buildCM, devConfig, nodeOS)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SetBuildConfigMapAsDesired indicates an expected call of SetBuildConfigMapAsDesired.
-func (mr *MockKMMModuleAPIMockRecorder) SetBuildConfigMapAsDesired(buildCM, devConfig any) *gomock.Call {
+func (mr *MockKMMModuleAPIMockRecorder) SetBuildConfigMapAsDesired(buildCM, devConfig, nodeOS any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBuildConfigMapAsDesired", reflect.TypeOf((*MockKMMModuleAPI)(nil).SetBuildConfigMapAsDesired), buildCM, devConfig)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBuildConfigMapAsDesired", reflect.TypeOf((*MockKMMModuleAPI)(nil).SetBuildConfigMapAsDesired), buildCM, devConfig, nodeOS)
+}
+
+// SetDevicePluginAsDesired mocks base method.
+func (m *MockKMMModuleAPI) SetDevicePluginAsDesired(ds *v1.DaemonSet, devConfig *v1alpha1.DeviceConfig) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDevicePluginAsDesired", ds, devConfig)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDevicePluginAsDesired indicates an expected call of SetDevicePluginAsDesired.
+func (mr *MockKMMModuleAPIMockRecorder) SetDevicePluginAsDesired(ds, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDevicePluginAsDesired", reflect.TypeOf((*MockKMMModuleAPI)(nil).SetDevicePluginAsDesired), ds, devConfig)
 }
 
 // SetKMMModuleAsDesired mocks base method.
-func (m *MockKMMModuleAPI) SetKMMModuleAsDesired(mod *v1beta1.Module, devConfig *v1alpha1.DeviceConfig) error {
+func (m *MockKMMModuleAPI) SetKMMModuleAsDesired(mod *v1beta1.Module, devConfig *v1alpha1.DeviceConfig, nodes []v10.Node) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetKMMModuleAsDesired", mod, devConfig)
+	ret := m.ctrl.Call(m, "SetKMMModuleAsDesired", mod, devConfig, nodes)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SetKMMModuleAsDesired indicates an expected call of SetKMMModuleAsDesired.
-func (mr *MockKMMModuleAPIMockRecorder) SetKMMModuleAsDesired(mod, devConfig any) *gomock.Call {
+func (mr *MockKMMModuleAPIMockRecorder) SetKMMModuleAsDesired(mod, devConfig, nodes any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetKMMModuleAsDesired", reflect.TypeOf((*MockKMMModuleAPI)(nil).SetKMMModuleAsDesired), mod, devConfig)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetKMMModuleAsDesired", reflect.TypeOf((*MockKMMModuleAPI)(nil).SetKMMModuleAsDesired), mod, devConfig, nodes)
 }
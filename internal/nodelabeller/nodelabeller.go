@@ -19,8 +19,8 @@ package nodelabeller
 import (
 	"fmt"
 
-	"github.com/rh-ecosystem-edge/kernel-module-management/pkg/labels"
 	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -29,6 +29,14 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+const (
+	defaultNodeLabellerImage = "rocm/k8s-device-plugin:labeller-latest"
+)
+
+var (
+	defaultNodeLabellerLabels = []amdv1alpha1.NodeLabellerLabel{"vram", "cu-count", "simd-count", "device-id", "family"}
+)
+
 //go:generate mockgen -source=nodelabeller.go -package=nodelabeller -destination=mock_nodelabeller.go NodeLabeller
 type NodeLabeller interface {
 	SetNodeLabellerAsDesired(ds *appsv1.DaemonSet, devConfig *amdv1alpha1.DeviceConfig) error
@@ -82,8 +90,19 @@ func (nl *nodeLabeller) SetNodeLabellerAsDesired(ds *appsv1.DaemonSet, devConfig
 		},
 	}
 
-	matchLabels := map[string]string{"daemonset-name": devConfig.Name}
-	nodeSelector := map[string]string{labels.GetKernelModuleReadyNodeLabel(devConfig.Namespace, devConfig.Name): ""}
+	spec := devConfig.Spec.NodeLabeller
+	image := spec.Image
+	pullPolicy := spec.ImagePullPolicy
+	if image == "" {
+		image = defaultNodeLabellerImage
+		// the default image tag is moving, so it must be pulled every time
+		if pullPolicy == "" {
+			pullPolicy = v1.PullAlways
+		}
+	}
+
+	matchLabels := GetNodeLabellerPodLabels(devConfig)
+	nodeSelector := utils.GetOperandsNodeSelector(devConfig)
 	ds.Spec = appsv1.DaemonSetSpec{
 		Selector: &metav1.LabelSelector{MatchLabels: matchLabels},
 		Template: v1.PodTemplateSpec{
@@ -94,7 +113,7 @@ func (nl *nodeLabeller) SetNodeLabellerAsDesired(ds *appsv1.DaemonSet, devConfig
 			Spec: v1.PodSpec{
 				Containers: []v1.Container{
 					{
-						Args:    []string{"-vram", "-cu-count", "-simd-count", "-device-id", "-family"},
+						Args:    getArgs(spec),
 						Command: []string{"./k8s-node-labeller"},
 						Env: []v1.EnvVar{
 							{
@@ -108,15 +127,18 @@ func (nl *nodeLabeller) SetNodeLabellerAsDesired(ds *appsv1.DaemonSet, devConfig
 						},
 						Name:            "node-labeller-container",
 						WorkingDir:      "/root",
-						Image:           "rocm/k8s-device-plugin:labeller-latest",
-						ImagePullPolicy: v1.PullAlways,
+						Image:           image,
+						ImagePullPolicy: utils.GetImagePullPolicy(image, pullPolicy),
+						Resources:       devConfig.Spec.Resources,
 						SecurityContext: &v1.SecurityContext{Privileged: pointer.Bool(true)},
 						VolumeMounts:    containerVolumeMounts,
 					},
 				},
-				PriorityClassName:  "system-node-critical",
+				Affinity:           utils.GetAffinity(devConfig),
+				PriorityClassName:  utils.GetPriorityClassName(devConfig),
 				NodeSelector:       nodeSelector,
 				ServiceAccountName: "amd-gpu-operator-node-labeller",
+				Tolerations:        devConfig.Spec.Tolerations,
 				Volumes:            volumes,
 			},
 		},
@@ -124,3 +146,26 @@ func (nl *nodeLabeller) SetNodeLabellerAsDesired(ds *appsv1.DaemonSet, devConfig
 
 	return controllerutil.SetControllerReference(devConfig, ds, nl.scheme)
 }
+
+// GetNodeLabellerPodLabels returns the labels of the node labeller pods of the DeviceConfig
+func GetNodeLabellerPodLabels(devConfig *amdv1alpha1.DeviceConfig) map[string]string {
+	return map[string]string{"daemonset-name": devConfig.Name}
+}
+
+// IsEnabled returns true if the node labeller should be deployed for the DeviceConfig
+func IsEnabled(devConfig *amdv1alpha1.DeviceConfig) bool {
+	return devConfig.Spec.NodeLabeller.Enable == nil || *devConfig.Spec.NodeLabeller.Enable
+}
+
+func getArgs(spec amdv1alpha1.NodeLabellerSpec) []string {
+	labels := spec.Labels
+	if len(labels) == 0 {
+		labels = defaultNodeLabellerLabels
+	}
+
+	args := make([]string, 0, len(labels)+len(spec.ExtraArgs))
+	for _, label := range labels {
+		args = append(args, "-"+string(label))
+	}
+	return append(args, spec.ExtraArgs...)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodelabeller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+var _ = Describe("SetNodeLabellerAsDesired", func() {
+	nl := NewNodeLabeller(scheme)
+	devConfig := amdv1alpha1.DeviceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "devConfigName",
+			Namespace: "devConfigNamespace",
+		},
+	}
+
+	It("default values", func() {
+		ds := appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-labeller"}}
+
+		err := nl.SetNodeLabellerAsDesired(&ds, &devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		container := ds.Spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal("rocm/k8s-device-plugin:labeller-latest"))
+		Expect(container.ImagePullPolicy).To(Equal(v1.PullAlways))
+		Expect(container.Args).To(Equal([]string{"-vram", "-cu-count", "-simd-count", "-device-id", "-family"}))
+		Expect(ds.Spec.Template.Spec.PriorityClassName).To(Equal("system-node-critical"))
+		Expect(ds.Spec.Template.Spec.Tolerations).To(BeEmpty())
+		Expect(ds.Spec.Template.Spec.Affinity).To(BeNil())
+	})
+
+	It("scheduling values", func() {
+		ds := appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-labeller"}}
+		userDevConfig := devConfig.DeepCopy()
+		tolerations := []v1.Toleration{{Key: "amd.com/gpu", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}}
+		nodeAffinity := &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+				NodeSelectorTerms: []v1.NodeSelectorTerm{
+					{MatchExpressions: []v1.NodeSelectorRequirement{{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a"}}}},
+				},
+			},
+		}
+		resources := v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("128Mi")}}
+		userDevConfig.Spec.Tolerations = tolerations
+		userDevConfig.Spec.NodeAffinity = nodeAffinity
+		userDevConfig.Spec.PriorityClassName = "gpu-operands"
+		userDevConfig.Spec.Resources = resources
+
+		err := nl.SetNodeLabellerAsDesired(&ds, userDevConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		podSpec := ds.Spec.Template.Spec
+		Expect(podSpec.Tolerations).To(Equal(tolerations))
+		Expect(podSpec.Affinity).To(Equal(&v1.Affinity{NodeAffinity: nodeAffinity}))
+		Expect(podSpec.PriorityClassName).To(Equal("gpu-operands"))
+		Expect(podSpec.Containers[0].Resources).To(Equal(resources))
+	})
+
+	It("user values", func() {
+		ds := appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-labeller"}}
+		userDevConfig := devConfig.DeepCopy()
+		userDevConfig.Spec.NodeLabeller = amdv1alpha1.NodeLabellerSpec{
+			Image:     "registry.example.com/labeller:v1",
+			Labels:    []amdv1alpha1.NodeLabellerLabel{"product-name", "driver-version"},
+			ExtraArgs: []string{"-v=2"},
+		}
+
+		err := nl.SetNodeLabellerAsDesired(&ds, userDevConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		container := ds.Spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal("registry.example.com/labeller:v1"))
+		Expect(container.ImagePullPolicy).To(Equal(v1.PullIfNotPresent))
+		Expect(container.Args).To(Equal([]string{"-product-name", "-driver-version", "-v=2"}))
+	})
+
+	It("nil daemonset", func() {
+		Expect(nl.SetNodeLabellerAsDesired(nil, &devConfig)).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("IsEnabled", func() {
+	It("enabled by default", func() {
+		Expect(IsEnabled(&amdv1alpha1.DeviceConfig{})).To(BeTrue())
+	})
+
+	It("disabled", func() {
+		devConfig := amdv1alpha1.DeviceConfig{}
+		devConfig.Spec.NodeLabeller.Enable = pointer.Bool(false)
+		Expect(IsEnabled(&devConfig)).To(BeFalse())
+	})
+})
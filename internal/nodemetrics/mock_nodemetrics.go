@@ -14,6 +14,9 @@ import (
 	v1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
 	gomock "go.uber.org/mock/gomock"
 	v1 "k8s.io/api/apps/v1"
+	v10 "k8s.io/api/core/v1"
+	v11 "k8s.io/api/rbac/v1"
+	unstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // MockNodeMetrics is a mock of NodeMetrics interface.
@@ -39,6 +42,34 @@ func (m *MockNodeMetrics) EXPECT() *MockNodeMetricsMockRecorder {
 	return m.recorder
 }
 
+// SetMetricsReaderClusterRoleAsDesired mocks base method.
+func (m *MockNodeMetrics) SetMetricsReaderClusterRoleAsDesired(cr *v11.ClusterRole, devConfig *v1alpha1.DeviceConfig) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMetricsReaderClusterRoleAsDesired", cr, devConfig)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetMetricsReaderClusterRoleAsDesired indicates an expected call of SetMetricsReaderClusterRoleAsDesired.
+func (mr *MockNodeMetricsMockRecorder) SetMetricsReaderClusterRoleAsDesired(cr, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMetricsReaderClusterRoleAsDesired", reflect.TypeOf((*MockNodeMetrics)(nil).SetMetricsReaderClusterRoleAsDesired), cr, devConfig)
+}
+
+// SetMetricsServiceAsDesired mocks base method.
+func (m *MockNodeMetrics) SetMetricsServiceAsDesired(svc *v10.Service, devConfig *v1alpha1.DeviceConfig) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMetricsServiceAsDesired", svc, devConfig)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetMetricsServiceAsDesired indicates an expected call of SetMetricsServiceAsDesired.
+func (mr *MockNodeMetricsMockRecorder) SetMetricsServiceAsDesired(svc, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMetricsServiceAsDesired", reflect.TypeOf((*MockNodeMetrics)(nil).SetMetricsServiceAsDesired), svc, devConfig)
+}
+
 // SetNodeMetricsAsDesired mocks base method.
 func (m *MockNodeMetrics) SetNodeMetricsAsDesired(ds *v1.DaemonSet, devConfig *v1alpha1.DeviceConfig) error {
 	m.ctrl.T.Helper()
@@ -52,3 +83,17 @@ func (mr *MockNodeMetricsMockRecorder) SetNodeMetricsAsDesired(ds, devConfig any
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNodeMetricsAsDesired", reflect.TypeOf((*MockNodeMetrics)(nil).SetNodeMetricsAsDesired), ds, devConfig)
 }
+
+// SetServiceMonitorAsDesired mocks base method.
+func (m *MockNodeMetrics) SetServiceMonitorAsDesired(sm *unstructured.Unstructured, devConfig *v1alpha1.DeviceConfig) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetServiceMonitorAsDesired", sm, devConfig)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetServiceMonitorAsDesired indicates an expected call of SetServiceMonitorAsDesired.
+func (mr *MockNodeMetricsMockRecorder) SetServiceMonitorAsDesired(sm, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetServiceMonitorAsDesired", reflect.TypeOf((*MockNodeMetrics)(nil).SetServiceMonitorAsDesired), sm, devConfig)
+}
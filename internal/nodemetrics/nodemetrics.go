@@ -19,12 +19,16 @@ package nodemetrics
 import (
 	"fmt"
 
-	"github.com/rh-ecosystem-edge/kernel-module-management/pkg/labels"
 	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
@@ -34,11 +38,25 @@ const (
 	metricsPort           = 9110
 	metricsServiceAccount = "amd-gpu-operator-node-metrics"
 	metricsImage          = "quay.io/yshnaidm/node-exporter:latest"
+	serviceMonitorKind    = "ServiceMonitor"
+	rbacProxyImage        = "registry.redhat.io/openshift4/ose-kube-rbac-proxy:v4.13"
+	rbacProxyPort         = 8443
+	defaultCAKey          = "ca.crt"
+	tlsVolumeName         = "metrics-tls"
+	tlsMountPath          = "/etc/metrics-exporter/tls"
+	serviceAccountToken   = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+var (
+	ServiceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: serviceMonitorKind}
 )
 
 //go:generate mockgen -source=nodemetrics.go -package=nodemetrics -destination=mock_nodemetrics.go NodeMetrics
 type NodeMetrics interface {
 	SetNodeMetricsAsDesired(ds *appsv1.DaemonSet, devConfig *amdv1alpha1.DeviceConfig) error
+	SetMetricsServiceAsDesired(svc *v1.Service, devConfig *amdv1alpha1.DeviceConfig) error
+	SetServiceMonitorAsDesired(sm *unstructured.Unstructured, devConfig *amdv1alpha1.DeviceConfig) error
+	SetMetricsReaderClusterRoleAsDesired(cr *rbacv1.ClusterRole, devConfig *amdv1alpha1.DeviceConfig) error
 }
 
 type nodeMetrics struct {
@@ -56,38 +74,66 @@ func (nm *nodeMetrics) SetNodeMetricsAsDesired(ds *appsv1.DaemonSet, devConfig *
 		return fmt.Errorf("daemon set is not initialized, zero pointer")
 	}
 
+	spec := devConfig.Spec.MetricsExporter
 	volumes, volumesMounts := getVolumesAndMount()
-	ports := getPorts()
+	image := spec.Image
+	if image == "" {
+		image = metricsImage
+	}
 
-	matchLabels := map[string]string{
-		"app.kubernetes.io/component": "amd-gpu",
-		"app.kubernetes.io/name":      "amd-gpu",
-		"app.kubernetes.io/part-of":   "amd-gpu",
-		"app.kubernetes.io/role":      "amd-gpu-metrics",
+	exporter := v1.Container{
+		Name:            "node-metrics-container",
+		Image:           image,
+		ImagePullPolicy: utils.GetImagePullPolicy(image, spec.ImagePullPolicy),
+		SecurityContext: &v1.SecurityContext{
+			Privileged: pointer.Bool(true),
+			RunAsUser:  pointer.Int64(0),
+		},
+		Resources:    devConfig.Spec.Resources,
+		VolumeMounts: volumesMounts,
+	}
+	containers := []v1.Container{}
+	if spec.TLS != nil {
+		volumes = append(volumes, v1.Volume{
+			Name: tlsVolumeName,
+			VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{SecretName: spec.TLS.CertSecret.Name},
+			},
+		})
+	}
+	if spec.RbacProxy != nil {
+		// the exporter only listens on the loopback interface of the pod, all the traffic goes through the proxy
+		exporter.Args = []string{fmt.Sprintf("--listen-address=127.0.0.1:%d", metricsPort)}
+		containers = append(containers, exporter, getRbacProxyContainer(spec))
+	} else {
+		exporter.Ports = getPorts(spec)
+		if spec.TLS != nil {
+			exporter.Args = []string{
+				"--tls-cert-file=" + tlsMountPath + "/tls.crt",
+				"--tls-key-file=" + tlsMountPath + "/tls.key",
+			}
+			exporter.VolumeMounts = append(exporter.VolumeMounts, getTLSVolumeMount())
+		}
+		containers = append(containers, exporter)
 	}
-	nodeSelector := map[string]string{labels.GetKernelModuleReadyNodeLabel(devConfig.Namespace, devConfig.Name): ""}
+
+	matchLabels := getSelectorLabels()
+	nodeSelector := utils.GetOperandsNodeSelector(devConfig)
 	ds.Spec = appsv1.DaemonSetSpec{
 		Selector: &metav1.LabelSelector{MatchLabels: matchLabels},
 		Template: v1.PodTemplateSpec{
 			ObjectMeta: metav1.ObjectMeta{
-				Labels: matchLabels,
+				// the DaemonSet selector is immutable, so the instance label is only added to the pods,
+				// allowing the metrics Service to select the pods of its DeviceConfig
+				Labels: getPodLabels(devConfig),
 			},
 			Spec: v1.PodSpec{
-				Containers: []v1.Container{
-					{
-						Name:            "node-metrics-container",
-						Image:           metricsImage,
-						ImagePullPolicy: v1.PullAlways,
-						SecurityContext: &v1.SecurityContext{
-							Privileged: pointer.Bool(true),
-							RunAsUser:  pointer.Int64(0),
-						},
-						VolumeMounts: volumesMounts,
-						Ports:        ports,
-					},
-				},
+				Containers:         containers,
+				Affinity:           utils.GetAffinity(devConfig),
+				PriorityClassName:  utils.GetPriorityClassName(devConfig),
 				NodeSelector:       nodeSelector,
 				ServiceAccountName: metricsServiceAccount,
+				Tolerations:        devConfig.Spec.Tolerations,
 				Volumes:            volumes,
 			},
 		},
@@ -133,11 +179,225 @@ func getVolumesAndMount() ([]v1.Volume, []v1.VolumeMount) {
 	return volumes, containerVolumeMounts
 }
 
-func getPorts() []v1.ContainerPort {
+func getRbacProxyContainer(spec amdv1alpha1.MetricsExporterSpec) v1.Container {
+	image := spec.RbacProxy.Image
+	if image == "" {
+		image = rbacProxyImage
+	}
+
+	container := v1.Container{
+		Name:            "kube-rbac-proxy",
+		Image:           image,
+		ImagePullPolicy: utils.GetImagePullPolicy(image, ""),
+		Args: []string{
+			fmt.Sprintf("--secure-listen-address=0.0.0.0:%d", rbacProxyPort),
+			fmt.Sprintf("--upstream=http://127.0.0.1:%d/", metricsPort),
+			"--logtostderr=true",
+		},
+		Ports: []v1.ContainerPort{
+			{
+				Name:          metricsPortName,
+				HostPort:      getPort(spec),
+				ContainerPort: rbacProxyPort,
+				Protocol:      v1.ProtocolTCP,
+			},
+		},
+	}
+	if spec.TLS != nil {
+		container.Args = append(container.Args,
+			"--tls-cert-file="+tlsMountPath+"/tls.crt",
+			"--tls-private-key-file="+tlsMountPath+"/tls.key",
+		)
+		container.VolumeMounts = []v1.VolumeMount{getTLSVolumeMount()}
+	}
+
+	return container
+}
+
+func getTLSVolumeMount() v1.VolumeMount {
+	return v1.VolumeMount{
+		Name:      tlsVolumeName,
+		MountPath: tlsMountPath,
+		ReadOnly:  true,
+	}
+}
+
+// SetMetricsServiceAsDesired sets the Service exposing the metrics exporter pods of the DeviceConfig
+func (nm *nodeMetrics) SetMetricsServiceAsDesired(svc *v1.Service, devConfig *amdv1alpha1.DeviceConfig) error {
+	if svc == nil {
+		return fmt.Errorf("service is not initialized, zero pointer")
+	}
+
+	spec := devConfig.Spec.MetricsExporter
+	serviceType := spec.ServiceType
+	if serviceType == "" {
+		serviceType = v1.ServiceTypeClusterIP
+	}
+
+	nodePort := spec.NodePort
+	if serviceType == v1.ServiceTypeNodePort && nodePort == 0 && len(svc.Spec.Ports) == 1 {
+		// keep the node port allocated by Kubernetes
+		nodePort = svc.Spec.Ports[0].NodePort
+	}
+	if serviceType != v1.ServiceTypeNodePort {
+		nodePort = 0
+	}
+
+	svc.Labels = getServiceLabels(devConfig)
+	svc.Annotations = map[string]string{"prometheus.io/scrape": "true"}
+	svc.Spec.Type = serviceType
+	svc.Spec.Selector = getServiceLabels(devConfig)
+	svc.Spec.Ports = []v1.ServicePort{
+		{
+			Name:       metricsPortName,
+			Protocol:   v1.ProtocolTCP,
+			Port:       getPort(spec),
+			TargetPort: intstr.FromString(metricsPortName),
+			NodePort:   nodePort,
+		},
+	}
+
+	return controllerutil.SetControllerReference(devConfig, svc, nm.scheme)
+}
+
+// SetServiceMonitorAsDesired sets the prometheus-operator ServiceMonitor scraping the metrics Service of the DeviceConfig
+func (nm *nodeMetrics) SetServiceMonitorAsDesired(sm *unstructured.Unstructured, devConfig *amdv1alpha1.DeviceConfig) error {
+	if sm == nil {
+		return fmt.Errorf("service monitor is not initialized, zero pointer")
+	}
+
+	matchLabels := map[string]interface{}{}
+	for k, v := range getServiceLabels(devConfig) {
+		matchLabels[k] = v
+	}
+
+	spec := devConfig.Spec.MetricsExporter
+	endpoint := map[string]interface{}{
+		"path":          "/metrics",
+		"port":          metricsPortName,
+		"scheme":        "http",
+		"interval":      "30s",
+		"scrapeTimeout": "20s",
+	}
+	if spec.RbacProxy != nil || spec.TLS != nil {
+		endpoint["scheme"] = "https"
+	}
+	if spec.RbacProxy != nil {
+		endpoint["bearerTokenFile"] = serviceAccountToken
+	}
+	if spec.TLS != nil {
+		endpoint["tlsConfig"] = map[string]interface{}{
+			"ca":         getCA(spec.TLS),
+			"serverName": fmt.Sprintf("%s-node-metrics.%s.svc", devConfig.Name, devConfig.Namespace),
+		}
+	} else if spec.RbacProxy != nil {
+		// kube-rbac-proxy serves a self-signed certificate when no certificate is provided
+		endpoint["tlsConfig"] = map[string]interface{}{
+			"insecureSkipVerify": true,
+		}
+	}
+
+	sm.SetGroupVersionKind(ServiceMonitorGVK)
+	sm.SetLabels(map[string]string{"app": "amd-gpu-metrics"})
+	sm.Object["spec"] = map[string]interface{}{
+		"endpoints": []interface{}{endpoint},
+		"namespaceSelector": map[string]interface{}{
+			"matchNames": []interface{}{devConfig.Namespace},
+		},
+		"selector": map[string]interface{}{
+			"matchLabels": matchLabels,
+		},
+	}
+
+	return controllerutil.SetControllerReference(devConfig, sm, nm.scheme)
+}
+
+// getCA returns the ServiceMonitor reference to the CA certificate of the metrics endpoint
+func getCA(tls *amdv1alpha1.MetricsTLSSpec) map[string]interface{} {
+	if tls.CAConfigMap != nil {
+		return map[string]interface{}{
+			"configMap": map[string]interface{}{
+				"name": tls.CAConfigMap.Name,
+				"key":  tls.CAConfigMap.Key,
+			},
+		}
+	}
+
+	key := tls.CAKey
+	if key == "" {
+		key = defaultCAKey
+	}
+	return map[string]interface{}{
+		"secret": map[string]interface{}{
+			"name": tls.CertSecret.Name,
+			"key":  key,
+		},
+	}
+}
+
+// SetMetricsReaderClusterRoleAsDesired sets the ClusterRole allowing to get the metrics of the DeviceConfig through
+// kube-rbac-proxy. The ClusterRole is cluster scoped, so it is not owned by the DeviceConfig and is deleted by the
+// operator on finalization
+func (nm *nodeMetrics) SetMetricsReaderClusterRoleAsDesired(cr *rbacv1.ClusterRole, devConfig *amdv1alpha1.DeviceConfig) error {
+	if cr == nil {
+		return fmt.Errorf("cluster role is not initialized, zero pointer")
+	}
+
+	cr.Labels = getServiceLabels(devConfig)
+	cr.Rules = []rbacv1.PolicyRule{
+		{
+			NonResourceURLs: []string{"/metrics"},
+			Verbs:           []string{"get"},
+		},
+	}
+
+	return nil
+}
+
+// GetMetricsReaderClusterRoleName returns the name of the metrics reader ClusterRole of the DeviceConfig
+func GetMetricsReaderClusterRoleName(devConfig *amdv1alpha1.DeviceConfig) string {
+	return fmt.Sprintf("%s-%s-metrics-reader", devConfig.Namespace, devConfig.Name)
+}
+
+// IsEnabled returns true if the metrics exporter should be deployed for the DeviceConfig
+func IsEnabled(devConfig *amdv1alpha1.DeviceConfig) bool {
+	return devConfig.Spec.MetricsExporter.Enable == nil || *devConfig.Spec.MetricsExporter.Enable
+}
+
+func getSelectorLabels() map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/component": "amd-gpu",
+		"app.kubernetes.io/name":      "amd-gpu",
+		"app.kubernetes.io/part-of":   "amd-gpu",
+		"app.kubernetes.io/role":      "amd-gpu-metrics",
+	}
+}
+
+func getPodLabels(devConfig *amdv1alpha1.DeviceConfig) map[string]string {
+	labels := getSelectorLabels()
+	labels["app.kubernetes.io/instance"] = devConfig.Name
+	return labels
+}
+
+func getServiceLabels(devConfig *amdv1alpha1.DeviceConfig) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/role":     "amd-gpu-metrics",
+		"app.kubernetes.io/instance": devConfig.Name,
+	}
+}
+
+func getPort(spec amdv1alpha1.MetricsExporterSpec) int32 {
+	if spec.Port == 0 {
+		return metricsPort
+	}
+	return spec.Port
+}
+
+func getPorts(spec amdv1alpha1.MetricsExporterSpec) []v1.ContainerPort {
 	return []v1.ContainerPort{
 		{
 			Name:          metricsPortName,
-			HostPort:      metricsPort,
+			HostPort:      getPort(spec),
 			ContainerPort: metricsPort,
 			Protocol:      v1.ProtocolTCP,
 		},
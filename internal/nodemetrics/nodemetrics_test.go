@@ -0,0 +1,308 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodemetrics
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("SetNodeMetricsAsDesired", func() {
+	nm := NewNodeMetrcis(scheme)
+	devConfig := amdv1alpha1.DeviceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "devConfigName",
+			Namespace: "devConfigNamespace",
+		},
+	}
+
+	It("default values", func() {
+		ds := appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"}}
+
+		err := nm.SetNodeMetricsAsDesired(&ds, &devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		container := ds.Spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal(metricsImage))
+		Expect(container.ImagePullPolicy).To(Equal(v1.PullAlways))
+		Expect(container.Ports[0].HostPort).To(Equal(int32(metricsPort)))
+		Expect(ds.Spec.Template.Labels).To(HaveKeyWithValue("app.kubernetes.io/instance", devConfig.Name))
+		Expect(ds.Spec.Template.Spec.PriorityClassName).To(Equal("system-node-critical"))
+	})
+
+	It("scheduling values", func() {
+		ds := appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"}}
+		userDevConfig := devConfig.DeepCopy()
+		tolerations := []v1.Toleration{{Key: "amd.com/gpu", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}}
+		resources := v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")}}
+		userDevConfig.Spec.Tolerations = tolerations
+		userDevConfig.Spec.PriorityClassName = "gpu-operands"
+		userDevConfig.Spec.Resources = resources
+
+		err := nm.SetNodeMetricsAsDesired(&ds, userDevConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		podSpec := ds.Spec.Template.Spec
+		Expect(podSpec.Tolerations).To(Equal(tolerations))
+		Expect(podSpec.PriorityClassName).To(Equal("gpu-operands"))
+		Expect(podSpec.Containers[0].Resources).To(Equal(resources))
+	})
+
+	It("user values", func() {
+		ds := appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"}}
+		userDevConfig := devConfig.DeepCopy()
+		userDevConfig.Spec.MetricsExporter = amdv1alpha1.MetricsExporterSpec{
+			Image: "registry.example.com/exporter:v1",
+			Port:  9500,
+		}
+
+		err := nm.SetNodeMetricsAsDesired(&ds, userDevConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		container := ds.Spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal("registry.example.com/exporter:v1"))
+		Expect(container.ImagePullPolicy).To(Equal(v1.PullIfNotPresent))
+		Expect(container.Ports[0].HostPort).To(Equal(int32(9500)))
+		Expect(container.Ports[0].ContainerPort).To(Equal(int32(metricsPort)))
+	})
+
+	It("kube-rbac-proxy with TLS", func() {
+		ds := appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"}}
+		userDevConfig := devConfig.DeepCopy()
+		userDevConfig.Spec.MetricsExporter = amdv1alpha1.MetricsExporterSpec{
+			RbacProxy: &amdv1alpha1.MetricsRbacProxySpec{},
+			TLS:       &amdv1alpha1.MetricsTLSSpec{CertSecret: v1.LocalObjectReference{Name: "metrics-cert"}},
+		}
+
+		err := nm.SetNodeMetricsAsDesired(&ds, userDevConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		containers := ds.Spec.Template.Spec.Containers
+		Expect(containers).To(HaveLen(2))
+		Expect(containers[0].Ports).To(BeEmpty())
+		Expect(containers[0].Args).To(Equal([]string{"--listen-address=127.0.0.1:9110"}))
+		Expect(containers[1].Image).To(Equal(rbacProxyImage))
+		Expect(containers[1].Ports[0].HostPort).To(Equal(int32(metricsPort)))
+		Expect(containers[1].Ports[0].ContainerPort).To(Equal(int32(rbacProxyPort)))
+		Expect(containers[1].Args).To(ContainElements(
+			"--upstream=http://127.0.0.1:9110/",
+			"--tls-cert-file=/etc/metrics-exporter/tls/tls.crt",
+			"--tls-private-key-file=/etc/metrics-exporter/tls/tls.key",
+		))
+		Expect(containers[1].VolumeMounts).To(Equal([]v1.VolumeMount{getTLSVolumeMount()}))
+		Expect(ds.Spec.Template.Spec.Volumes).To(ContainElement(v1.Volume{
+			Name:         tlsVolumeName,
+			VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "metrics-cert"}},
+		}))
+	})
+
+	It("TLS served by the exporter", func() {
+		ds := appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"}}
+		userDevConfig := devConfig.DeepCopy()
+		userDevConfig.Spec.MetricsExporter.TLS = &amdv1alpha1.MetricsTLSSpec{CertSecret: v1.LocalObjectReference{Name: "metrics-cert"}}
+
+		err := nm.SetNodeMetricsAsDesired(&ds, userDevConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		containers := ds.Spec.Template.Spec.Containers
+		Expect(containers).To(HaveLen(1))
+		Expect(containers[0].Ports[0].HostPort).To(Equal(int32(metricsPort)))
+		Expect(containers[0].Args).To(Equal([]string{
+			"--tls-cert-file=/etc/metrics-exporter/tls/tls.crt",
+			"--tls-key-file=/etc/metrics-exporter/tls/tls.key",
+		}))
+		Expect(containers[0].VolumeMounts).To(ContainElement(getTLSVolumeMount()))
+	})
+})
+
+var _ = Describe("SetMetricsServiceAsDesired", func() {
+	nm := NewNodeMetrcis(scheme)
+	devConfig := amdv1alpha1.DeviceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "devConfigName",
+			Namespace: "devConfigNamespace",
+		},
+	}
+
+	It("default values", func() {
+		svc := v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"}}
+
+		err := nm.SetMetricsServiceAsDesired(&svc, &devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(svc.Spec.Type).To(Equal(v1.ServiceTypeClusterIP))
+		Expect(svc.Spec.Selector).To(Equal(map[string]string{
+			"app.kubernetes.io/role":     "amd-gpu-metrics",
+			"app.kubernetes.io/instance": devConfig.Name,
+		}))
+		Expect(svc.Spec.Ports).To(Equal([]v1.ServicePort{
+			{
+				Name:       metricsPortName,
+				Protocol:   v1.ProtocolTCP,
+				Port:       metricsPort,
+				TargetPort: intstr.FromString(metricsPortName),
+			},
+		}))
+		Expect(svc.OwnerReferences).To(HaveLen(1))
+	})
+
+	It("NodePort service keeps the allocated node port", func() {
+		svc := v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: devConfig.Name + "-node-metrics"},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{{Name: metricsPortName, NodePort: 31000}},
+			},
+		}
+		userDevConfig := devConfig.DeepCopy()
+		userDevConfig.Spec.MetricsExporter.ServiceType = v1.ServiceTypeNodePort
+
+		err := nm.SetMetricsServiceAsDesired(&svc, userDevConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(svc.Spec.Type).To(Equal(v1.ServiceTypeNodePort))
+		Expect(svc.Spec.Ports[0].NodePort).To(Equal(int32(31000)))
+
+		userDevConfig.Spec.MetricsExporter.NodePort = 32000
+
+		err = nm.SetMetricsServiceAsDesired(&svc, userDevConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(svc.Spec.Ports[0].NodePort).To(Equal(int32(32000)))
+	})
+})
+
+var _ = Describe("SetServiceMonitorAsDesired", func() {
+	nm := NewNodeMetrcis(scheme)
+	devConfig := amdv1alpha1.DeviceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "devConfigName",
+			Namespace: "devConfigNamespace",
+		},
+	}
+
+	It("good flow", func() {
+		sm := unstructured.Unstructured{}
+		sm.SetNamespace(devConfig.Namespace)
+		sm.SetName(devConfig.Name + "-node-metrics")
+
+		err := nm.SetServiceMonitorAsDesired(&sm, &devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sm.GroupVersionKind()).To(Equal(ServiceMonitorGVK))
+		matchLabels, found, err := unstructured.NestedStringMap(sm.Object, "spec", "selector", "matchLabels")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(matchLabels).To(HaveKeyWithValue("app.kubernetes.io/instance", devConfig.Name))
+		namespaces, _, err := unstructured.NestedStringSlice(sm.Object, "spec", "namespaceSelector", "matchNames")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(namespaces).To(Equal([]string{devConfig.Namespace}))
+		Expect(sm.GetOwnerReferences()).To(HaveLen(1))
+		endpoint := sm.Object["spec"].(map[string]interface{})["endpoints"].([]interface{})[0].(map[string]interface{})
+		Expect(endpoint).To(HaveKeyWithValue("scheme", "http"))
+		Expect(endpoint).ToNot(HaveKey("tlsConfig"))
+	})
+
+	It("kube-rbac-proxy with TLS", func() {
+		sm := unstructured.Unstructured{}
+		sm.SetNamespace(devConfig.Namespace)
+		sm.SetName(devConfig.Name + "-node-metrics")
+		userDevConfig := devConfig.DeepCopy()
+		userDevConfig.Spec.MetricsExporter.RbacProxy = &amdv1alpha1.MetricsRbacProxySpec{}
+		userDevConfig.Spec.MetricsExporter.TLS = &amdv1alpha1.MetricsTLSSpec{CertSecret: v1.LocalObjectReference{Name: "metrics-cert"}}
+
+		err := nm.SetServiceMonitorAsDesired(&sm, userDevConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		endpoint := sm.Object["spec"].(map[string]interface{})["endpoints"].([]interface{})[0].(map[string]interface{})
+		Expect(endpoint).To(HaveKeyWithValue("scheme", "https"))
+		Expect(endpoint).To(HaveKeyWithValue("bearerTokenFile", serviceAccountToken))
+		caSecret, _, err := unstructured.NestedStringMap(endpoint, "tlsConfig", "ca", "secret")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(caSecret).To(Equal(map[string]string{"name": "metrics-cert", "key": "ca.crt"}))
+		serverName, _, err := unstructured.NestedString(endpoint, "tlsConfig", "serverName")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serverName).To(Equal("devConfigName-node-metrics.devConfigNamespace.svc"))
+	})
+
+	It("TLS with the CA in a ConfigMap", func() {
+		sm := unstructured.Unstructured{}
+		sm.SetNamespace(devConfig.Namespace)
+		sm.SetName(devConfig.Name + "-node-metrics")
+		userDevConfig := devConfig.DeepCopy()
+		userDevConfig.Spec.MetricsExporter.TLS = &amdv1alpha1.MetricsTLSSpec{
+			CertSecret: v1.LocalObjectReference{Name: "metrics-cert"},
+			CAKey:      "tls.crt",
+			CAConfigMap: &v1.ConfigMapKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: "openshift-service-ca.crt"},
+				Key:                  "service-ca.crt",
+			},
+		}
+
+		err := nm.SetServiceMonitorAsDesired(&sm, userDevConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		endpoint := sm.Object["spec"].(map[string]interface{})["endpoints"].([]interface{})[0].(map[string]interface{})
+		caConfigMap, _, err := unstructured.NestedStringMap(endpoint, "tlsConfig", "ca", "configMap")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(caConfigMap).To(Equal(map[string]string{"name": "openshift-service-ca.crt", "key": "service-ca.crt"}))
+	})
+
+	It("kube-rbac-proxy without TLS", func() {
+		sm := unstructured.Unstructured{}
+		sm.SetNamespace(devConfig.Namespace)
+		sm.SetName(devConfig.Name + "-node-metrics")
+		userDevConfig := devConfig.DeepCopy()
+		userDevConfig.Spec.MetricsExporter.RbacProxy = &amdv1alpha1.MetricsRbacProxySpec{}
+
+		err := nm.SetServiceMonitorAsDesired(&sm, userDevConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		endpoint := sm.Object["spec"].(map[string]interface{})["endpoints"].([]interface{})[0].(map[string]interface{})
+		insecure, _, err := unstructured.NestedBool(endpoint, "tlsConfig", "insecureSkipVerify")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(insecure).To(BeTrue())
+	})
+})
+
+var _ = Describe("SetMetricsReaderClusterRoleAsDesired", func() {
+	nm := NewNodeMetrcis(scheme)
+	devConfig := amdv1alpha1.DeviceConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "devConfigName",
+			Namespace: "devConfigNamespace",
+		},
+	}
+
+	It("good flow", func() {
+		cr := rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: GetMetricsReaderClusterRoleName(&devConfig)}}
+
+		err := nm.SetMetricsReaderClusterRoleAsDesired(&cr, &devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cr.Name).To(Equal("devConfigNamespace-devConfigName-metrics-reader"))
+		Expect(cr.Rules).To(Equal([]rbacv1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}}))
+		Expect(cr.OwnerReferences).To(BeEmpty())
+	})
+})
@@ -0,0 +1,70 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: partition.go
+//
+// Generated by this command:
+//
+//	mockgen -source=partition.go -package=partition -destination=mock_partition.go Partitioner
+//
+// Package partition is a generated GoMock package.
+package partition
+
+import (
+	context "context"
+	reflect "reflect"
+
+	v1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	gomock "go.uber.org/mock/gomock"
+	v1 "k8s.io/api/apps/v1"
+)
+
+// MockPartitioner is a mock of Partitioner interface.
+type MockPartitioner struct {
+	ctrl     *gomock.Controller
+	recorder *MockPartitionerMockRecorder
+}
+
+// MockPartitionerMockRecorder is the mock recorder for MockPartitioner.
+type MockPartitionerMockRecorder struct {
+	mock *MockPartitioner
+}
+
+// NewMockPartitioner creates a new mock instance.
+func NewMockPartitioner(ctrl *gomock.Controller) *MockPartitioner {
+	mock := &MockPartitioner{ctrl: ctrl}
+	mock.recorder = &MockPartitionerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPartitioner) EXPECT() *MockPartitionerMockRecorder {
+	return m.recorder
+}
+
+// HandlePartitioning mocks base method.
+func (m *MockPartitioner) HandlePartitioning(ctx context.Context, devConfig *v1alpha1.DeviceConfig) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HandlePartitioning", ctx, devConfig)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HandlePartitioning indicates an expected call of HandlePartitioning.
+func (mr *MockPartitionerMockRecorder) HandlePartitioning(ctx, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandlePartitioning", reflect.TypeOf((*MockPartitioner)(nil).HandlePartitioning), ctx, devConfig)
+}
+
+// SetAgentDaemonSetAsDesired mocks base method.
+func (m *MockPartitioner) SetAgentDaemonSetAsDesired(ds *v1.DaemonSet, devConfig *v1alpha1.DeviceConfig) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAgentDaemonSetAsDesired", ds, devConfig)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetAgentDaemonSetAsDesired indicates an expected call of SetAgentDaemonSetAsDesired.
+func (mr *MockPartitionerMockRecorder) SetAgentDaemonSetAsDesired(ds, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAgentDaemonSetAsDesired", reflect.TypeOf((*MockPartitioner)(nil).SetAgentDaemonSetAsDesired), ds, devConfig)
+}
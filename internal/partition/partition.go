@@ -0,0 +1,534 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package partition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/nodelabeller"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/upgrade"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// ProfileLabel is set on a node once it is drained, to the profile the partition agent applies on it
+	ProfileLabel = "amd.io/gpu-partition-profile"
+
+	// the node labeller publishes the current partitions of the GPUs, e.g. cpx_nps4, when the
+	// compute-memory-partition label family is enabled
+	computeMemoryPartitionLabel = "amd.com/compute-memory-partition"
+
+	agentImage          = "registry.access.redhat.com/ubi9/ubi-minimal:latest"
+	agentServiceAccount = "amd-gpu-operator-partition-agent"
+	agentContainerName  = "partition-agent"
+	computePartitionEnv = "COMPUTE_PARTITION"
+	memoryPartitionEnv  = "MEMORY_PARTITION"
+	defaultDrainTimeout = 300 * time.Second
+
+	// the memory partition is written first, unless the current compute partition does not support it,
+	// e.g. NPS4 with SPX, in which case the compute partition is written first
+	agentScript = `set -e
+apply() { [ ! -f "$1" ] || [ "$(cat "$1")" = "$2" ] || echo "$2" > "$1"; }
+found=0
+for dev in /sys/class/drm/card*/device; do
+  [ -f "$dev/current_compute_partition" ] || continue
+  found=1
+  if [ -n "$MEMORY_PARTITION" ] && ! apply "$dev/current_memory_partition" "$MEMORY_PARTITION" 2>/dev/null; then
+    apply "$dev/current_compute_partition" "$COMPUTE_PARTITION"
+    apply "$dev/current_memory_partition" "$MEMORY_PARTITION"
+  fi
+  apply "$dev/current_compute_partition" "$COMPUTE_PARTITION"
+done
+if [ "$found" = 0 ]; then echo "no GPU supporting compute partitioning was found"; exit 1; fi
+exec sleep infinity`
+
+	agentReadinessCheck = `for dev in /sys/class/drm/card*/device; do
+  [ -f "$dev/current_compute_partition" ] || continue
+  [ "$(cat "$dev/current_compute_partition")" = "$COMPUTE_PARTITION" ] || exit 1
+  [ -z "$MEMORY_PARTITION" ] || [ ! -f "$dev/current_memory_partition" ] || [ "$(cat "$dev/current_memory_partition")" = "$MEMORY_PARTITION" ] || exit 1
+done`
+)
+
+//go:generate mockgen -source=partition.go -package=partition -destination=mock_partition.go Partitioner
+type Partitioner interface {
+	SetAgentDaemonSetAsDesired(ds *appsv1.DaemonSet, devConfig *amdv1alpha1.DeviceConfig) error
+	HandlePartitioning(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) (bool, error)
+}
+
+type partitioner struct {
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+func NewPartitioner(client client.Client, scheme *runtime.Scheme) Partitioner {
+	return &partitioner{
+		client: client,
+		scheme: scheme,
+	}
+}
+
+// GetProfile returns the partitioning profile of the spec, e.g. CPX-NPS4, or CPX when the memory
+// partition is not set
+func GetProfile(spec *amdv1alpha1.PartitioningSpec) string {
+	if spec.MemoryPartition == "" {
+		return string(spec.ComputePartition)
+	}
+	return string(spec.ComputePartition) + "-" + string(spec.MemoryPartition)
+}
+
+// GetAgentPodLabels returns the labels of the partition agent pods of the DeviceConfig
+func GetAgentPodLabels(devConfig *amdv1alpha1.DeviceConfig) map[string]string {
+	return map[string]string{"daemonset-name": devConfig.Name + "-partition-agent"}
+}
+
+// SetAgentDaemonSetAsDesired sets the DaemonSet applying the partitioning profile through sysfs. Its pods only
+// run on the nodes labelled with the profile, which happens once they are drained, and are ready once the
+// profile is applied on all the GPUs of the node
+func (p *partitioner) SetAgentDaemonSetAsDesired(ds *appsv1.DaemonSet, devConfig *amdv1alpha1.DeviceConfig) error {
+	if ds == nil {
+		return fmt.Errorf("daemon set is not initialized, zero pointer")
+	}
+	spec := devConfig.Spec.Partitioning
+	if spec == nil {
+		return fmt.Errorf("partitioning is not set in DeviceConfig %s/%s", devConfig.Namespace, devConfig.Name)
+	}
+
+	image := spec.Image
+	if image == "" {
+		image = agentImage
+	}
+
+	nodeSelector := map[string]string{ProfileLabel: GetProfile(spec)}
+	for k, v := range utils.GetOperandsNodeSelector(devConfig) {
+		nodeSelector[k] = v
+	}
+
+	hostPathDirectory := v1.HostPathDirectory
+	matchLabels := GetAgentPodLabels(devConfig)
+	ds.Spec = appsv1.DaemonSetSpec{
+		Selector: &metav1.LabelSelector{MatchLabels: matchLabels},
+		Template: v1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: matchLabels,
+			},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{
+					{
+						Name:            agentContainerName,
+						Command:         []string{"/bin/sh", "-c", agentScript},
+						Image:           image,
+						ImagePullPolicy: utils.GetImagePullPolicy(image, ""),
+						Env: []v1.EnvVar{
+							{Name: computePartitionEnv, Value: string(spec.ComputePartition)},
+							{Name: memoryPartitionEnv, Value: string(spec.MemoryPartition)},
+						},
+						ReadinessProbe: &v1.Probe{
+							ProbeHandler: v1.ProbeHandler{
+								Exec: &v1.ExecAction{Command: []string{"/bin/sh", "-c", agentReadinessCheck}},
+							},
+							PeriodSeconds: 10,
+						},
+						Resources:       devConfig.Spec.Resources,
+						SecurityContext: &v1.SecurityContext{Privileged: pointer.Bool(true)},
+						VolumeMounts: []v1.VolumeMount{
+							{
+								Name:      "sys",
+								MountPath: "/sys",
+							},
+						},
+					},
+				},
+				Affinity:           utils.GetAffinity(devConfig),
+				PriorityClassName:  utils.GetPriorityClassName(devConfig),
+				NodeSelector:       nodeSelector,
+				ServiceAccountName: agentServiceAccount,
+				Tolerations:        devConfig.Spec.Tolerations,
+				Volumes: []v1.Volume{
+					{
+						Name: "sys",
+						VolumeSource: v1.VolumeSource{
+							HostPath: &v1.HostPathVolumeSource{
+								Path: "/sys",
+								Type: &hostPathDirectory,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return controllerutil.SetControllerReference(devConfig, ds, p.scheme)
+}
+
+// HandlePartitioning moves the nodes whose profile differs from the desired one through the partitioning states,
+// one node at a time, and records the state of each node in the DeviceConfig status. The status is only updated
+// in devConfig, it is up to the caller to persist it.
+// It returns true while the partitioning is in progress on any of the nodes, and the nodes should be checked again
+func (p *partitioner) HandlePartitioning(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) (bool, error) {
+	spec := devConfig.Spec.Partitioning
+	if spec == nil {
+		// the nodes are released before the status tracking them is dropped
+		if err := p.releaseNodes(ctx, devConfig); err != nil {
+			return false, err
+		}
+		devConfig.Status.NodePartitions = nil
+		return false, nil
+	}
+
+	// the GPUs can only be partitioned once the drivers are loaded
+	nodes := v1.NodeList{}
+	if err := p.client.List(ctx, &nodes, client.MatchingLabels(utils.GetOperandsNodeSelector(devConfig))); err != nil {
+		return false, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	sort.Slice(nodes.Items, func(i, j int) bool { return nodes.Items[i].Name < nodes.Items[j].Name })
+
+	profile := GetProfile(spec)
+	previousStatuses := map[string]amdv1alpha1.NodePartitionStatus{}
+	for _, nodeStatus := range devConfig.Status.NodePartitions {
+		previousStatuses[nodeStatus.NodeName] = nodeStatus
+	}
+
+	nodeStatuses := make([]amdv1alpha1.NodePartitionStatus, 0, len(nodes.Items))
+	active := -1
+	candidates := []int{}
+	var nodeErr error
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		nodeStatus, found := previousStatuses[node.Name]
+		if !found {
+			nodeStatus = amdv1alpha1.NodePartitionStatus{NodeName: node.Name}
+		}
+		switch {
+		case isInProgress(nodeStatus):
+			// a profile change while the node is partitioned is applied as part of the same cycle
+			nodeStatus.Profile = profile
+			active = len(nodeStatuses)
+		case nodeStatus.State == amdv1alpha1.PartitionStateFailed && nodeStatus.Profile == profile:
+		case node.Labels[ProfileLabel] == profile:
+			if nodeStatus.State != amdv1alpha1.PartitionStateDone || nodeStatus.Profile != profile {
+				nodeStatus.Profile = profile
+				setState(&nodeStatus, amdv1alpha1.PartitionStateDone, "")
+			}
+			if err := p.uncordon(ctx, devConfig, node, &nodeStatus); err != nil {
+				nodeErr = errors.Join(nodeErr, fmt.Errorf("failed to partition node %s: %v", node.Name, err))
+			}
+		case hasPartitions(node, spec):
+			// the GPUs are already partitioned as requested, the node only needs the profile label
+			if err := p.setProfileLabel(ctx, node, profile); err != nil {
+				nodeErr = errors.Join(nodeErr, fmt.Errorf("failed to partition node %s: %v", node.Name, err))
+				break
+			}
+			nodeStatus.Profile = profile
+			setState(&nodeStatus, amdv1alpha1.PartitionStateDone, "")
+			if err := p.uncordon(ctx, devConfig, node, &nodeStatus); err != nil {
+				nodeErr = errors.Join(nodeErr, fmt.Errorf("failed to partition node %s: %v", node.Name, err))
+			}
+		default:
+			// the node keeps reporting its previous state until it is selected, so that a cordon left by a
+			// failed attempt is still released once it is partitioned
+			candidates = append(candidates, len(nodeStatuses))
+		}
+		nodeStatuses = append(nodeStatuses, nodeStatus)
+	}
+
+	if active < 0 {
+		for j, index := range candidates {
+			// the drivers upgrade and the partitioning of a node are not run at the same time
+			if upgrade.IsNodeUpgrading(devConfig, nodeStatuses[index].NodeName) {
+				continue
+			}
+			active = index
+			candidates = append(candidates[:j:j], candidates[j+1:]...)
+			nodeStatuses[active].Profile = profile
+			setState(&nodeStatuses[active], amdv1alpha1.PartitionStateDrain, "")
+			break
+		}
+	}
+
+	if active >= 0 {
+		if err := p.handleNode(ctx, devConfig, &nodes.Items[active], &nodeStatuses[active]); err != nil {
+			nodeErr = errors.Join(nodeErr, fmt.Errorf("failed to partition node %s: %v", nodeStatuses[active].NodeName, err))
+		}
+	}
+
+	// nodes waiting for their turn are not reported
+	devConfig.Status.NodePartitions = nil
+	for _, nodeStatus := range nodeStatuses {
+		if nodeStatus.State != "" {
+			devConfig.Status.NodePartitions = append(devConfig.Status.NodePartitions, nodeStatus)
+		}
+	}
+
+	return (active >= 0 && isInProgress(nodeStatuses[active])) || len(candidates) > 0, nodeErr
+}
+
+// handleNode moves the node to the next partitioning state, once the current one is completed
+func (p *partitioner) handleNode(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, node *v1.Node, nodeStatus *amdv1alpha1.NodePartitionStatus) error {
+	logger := log.FromContext(ctx).WithValues("node", node.Name, "profile", nodeStatus.Profile)
+	spec := devConfig.Spec.Partitioning
+
+	switch nodeStatus.State {
+	case amdv1alpha1.PartitionStateDrain:
+		// a node already cordoned, e.g. by an admin, is left cordoned once partitioned
+		if !node.Spec.Unschedulable {
+			if err := upgrade.SetNodeUnschedulable(ctx, p.client, node, true); err != nil {
+				return err
+			}
+			nodeStatus.Cordoned = true
+		}
+		remaining, err := upgrade.EvictPods(ctx, p.client, node, spec.PodSelector)
+		if err != nil {
+			return err
+		}
+		if remaining == 0 {
+			logger.Info("node drained, applying the partitioning profile")
+			if err := p.setProfileLabel(ctx, node, nodeStatus.Profile); err != nil {
+				return err
+			}
+			setState(nodeStatus, amdv1alpha1.PartitionStateApply, "waiting for the partition agent to apply the profile")
+			return nil
+		}
+		timeout := defaultDrainTimeout
+		if spec.DrainTimeoutSeconds != 0 {
+			timeout = time.Duration(spec.DrainTimeoutSeconds) * time.Second
+		}
+		if time.Since(nodeStatus.LastTransitionTime.Time) > timeout {
+			logger.Info("node drain timed out", "remaining pods", remaining)
+			setState(nodeStatus, amdv1alpha1.PartitionStateFailed, fmt.Sprintf("%d pods were not evicted after %s", remaining, timeout))
+			return nil
+		}
+		nodeStatus.Message = fmt.Sprintf("waiting for %d pods to be evicted", remaining)
+	case amdv1alpha1.PartitionStateApply:
+		if err := p.setProfileLabel(ctx, node, nodeStatus.Profile); err != nil {
+			return err
+		}
+		agentPod, err := p.getAgentPod(ctx, devConfig, node)
+		if err != nil {
+			return err
+		}
+		switch {
+		case agentPod == nil || !isPodReady(agentPod):
+			if agentPod != nil && hasAgentFailed(agentPod) {
+				logger.Info("partition agent failed")
+				setState(nodeStatus, amdv1alpha1.PartitionStateFailed, fmt.Sprintf("partition agent pod %s failed to apply the profile", agentPod.Name))
+				return nil
+			}
+			nodeStatus.Message = "waiting for the partition agent to apply the profile"
+		default:
+			// the node labeller publishes the partition labels when it starts
+			if err := p.restartNodeLabeller(ctx, devConfig, node); err != nil {
+				return err
+			}
+			if err := p.uncordon(ctx, devConfig, node, nodeStatus); err != nil {
+				return err
+			}
+			logger.Info("node partitioned")
+			setState(nodeStatus, amdv1alpha1.PartitionStateDone, "")
+		}
+	}
+
+	return nil
+}
+
+// uncordon uncordons the node if it was cordoned by the partitioning, unless a drivers upgrade owns the node:
+// the node then stays cordoned, and is uncordoned once the upgrade is completed
+func (p *partitioner) uncordon(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, node *v1.Node, nodeStatus *amdv1alpha1.NodePartitionStatus) error {
+	if !nodeStatus.Cordoned {
+		return nil
+	}
+	logger := log.FromContext(ctx).WithValues("node", node.Name)
+	if upgrade.IsNodeUpgrading(devConfig, node.Name) || node.Labels[upgrade.UpgradeStateLabel] == amdv1alpha1.UpgradeStateFailed {
+		logger.Info("leaving node cordoned for the drivers upgrade")
+		return nil
+	}
+	logger.Info("uncordoning node")
+	if err := upgrade.SetNodeUnschedulable(ctx, p.client, node, false); err != nil {
+		return err
+	}
+	nodeStatus.Cordoned = false
+	return nil
+}
+
+// releaseNodes removes the profile label from the nodes and uncordons the nodes cordoned by the partitioning,
+// once the partitioning is removed from the DeviceConfig
+func (p *partitioner) releaseNodes(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error {
+	if len(devConfig.Status.NodePartitions) == 0 {
+		return nil
+	}
+
+	nodes := v1.NodeList{}
+	if err := p.client.List(ctx, &nodes, client.MatchingLabels(utils.GetNodeSelector(devConfig))); err != nil {
+		return fmt.Errorf("failed to list nodes: %v", err)
+	}
+	nodeStatuses := map[string]*amdv1alpha1.NodePartitionStatus{}
+	for i := range devConfig.Status.NodePartitions {
+		nodeStatuses[devConfig.Status.NodePartitions[i].NodeName] = &devConfig.Status.NodePartitions[i]
+	}
+
+	var errs error
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if _, ok := node.Labels[ProfileLabel]; ok {
+			nodeCopy := node.DeepCopy()
+			delete(node.Labels, ProfileLabel)
+			if err := p.client.Patch(ctx, node, client.MergeFrom(nodeCopy)); err != nil {
+				errs = errors.Join(errs, fmt.Errorf("failed to remove label %s of node %s: %v", ProfileLabel, node.Name, err))
+				continue
+			}
+		}
+		if nodeStatus, ok := nodeStatuses[node.Name]; ok {
+			if err := p.uncordon(ctx, devConfig, node, nodeStatus); err != nil {
+				errs = errors.Join(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+func (p *partitioner) getAgentPod(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, node *v1.Node) (*v1.Pod, error) {
+	pods := v1.PodList{}
+	err := p.client.List(ctx, &pods, client.InNamespace(devConfig.Namespace),
+		client.MatchingLabels(GetAgentPodLabels(devConfig)), client.MatchingFields{upgrade.PodNodeNameField: node.Name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partition agent pods: %v", err)
+	}
+	// the pods of a previous profile are ignored until they are replaced by the DaemonSet
+	for i := range pods.Items {
+		if pods.Items[i].DeletionTimestamp == nil && getAgentProfile(&pods.Items[i]) == GetProfile(devConfig.Spec.Partitioning) {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// getAgentProfile returns the profile applied by the agent pod
+func getAgentProfile(pod *v1.Pod) string {
+	spec := amdv1alpha1.PartitioningSpec{}
+	for _, container := range pod.Spec.Containers {
+		if container.Name != agentContainerName {
+			continue
+		}
+		for _, env := range container.Env {
+			switch env.Name {
+			case computePartitionEnv:
+				spec.ComputePartition = amdv1alpha1.ComputePartition(env.Value)
+			case memoryPartitionEnv:
+				spec.MemoryPartition = amdv1alpha1.MemoryPartition(env.Value)
+			}
+		}
+	}
+	return GetProfile(&spec)
+}
+
+// restartNodeLabeller deletes the node labeller pods of the node, so that their replacements label the node
+// with the new partitions
+func (p *partitioner) restartNodeLabeller(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, node *v1.Node) error {
+	if !nodelabeller.IsEnabled(devConfig) {
+		return nil
+	}
+	pods := v1.PodList{}
+	err := p.client.List(ctx, &pods, client.InNamespace(devConfig.Namespace),
+		client.MatchingLabels(nodelabeller.GetNodeLabellerPodLabels(devConfig)), client.MatchingFields{upgrade.PodNodeNameField: node.Name})
+	if err != nil {
+		return fmt.Errorf("failed to list node labeller pods: %v", err)
+	}
+	var errs error
+	for i := range pods.Items {
+		if err := p.client.Delete(ctx, &pods.Items[i]); err != nil && !k8serrors.IsNotFound(err) {
+			errs = errors.Join(errs, fmt.Errorf("failed to delete node labeller pod %s: %v", pods.Items[i].Name, err))
+		}
+	}
+	return errs
+}
+
+func (p *partitioner) setProfileLabel(ctx context.Context, node *v1.Node, profile string) error {
+	if node.Labels[ProfileLabel] == profile {
+		return nil
+	}
+	nodeCopy := node.DeepCopy()
+	if node.Labels == nil {
+		node.Labels = map[string]string{}
+	}
+	node.Labels[ProfileLabel] = profile
+	if err := p.client.Patch(ctx, node, client.MergeFrom(nodeCopy)); err != nil {
+		return fmt.Errorf("failed to update label %s of node %s: %v", ProfileLabel, node.Name, err)
+	}
+	return nil
+}
+
+// hasPartitions returns true if the partitions published by the node labeller are the ones of the spec
+func hasPartitions(node *v1.Node, spec *amdv1alpha1.PartitioningSpec) bool {
+	partitions, ok := node.Labels[computeMemoryPartitionLabel]
+	if !ok {
+		return false
+	}
+	compute, memory, _ := strings.Cut(partitions, "_")
+	return strings.EqualFold(compute, string(spec.ComputePartition)) &&
+		(spec.MemoryPartition == "" || strings.EqualFold(memory, string(spec.MemoryPartition)))
+}
+
+func isInProgress(nodeStatus amdv1alpha1.NodePartitionStatus) bool {
+	return nodeStatus.State == amdv1alpha1.PartitionStateDrain || nodeStatus.State == amdv1alpha1.PartitionStateApply
+}
+
+func isPodReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// hasAgentFailed returns true once the agent container exited with an error, e.g. on GPUs that do not
+// support the profile
+func hasAgentFailed(pod *v1.Pod) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != agentContainerName {
+			continue
+		}
+		if status.RestartCount > 0 {
+			return true
+		}
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func setState(nodeStatus *amdv1alpha1.NodePartitionStatus, state, message string) {
+	nodeStatus.State = state
+	nodeStatus.Message = message
+	nodeStatus.LastTransitionTime = metav1.Now()
+}
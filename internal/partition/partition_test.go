@@ -0,0 +1,389 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package partition
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	mock_client "github.com/yevgeny-shnaidman/amd-gpu-operator/internal/client"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/upgrade"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/utils"
+	"go.uber.org/mock/gomock"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	devConfigName      = "devConfigName"
+	devConfigNamespace = "devConfigNamespace"
+)
+
+var _ = Describe("GetProfile", func() {
+	It("compute partition only", func() {
+		Expect(GetProfile(&amdv1alpha1.PartitioningSpec{ComputePartition: "CPX"})).To(Equal("CPX"))
+	})
+
+	It("compute and memory partitions", func() {
+		Expect(GetProfile(&amdv1alpha1.PartitioningSpec{ComputePartition: "CPX", MemoryPartition: "NPS4"})).To(Equal("CPX-NPS4"))
+	})
+})
+
+var _ = Describe("SetAgentDaemonSetAsDesired", func() {
+	var p Partitioner
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(amdv1alpha1.AddToScheme(scheme)).To(Succeed())
+		p = NewPartitioner(nil, scheme)
+	})
+
+	It("partitioning not set", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace}}
+
+		err := p.SetAgentDaemonSetAsDesired(&appsv1.DaemonSet{}, devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("agent only runs on the nodes labelled with the profile", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				Partitioning: &amdv1alpha1.PartitioningSpec{ComputePartition: "CPX", MemoryPartition: "NPS4"},
+			},
+		}
+		ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: devConfigName + "-partition-agent", Namespace: devConfigNamespace}}
+
+		err := p.SetAgentDaemonSetAsDesired(ds, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		podSpec := ds.Spec.Template.Spec
+		Expect(podSpec.NodeSelector).To(HaveKeyWithValue(ProfileLabel, "CPX-NPS4"))
+		for k, v := range utils.GetOperandsNodeSelector(devConfig) {
+			Expect(podSpec.NodeSelector).To(HaveKeyWithValue(k, v))
+		}
+		Expect(podSpec.Containers).To(HaveLen(1))
+		Expect(podSpec.Containers[0].Image).To(Equal(agentImage))
+		Expect(podSpec.Containers[0].Env).To(ConsistOf(
+			v1.EnvVar{Name: computePartitionEnv, Value: "CPX"},
+			v1.EnvVar{Name: memoryPartitionEnv, Value: "NPS4"},
+		))
+		Expect(ds.OwnerReferences).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("HandlePartitioning", func() {
+	var (
+		kubeClient *mock_client.MockClient
+		p          Partitioner
+	)
+
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		p = NewPartitioner(kubeClient, nil)
+	})
+
+	ctx := context.Background()
+	newDevConfig := func(nodePartitions ...amdv1alpha1.NodePartitionStatus) *amdv1alpha1.DeviceConfig {
+		return &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				Partitioning: &amdv1alpha1.PartitioningSpec{ComputePartition: "CPX"},
+			},
+			Status: amdv1alpha1.DeviceConfigStatus{NodePartitions: nodePartitions},
+		}
+	}
+	newNode := func(name string, labels map[string]string) v1.Node {
+		return v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	newAgentPod := func(ready bool, restartCount int32) v1.Pod {
+		status := v1.ConditionFalse
+		if ready {
+			status = v1.ConditionTrue
+		}
+		return v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: devConfigNamespace, Name: "agent"},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{
+					{Name: agentContainerName, Env: []v1.EnvVar{{Name: computePartitionEnv, Value: "CPX"}}},
+				},
+			},
+			Status: v1.PodStatus{
+				Conditions:        []v1.PodCondition{{Type: v1.PodReady, Status: status}},
+				ContainerStatuses: []v1.ContainerStatus{{Name: agentContainerName, RestartCount: restartCount}},
+			},
+		}
+	}
+	expectNodes := func(nodes ...v1.Node) *gomock.Call {
+		return kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+			func(_ interface{}, list *v1.NodeList, _ ...client.ListOption) {
+				list.Items = nodes
+			},
+		)
+	}
+	expectPods := func(pods ...v1.Pod) *gomock.Call {
+		return kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Do(
+			func(_ interface{}, list *v1.PodList, _ ...client.ListOption) {
+				list.Items = pods
+			},
+		)
+	}
+
+	It("no partitioning profile", func() {
+		devConfig := newDevConfig()
+		devConfig.Spec.Partitioning = nil
+
+		inProgress, err := p.HandlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodePartitions).To(BeNil())
+	})
+
+	It("partitioning profile removed, nodes are unlabelled and uncordoned", func() {
+		devConfig := newDevConfig(
+			amdv1alpha1.NodePartitionStatus{NodeName: "node1", State: amdv1alpha1.PartitionStateDone, Profile: "CPX"},
+			amdv1alpha1.NodePartitionStatus{NodeName: "node2", State: amdv1alpha1.PartitionStateFailed, Profile: "CPX", Cordoned: true},
+		)
+		devConfig.Spec.Partitioning = nil
+		node2 := newNode("node2", nil)
+		node2.Spec.Unschedulable = true
+
+		gomock.InOrder(
+			expectNodes(newNode("node1", map[string]string{ProfileLabel: "CPX"}), node2),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Name).To(Equal("node1"))
+					Expect(node.Labels).ToNot(HaveKey(ProfileLabel))
+				},
+			),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Name).To(Equal("node2"))
+					Expect(node.Spec.Unschedulable).To(BeFalse())
+				},
+			),
+		)
+
+		inProgress, err := p.HandlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodePartitions).To(BeNil())
+	})
+
+	It("node already partitioned", func() {
+		devConfig := newDevConfig()
+
+		expectNodes(newNode("node1", map[string]string{ProfileLabel: "CPX"}))
+
+		inProgress, err := p.HandlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodePartitions).To(HaveLen(1))
+		Expect(devConfig.Status.NodePartitions[0].State).To(Equal(amdv1alpha1.PartitionStateDone))
+	})
+
+	It("node already in the requested partitions is labelled without being drained", func() {
+		devConfig := newDevConfig()
+		devConfig.Spec.Partitioning.MemoryPartition = "NPS4"
+
+		gomock.InOrder(
+			expectNodes(newNode("node1", map[string]string{computeMemoryPartitionLabel: "cpx_nps4"})),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Labels).To(HaveKeyWithValue(ProfileLabel, "CPX-NPS4"))
+					Expect(node.Spec.Unschedulable).To(BeFalse())
+				},
+			),
+		)
+
+		inProgress, err := p.HandlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodePartitions).To(HaveLen(1))
+		Expect(devConfig.Status.NodePartitions[0].State).To(Equal(amdv1alpha1.PartitionStateDone))
+	})
+
+	It("partitioning starts on one node at a time", func() {
+		devConfig := newDevConfig()
+
+		gomock.InOrder(
+			expectNodes(newNode("node2", nil), newNode("node1", nil)),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Name).To(Equal("node1"))
+					Expect(node.Spec.Unschedulable).To(BeTrue())
+				},
+			),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Labels).To(HaveKeyWithValue(ProfileLabel, "CPX"))
+				},
+			),
+		)
+
+		inProgress, err := p.HandlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(devConfig.Status.NodePartitions).To(HaveLen(1))
+		Expect(devConfig.Status.NodePartitions[0].NodeName).To(Equal("node1"))
+		Expect(devConfig.Status.NodePartitions[0].State).To(Equal(amdv1alpha1.PartitionStateApply))
+		Expect(devConfig.Status.NodePartitions[0].Cordoned).To(BeTrue())
+	})
+
+	It("profile applied, node labeller is restarted and node is uncordoned", func() {
+		devConfig := newDevConfig(amdv1alpha1.NodePartitionStatus{NodeName: "node1", State: amdv1alpha1.PartitionStateApply, Profile: "CPX", Cordoned: true})
+		node := newNode("node1", map[string]string{ProfileLabel: "CPX"})
+		node.Spec.Unschedulable = true
+		nodeLabellerPod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: devConfigNamespace, Name: "node-labeller"}}
+
+		gomock.InOrder(
+			expectNodes(node),
+			expectPods(newAgentPod(true, 0)),
+			expectPods(nodeLabellerPod),
+			kubeClient.EXPECT().Delete(ctx, &nodeLabellerPod).Return(nil),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Spec.Unschedulable).To(BeFalse())
+				},
+			),
+		)
+
+		inProgress, err := p.HandlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodePartitions[0].State).To(Equal(amdv1alpha1.PartitionStateDone))
+	})
+
+	It("profile applied, node cordoned before the partitioning stays cordoned", func() {
+		devConfig := newDevConfig(amdv1alpha1.NodePartitionStatus{NodeName: "node1", State: amdv1alpha1.PartitionStateApply, Profile: "CPX"})
+		devConfig.Spec.NodeLabeller.Enable = pointer.Bool(false)
+		node := newNode("node1", map[string]string{ProfileLabel: "CPX"})
+		node.Spec.Unschedulable = true
+
+		gomock.InOrder(
+			expectNodes(node),
+			expectPods(newAgentPod(true, 0)),
+		)
+
+		inProgress, err := p.HandlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodePartitions[0].State).To(Equal(amdv1alpha1.PartitionStateDone))
+	})
+
+	It("node upgrading drivers is not partitioned until the upgrade is done", func() {
+		devConfig := newDevConfig()
+		devConfig.Status.NodeUpgrades = []amdv1alpha1.NodeUpgradeStatus{{NodeName: "node1", State: amdv1alpha1.UpgradeStateDrain}}
+
+		expectNodes(newNode("node1", nil))
+
+		inProgress, err := p.HandlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(devConfig.Status.NodePartitions).To(BeEmpty())
+	})
+
+	It("drivers upgrade and partitioning target the same node", func() {
+		devConfig := newDevConfig()
+		devConfig.Spec.DriversVersion = "v2"
+		devConfig.Spec.UpgradePolicy = &amdv1alpha1.UpgradePolicySpec{}
+		versionLabel := "kmm.node.kubernetes.io/version-module." + devConfigNamespace + "." + devConfigName
+		node := newNode("node1", map[string]string{versionLabel: "v1"})
+		um := upgrade.NewUpgradeManager(kubeClient)
+
+		gomock.InOrder(
+			expectNodes(node),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Spec.Unschedulable).To(BeTrue())
+				},
+			),
+			expectNodes(node),
+		)
+
+		upgradeInProgress, err := um.HandleUpgrade(ctx, devConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(upgradeInProgress).To(BeTrue())
+
+		inProgress, err := p.HandlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(devConfig.Status.NodeUpgrades[0].State).To(Equal(amdv1alpha1.UpgradeStateDrain))
+		Expect(devConfig.Status.NodePartitions).To(BeEmpty())
+	})
+
+	It("profile applied, node cordoned by a failed drivers upgrade stays cordoned", func() {
+		devConfig := newDevConfig(amdv1alpha1.NodePartitionStatus{NodeName: "node1", State: amdv1alpha1.PartitionStateApply, Profile: "CPX", Cordoned: true})
+		devConfig.Spec.NodeLabeller.Enable = pointer.Bool(false)
+		node := newNode("node1", map[string]string{ProfileLabel: "CPX", upgrade.UpgradeStateLabel: amdv1alpha1.UpgradeStateFailed})
+		node.Spec.Unschedulable = true
+
+		gomock.InOrder(
+			expectNodes(node),
+			expectPods(newAgentPod(true, 0)),
+		)
+
+		inProgress, err := p.HandlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodePartitions[0].State).To(Equal(amdv1alpha1.PartitionStateDone))
+	})
+
+	It("partition agent failed", func() {
+		devConfig := newDevConfig(amdv1alpha1.NodePartitionStatus{NodeName: "node1", State: amdv1alpha1.PartitionStateApply, Profile: "CPX"})
+		devConfig.Spec.NodeLabeller.Enable = pointer.Bool(false)
+
+		gomock.InOrder(
+			expectNodes(newNode("node1", map[string]string{ProfileLabel: "CPX"})),
+			expectPods(newAgentPod(false, 1)),
+		)
+
+		inProgress, err := p.HandlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodePartitions[0].State).To(Equal(amdv1alpha1.PartitionStateFailed))
+
+		// the node stays failed until the profile changes
+		expectNodes(newNode("node1", map[string]string{ProfileLabel: "CPX"}))
+
+		inProgress, err = p.HandlePartitioning(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodePartitions[0].State).To(Equal(amdv1alpha1.PartitionStateFailed))
+	})
+})
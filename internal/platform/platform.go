@@ -0,0 +1,60 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/discovery"
+)
+
+// Platform is the flavour of the cluster the operator runs on
+type Platform string
+
+const (
+	OpenShift  Platform = "openshift"
+	Kubernetes Platform = "kubernetes"
+
+	// openShiftConfigAPIGroup is only served by OpenShift clusters
+	openShiftConfigAPIGroup = "config.openshift.io"
+)
+
+// Parse returns the platform named by name. An empty name returns an empty platform,
+// meaning that the platform should be detected
+func Parse(name string) (Platform, error) {
+	switch p := Platform(name); p {
+	case "", OpenShift, Kubernetes:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown platform %q, must be one of %s and %s", name, OpenShift, Kubernetes)
+	}
+}
+
+// Detect returns OpenShift if the cluster serves the OpenShift config API group, and Kubernetes otherwise
+func Detect(dc discovery.ServerGroupsInterface) (Platform, error) {
+	groups, err := dc.ServerGroups()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the API groups of the cluster: %v", err)
+	}
+
+	for _, group := range groups.Groups {
+		if group.Name == openShiftConfigAPIGroup {
+			return OpenShift, nil
+		}
+	}
+	return Kubernetes, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeServerGroups struct {
+	groups []string
+	err    error
+}
+
+func (f *fakeServerGroups) ServerGroups() (*metav1.APIGroupList, error) {
+	groupList := &metav1.APIGroupList{}
+	for _, group := range f.groups {
+		groupList.Groups = append(groupList.Groups, metav1.APIGroup{Name: group})
+	}
+	return groupList, f.err
+}
+
+var _ = Describe("Detect", func() {
+	It("OpenShift cluster", func() {
+		p, err := Detect(&fakeServerGroups{groups: []string{"apps", "config.openshift.io"}})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal(OpenShift))
+	})
+
+	It("Kubernetes cluster", func() {
+		p, err := Detect(&fakeServerGroups{groups: []string{"apps", "kmm.sigs.x-k8s.io"}})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal(Kubernetes))
+	})
+
+	It("failed to get the API groups", func() {
+		_, err := Detect(&fakeServerGroups{err: fmt.Errorf("some error")})
+
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Parse", func() {
+	DescribeTable("platform names", func(name string, expectedPlatform Platform, expectError bool) {
+		p, err := Parse(name)
+		if expectError {
+			Expect(err).To(HaveOccurred())
+			return
+		}
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal(expectedPlatform))
+	},
+		Entry("empty name", "", Platform(""), false),
+		Entry("openshift", "openshift", OpenShift, false),
+		Entry("kubernetes", "kubernetes", Kubernetes, false),
+		Entry("unknown", "openstack", Platform(""), true),
+	)
+})
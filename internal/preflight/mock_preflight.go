@@ -0,0 +1,71 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: preflight.go
+//
+// Generated by this command:
+//
+//	mockgen -source=preflight.go -package=preflight -destination=mock_preflight.go PreflightManager
+//
+// Package preflight is a generated GoMock package.
+package preflight
+
+import (
+	context "context"
+	reflect "reflect"
+
+	v1beta1 "github.com/rh-ecosystem-edge/kernel-module-management/api/v1beta1"
+	v1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	gomock "go.uber.org/mock/gomock"
+	v1 "k8s.io/api/core/v1"
+)
+
+// MockPreflightManager is a mock of PreflightManager interface.
+type MockPreflightManager struct {
+	ctrl     *gomock.Controller
+	recorder *MockPreflightManagerMockRecorder
+}
+
+// MockPreflightManagerMockRecorder is the mock recorder for MockPreflightManager.
+type MockPreflightManagerMockRecorder struct {
+	mock *MockPreflightManager
+}
+
+// NewMockPreflightManager creates a new mock instance.
+func NewMockPreflightManager(ctrl *gomock.Controller) *MockPreflightManager {
+	mock := &MockPreflightManager{ctrl: ctrl}
+	mock.recorder = &MockPreflightManagerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPreflightManager) EXPECT() *MockPreflightManagerMockRecorder {
+	return m.recorder
+}
+
+// DeleteValidation mocks base method.
+func (m *MockPreflightManager) DeleteValidation(ctx context.Context, devConfig *v1alpha1.DeviceConfig) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteValidation", ctx, devConfig)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteValidation indicates an expected call of DeleteValidation.
+func (mr *MockPreflightManagerMockRecorder) DeleteValidation(ctx, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteValidation", reflect.TypeOf((*MockPreflightManager)(nil).DeleteValidation), ctx, devConfig)
+}
+
+// ValidateModule mocks base method.
+func (m *MockPreflightManager) ValidateModule(ctx context.Context, devConfig *v1alpha1.DeviceConfig, mod *v1beta1.Module, nodes []v1.Node) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateModule", ctx, devConfig, mod, nodes)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ValidateModule indicates an expected call of ValidateModule.
+func (mr *MockPreflightManagerMockRecorder) ValidateModule(ctx, devConfig, mod, nodes any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateModule", reflect.TypeOf((*MockPreflightManager)(nil).ValidateModule), ctx, devConfig, mod, nodes)
+}
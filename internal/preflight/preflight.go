@@ -0,0 +1,308 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package preflight
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	kmmv1beta1 "github.com/rh-ecosystem-edge/kernel-module-management/api/v1beta1"
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	devConfigNamespaceLabel = "amd.io/deviceconfig-namespace"
+	devConfigNameLabel      = "amd.io/deviceconfig-name"
+
+	// the candidate Module selects no nodes, it only exists to be validated by KMM
+	candidateSelectorLabel = "amd.io/preflight-candidate"
+	candidateModuleSuffix  = "-preflight"
+
+	maxValidationNameLength = 253
+	validationHashLength    = 8
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+//go:generate mockgen -source=preflight.go -package=preflight -destination=mock_preflight.go PreflightManager
+type PreflightManager interface {
+	ValidateModule(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, mod *kmmv1beta1.Module, nodes []v1.Node) (bool, error)
+	DeleteValidation(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error
+}
+
+type preflightManager struct {
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+func NewPreflightManager(client client.Client, scheme *runtime.Scheme) PreflightManager {
+	return &preflightManager{
+		client: client,
+		scheme: scheme,
+	}
+}
+
+// GetCandidateModuleName returns the name of the KMM Module validated by the PreflightValidations
+func GetCandidateModuleName(devConfig *amdv1alpha1.DeviceConfig) string {
+	return devConfig.Name + candidateModuleSuffix
+}
+
+// GetValidationLabels returns the labels of the PreflightValidations of the DeviceConfig
+func GetValidationLabels(devConfig *amdv1alpha1.DeviceConfig) map[string]string {
+	return map[string]string{
+		devConfigNamespaceLabel: devConfig.Namespace,
+		devConfigNameLabel:      devConfig.Name,
+	}
+}
+
+// GetDeviceConfigRequests maps a PreflightValidation to the DeviceConfig that created it
+func GetDeviceConfigRequests(_ context.Context, obj client.Object) []reconcile.Request {
+	namespace, name := obj.GetLabels()[devConfigNamespaceLabel], obj.GetLabels()[devConfigNameLabel]
+	if namespace == "" || name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}}
+}
+
+// ValidateModule validates mod, the desired KMM Module, against every kernel of the nodes with one
+// PreflightValidation per kernel, and records the results in the DeviceConfig status. The status is only
+// updated in devConfig, it is up to the caller to persist it. It returns true once the drivers version
+// was validated for all the kernels
+func (pm *preflightManager) ValidateModule(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, mod *kmmv1beta1.Module, nodes []v1.Node) (bool, error) {
+	kernels := getKernels(nodes)
+	candidateSpec := getCandidateSpec(devConfig, mod)
+	moduleHash, err := getModuleHash(candidateSpec)
+	if err != nil {
+		return false, err
+	}
+	status := devConfig.Status.Preflight
+	if status == nil || status.DriversVersion != devConfig.Spec.DriversVersion || status.ModuleHash != moduleHash ||
+		!hasKernels(status, kernels) {
+		// a new drivers version, a change of the Module or a new kernel restarts the validation
+		status = &amdv1alpha1.PreflightStatus{
+			DriversVersion: devConfig.Spec.DriversVersion,
+			ModuleHash:     moduleHash,
+			State:          amdv1alpha1.PreflightStateRunning,
+		}
+		for _, kernel := range kernels {
+			status.Kernels = append(status.Kernels, amdv1alpha1.PreflightKernelStatus{Kernel: kernel})
+		}
+		devConfig.Status.Preflight = status
+	}
+
+	switch status.State {
+	case amdv1alpha1.PreflightStateSucceeded:
+		return true, nil
+	case amdv1alpha1.PreflightStateFailed:
+		return false, nil
+	}
+
+	if err := pm.setCandidateModule(ctx, devConfig, candidateSpec); err != nil {
+		return false, err
+	}
+
+	desiredNames := map[string]bool{}
+	pending, failed := false, false
+	for i := range status.Kernels {
+		kernelStatus := &status.Kernels[i]
+		pfv := &kmmv1beta1.PreflightValidation{
+			ObjectMeta: metav1.ObjectMeta{Name: getValidationName(devConfig, moduleHash, kernelStatus.Kernel)},
+		}
+		desiredNames[pfv.Name] = true
+		_, err := controllerutil.CreateOrPatch(ctx, pm.client, pfv, func() error {
+			if pfv.Labels == nil {
+				pfv.Labels = map[string]string{}
+			}
+			for k, v := range GetValidationLabels(devConfig) {
+				pfv.Labels[k] = v
+			}
+			pfv.Spec.KernelVersion = kernelStatus.Kernel
+			pfv.Spec.PushBuiltImage = devConfig.Spec.Driver.Preflight.PushBuiltImage
+			return nil
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to create or patch PreflightValidation %s: %v", pfv.Name, err)
+		}
+
+		crStatus := getCRStatus(pfv, devConfig)
+		if crStatus == nil {
+			pending = true
+			continue
+		}
+		kernelStatus.VerificationStatus = crStatus.VerificationStatus
+		kernelStatus.VerificationStage = crStatus.VerificationStage
+		kernelStatus.Reason = crStatus.StatusReason
+		switch {
+		case crStatus.VerificationStatus == kmmv1beta1.VerificationTrue:
+		case crStatus.VerificationStage == kmmv1beta1.VerificationStageDone:
+			failed = true
+		default:
+			pending = true
+		}
+	}
+
+	// validations of a previous Module or of kernels that are no longer used
+	if err := pm.deleteValidations(ctx, devConfig, desiredNames); err != nil {
+		return false, err
+	}
+
+	if pending && !failed {
+		return false, nil
+	}
+
+	log.FromContext(ctx).Info("preflight validation completed", "driversVersion", status.DriversVersion, "failed", failed)
+	if err := pm.DeleteValidation(ctx, devConfig); err != nil {
+		return false, err
+	}
+	if failed {
+		status.State = amdv1alpha1.PreflightStateFailed
+		return false, nil
+	}
+	status.State = amdv1alpha1.PreflightStateSucceeded
+	return true, nil
+}
+
+// DeleteValidation deletes the PreflightValidations and the candidate KMM Module of the DeviceConfig
+func (pm *preflightManager) DeleteValidation(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error {
+	if err := pm.deleteValidations(ctx, devConfig, nil); err != nil {
+		return err
+	}
+
+	candidate := &kmmv1beta1.Module{
+		ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: GetCandidateModuleName(devConfig)},
+	}
+	if err := pm.client.Delete(ctx, candidate); err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete preflight KMM Module %s: %v", candidate.Name, err)
+	}
+	return nil
+}
+
+func (pm *preflightManager) setCandidateModule(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, spec kmmv1beta1.ModuleSpec) error {
+	candidate := &kmmv1beta1.Module{
+		ObjectMeta: metav1.ObjectMeta{Namespace: devConfig.Namespace, Name: GetCandidateModuleName(devConfig)},
+	}
+	_, err := controllerutil.CreateOrPatch(ctx, pm.client, candidate, func() error {
+		candidate.Spec = *spec.DeepCopy()
+		return controllerutil.SetControllerReference(devConfig, candidate, pm.scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create or patch preflight KMM Module %s: %v", candidate.Name, err)
+	}
+	return nil
+}
+
+// getCandidateSpec returns the spec of the candidate Module validating mod, which loads the drivers on no node
+func getCandidateSpec(devConfig *amdv1alpha1.DeviceConfig, mod *kmmv1beta1.Module) kmmv1beta1.ModuleSpec {
+	spec := *mod.Spec.DeepCopy()
+	spec.Selector = map[string]string{candidateSelectorLabel: devConfig.Name}
+	spec.DevicePlugin = nil
+	spec.ModuleLoader.Container.Version = ""
+	return spec
+}
+
+// getModuleHash returns the hash of the candidate Module spec, identifying what is validated
+func getModuleHash(spec kmmv1beta1.ModuleSpec) (string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal the preflight KMM Module spec: %v", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// deleteValidations deletes the PreflightValidations of the DeviceConfig, except the ones in keepNames
+func (pm *preflightManager) deleteValidations(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, keepNames map[string]bool) error {
+	pfvList := kmmv1beta1.PreflightValidationList{}
+	if err := pm.client.List(ctx, &pfvList, client.MatchingLabels(GetValidationLabels(devConfig))); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to list PreflightValidations: %v", err)
+	}
+	for i := range pfvList.Items {
+		pfv := &pfvList.Items[i]
+		if keepNames[pfv.Name] {
+			continue
+		}
+		if err := pm.client.Delete(ctx, pfv); err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete PreflightValidation %s: %v", pfv.Name, err)
+		}
+	}
+	return nil
+}
+
+// getCRStatus returns the verification status of the candidate Module, which KMM keys either by the
+// Module name or by its namespaced name
+func getCRStatus(pfv *kmmv1beta1.PreflightValidation, devConfig *amdv1alpha1.DeviceConfig) *kmmv1beta1.CRStatus {
+	name := GetCandidateModuleName(devConfig)
+	if crStatus, ok := pfv.Status.CRStatuses[name]; ok {
+		return crStatus
+	}
+	return pfv.Status.CRStatuses[devConfig.Namespace+"/"+name]
+}
+
+// getValidationName returns the name of the cluster scoped PreflightValidation of a Module and a kernel
+func getValidationName(devConfig *amdv1alpha1.DeviceConfig, moduleHash, kernel string) string {
+	name := strings.ToLower(fmt.Sprintf("amd-gpu-%s-%s-%s-%s-%s", devConfig.Namespace, devConfig.Name, devConfig.Spec.DriversVersion,
+		moduleHash[:validationHashLength], kernel))
+	name = invalidNameChars.ReplaceAllString(name, "-")
+	if len(name) > maxValidationNameLength {
+		name = name[:maxValidationNameLength]
+	}
+	return strings.TrimRight(name, ".-")
+}
+
+func getKernels(nodes []v1.Node) []string {
+	unique := map[string]bool{}
+	for _, node := range nodes {
+		if kernel := node.Status.NodeInfo.KernelVersion; kernel != "" {
+			unique[kernel] = true
+		}
+	}
+	kernels := make([]string, 0, len(unique))
+	for kernel := range unique {
+		kernels = append(kernels, kernel)
+	}
+	sort.Strings(kernels)
+	return kernels
+}
+
+func hasKernels(status *amdv1alpha1.PreflightStatus, kernels []string) bool {
+	if len(status.Kernels) != len(kernels) {
+		return false
+	}
+	for i := range kernels {
+		if status.Kernels[i].Kernel != kernels[i] {
+			return false
+		}
+	}
+	return true
+}
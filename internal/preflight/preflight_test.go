@@ -0,0 +1,281 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package preflight
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kmmv1beta1 "github.com/rh-ecosystem-edge/kernel-module-management/api/v1beta1"
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	mock_client "github.com/yevgeny-shnaidman/amd-gpu-operator/internal/client"
+	"go.uber.org/mock/gomock"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	devConfigName      = "devConfigName"
+	devConfigNamespace = "devConfigNamespace"
+)
+
+var _ = Describe("ValidateModule", func() {
+	var (
+		kubeClient *mock_client.MockClient
+		pm         PreflightManager
+	)
+
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		scheme := runtime.NewScheme()
+		Expect(amdv1alpha1.AddToScheme(scheme)).To(Succeed())
+		pm = NewPreflightManager(kubeClient, scheme)
+	})
+
+	ctx := context.Background()
+	notFound := k8serrors.NewNotFound(schema.GroupResource{}, "name")
+	newDevConfig := func() *amdv1alpha1.DeviceConfig {
+		return &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				DriversVersion: "6.2",
+				Driver: amdv1alpha1.DriverSpec{
+					Preflight: amdv1alpha1.PreflightSpec{Enable: true, PushBuiltImage: true},
+				},
+			},
+		}
+	}
+	newNode := func(name, kernel string) v1.Node {
+		return v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{KernelVersion: kernel}},
+		}
+	}
+	mod := &kmmv1beta1.Module{
+		ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace},
+		Spec: kmmv1beta1.ModuleSpec{
+			Selector:     map[string]string{"feature.node.kubernetes.io/amd-gpu": "true"},
+			DevicePlugin: &kmmv1beta1.DevicePluginSpec{},
+		},
+	}
+	nodes := []v1.Node{newNode("node1", "5.15.0-91-generic"), newNode("node2", "5.15.0-91-generic"), newNode("node3", "5.14.0-284.el9.x86_64")}
+	candidateNN := types.NamespacedName{Name: devConfigName + "-preflight", Namespace: devConfigNamespace}
+	moduleHash, err := getModuleHash(getCandidateSpec(newDevConfig(), mod))
+	Expect(err).ToNot(HaveOccurred())
+	pfvNN1 := types.NamespacedName{Name: getValidationName(newDevConfig(), moduleHash, "5.14.0-284.el9.x86_64")}
+	pfvNN2 := types.NamespacedName{Name: getValidationName(newDevConfig(), moduleHash, "5.15.0-91-generic")}
+	expectValidation := func(nn types.NamespacedName, crStatus *kmmv1beta1.CRStatus) *gomock.Call {
+		return kubeClient.EXPECT().Get(ctx, nn, gomock.Any()).Do(
+			func(_ interface{}, _ types.NamespacedName, pfv *kmmv1beta1.PreflightValidation, _ ...client.GetOption) {
+				pfv.Name = nn.Name
+				pfv.Spec.KernelVersion = "old"
+				if crStatus != nil {
+					pfv.Status.CRStatuses = map[string]*kmmv1beta1.CRStatus{candidateNN.Name: crStatus}
+				}
+			},
+		)
+	}
+
+	It("new drivers version, validations are created", func() {
+		devConfig := newDevConfig()
+		devConfig.Status.Preflight = &amdv1alpha1.PreflightStatus{DriversVersion: "6.1", State: amdv1alpha1.PreflightStateSucceeded}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, candidateNN, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Do(
+				func(_ interface{}, candidate *kmmv1beta1.Module, _ ...client.CreateOption) {
+					Expect(candidate.Spec.Selector).To(HaveKeyWithValue(candidateSelectorLabel, devConfigName))
+					Expect(candidate.Spec.DevicePlugin).To(BeNil())
+					Expect(candidate.OwnerReferences).To(HaveLen(1))
+				},
+			),
+			kubeClient.EXPECT().Get(ctx, pfvNN1, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Do(
+				func(_ interface{}, pfv *kmmv1beta1.PreflightValidation, _ ...client.CreateOption) {
+					Expect(pfv.Spec.KernelVersion).To(Equal("5.14.0-284.el9.x86_64"))
+					Expect(pfv.Spec.PushBuiltImage).To(BeTrue())
+					Expect(pfv.Labels).To(Equal(GetValidationLabels(devConfig)))
+				},
+			),
+			kubeClient.EXPECT().Get(ctx, pfvNN2, gomock.Any()).Return(notFound),
+			kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, list *kmmv1beta1.PreflightValidationList, _ ...client.ListOption) {
+					list.Items = []kmmv1beta1.PreflightValidation{
+						{ObjectMeta: metav1.ObjectMeta{Name: pfvNN1.Name}},
+						{ObjectMeta: metav1.ObjectMeta{Name: "amd-gpu-devconfignamespace-devconfigname-6.1-5.15.0-91-generic"}},
+					}
+				},
+			),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Do(
+				func(_ interface{}, pfv *kmmv1beta1.PreflightValidation, _ ...client.DeleteOption) {
+					Expect(pfv.Name).To(HaveSuffix("6.1-5.15.0-91-generic"))
+				},
+			),
+		)
+
+		validated, err := pm.ValidateModule(ctx, devConfig, mod, nodes)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(validated).To(BeFalse())
+		Expect(devConfig.Status.Preflight).To(Equal(&amdv1alpha1.PreflightStatus{
+			DriversVersion: "6.2",
+			ModuleHash:     moduleHash,
+			State:          amdv1alpha1.PreflightStateRunning,
+			Kernels: []amdv1alpha1.PreflightKernelStatus{
+				{Kernel: "5.14.0-284.el9.x86_64"},
+				{Kernel: "5.15.0-91-generic"},
+			},
+		}))
+	})
+
+	It("all kernels validated, validations are deleted", func() {
+		devConfig := newDevConfig()
+		devConfig.Status.Preflight = &amdv1alpha1.PreflightStatus{
+			DriversVersion: "6.2",
+			ModuleHash:     moduleHash,
+			State:          amdv1alpha1.PreflightStateRunning,
+			Kernels:        []amdv1alpha1.PreflightKernelStatus{{Kernel: "5.14.0-284.el9.x86_64"}, {Kernel: "5.15.0-91-generic"}},
+		}
+		verified := &kmmv1beta1.CRStatus{VerificationStatus: kmmv1beta1.VerificationTrue, VerificationStage: kmmv1beta1.VerificationStageDone}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, candidateNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			expectValidation(pfvNN1, verified),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			expectValidation(pfvNN2, verified),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(nil),
+		)
+
+		validated, err := pm.ValidateModule(ctx, devConfig, mod, nodes)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(validated).To(BeTrue())
+		Expect(devConfig.Status.Preflight.State).To(Equal(amdv1alpha1.PreflightStateSucceeded))
+		Expect(devConfig.Status.Preflight.Kernels[0].VerificationStatus).To(Equal(kmmv1beta1.VerificationTrue))
+	})
+
+	It("one kernel failed, the validation fails", func() {
+		devConfig := newDevConfig()
+		devConfig.Status.Preflight = &amdv1alpha1.PreflightStatus{
+			DriversVersion: "6.2",
+			ModuleHash:     moduleHash,
+			State:          amdv1alpha1.PreflightStateRunning,
+			Kernels:        []amdv1alpha1.PreflightKernelStatus{{Kernel: "5.14.0-284.el9.x86_64"}, {Kernel: "5.15.0-91-generic"}},
+		}
+		failed := &kmmv1beta1.CRStatus{
+			VerificationStatus: kmmv1beta1.VerificationFalse,
+			VerificationStage:  kmmv1beta1.VerificationStageDone,
+			StatusReason:       "build failed",
+		}
+
+		gomock.InOrder(
+			kubeClient.EXPECT().Get(ctx, candidateNN, gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			expectValidation(pfvNN1, failed),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			expectValidation(pfvNN2, &kmmv1beta1.CRStatus{VerificationStatus: kmmv1beta1.VerificationFalse, VerificationStage: kmmv1beta1.VerificationStageBuild}),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil),
+			kubeClient.EXPECT().Delete(ctx, gomock.Any()).Return(notFound),
+		)
+
+		validated, err := pm.ValidateModule(ctx, devConfig, mod, nodes)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(validated).To(BeFalse())
+		Expect(devConfig.Status.Preflight.State).To(Equal(amdv1alpha1.PreflightStateFailed))
+		Expect(devConfig.Status.Preflight.Kernels[0].Reason).To(Equal("build failed"))
+		Expect(devConfig.Status.Preflight.Kernels[1].VerificationStage).To(Equal(kmmv1beta1.VerificationStageBuild))
+	})
+
+	It("Module change after a successful validation restarts the validation", func() {
+		devConfig := newDevConfig()
+		devConfig.Status.Preflight = &amdv1alpha1.PreflightStatus{
+			DriversVersion: "6.2",
+			ModuleHash:     moduleHash,
+			State:          amdv1alpha1.PreflightStateSucceeded,
+			Kernels:        []amdv1alpha1.PreflightKernelStatus{{Kernel: "5.14.0-284.el9.x86_64"}, {Kernel: "5.15.0-91-generic"}},
+		}
+		changedMod := mod.DeepCopy()
+		changedMod.Spec.ModuleLoader.Container.KernelMappings = []kmmv1beta1.KernelMapping{{Regexp: "^.+$", ContainerImage: "quay.io/ns/drivers:new"}}
+
+		kubeClient.EXPECT().Get(ctx, gomock.Any(), gomock.Any()).Return(notFound).Times(3)
+		kubeClient.EXPECT().Create(ctx, gomock.Any()).Return(nil).Times(3)
+		kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(nil)
+
+		validated, err := pm.ValidateModule(ctx, devConfig, changedMod, nodes)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(validated).To(BeFalse())
+		Expect(devConfig.Status.Preflight.State).To(Equal(amdv1alpha1.PreflightStateRunning))
+		Expect(devConfig.Status.Preflight.ModuleHash).ToNot(Equal(moduleHash))
+	})
+
+	It("the drivers version already failed validation, nothing is done", func() {
+		devConfig := newDevConfig()
+		devConfig.Status.Preflight = &amdv1alpha1.PreflightStatus{
+			DriversVersion: "6.2",
+			ModuleHash:     moduleHash,
+			State:          amdv1alpha1.PreflightStateFailed,
+			Kernels:        []amdv1alpha1.PreflightKernelStatus{{Kernel: "5.14.0-284.el9.x86_64"}, {Kernel: "5.15.0-91-generic"}},
+		}
+
+		validated, err := pm.ValidateModule(ctx, devConfig, mod, nodes)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(validated).To(BeFalse())
+	})
+})
+
+var _ = Describe("getValidationName", func() {
+	It("the name is a valid and bounded resource name", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace},
+			Spec:       amdv1alpha1.DeviceConfigSpec{DriversVersion: "6.2"},
+		}
+		Expect(getValidationName(devConfig, "0123456789abcdef", "5.14.0-284.el9.x86_64")).To(Equal("amd-gpu-devconfignamespace-devconfigname-6.2-01234567-5.14.0-284.el9.x86-64"))
+
+		devConfig.Name = strings.Repeat("a", 300)
+		Expect(len(getValidationName(devConfig, "0123456789abcdef", "kernel"))).To(BeNumerically("<=", maxValidationNameLength))
+	})
+})
+
+var _ = Describe("GetDeviceConfigRequests", func() {
+	It("maps a validation to its DeviceConfig", func() {
+		pfv := &kmmv1beta1.PreflightValidation{}
+		Expect(GetDeviceConfigRequests(context.Background(), pfv)).To(BeEmpty())
+
+		pfv.Labels = GetValidationLabels(&amdv1alpha1.DeviceConfig{ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace}})
+		requests := GetDeviceConfigRequests(context.Background(), pfv)
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].NamespacedName).To(Equal(types.NamespacedName{Name: devConfigName, Namespace: devConfigNamespace}))
+	})
+})
@@ -19,6 +19,7 @@ package test
 import (
 	hubv1beta1 "github.com/rh-ecosystem-edge/kernel-module-management/api-hub/v1beta1"
 	kmmv1beta1 "github.com/rh-ecosystem-edge/kernel-module-management/api/v1beta1"
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
@@ -31,6 +32,7 @@ func TestScheme() (*runtime.Scheme, error) {
 	funcs := []func(s *runtime.Scheme) error{
 		scheme.AddToScheme,
 		kmmv1beta1.AddToScheme,
+		amdv1alpha1.AddToScheme,
 		hubv1beta1.AddToScheme,
 		clusterv1.Install,
 		workv1.Install,
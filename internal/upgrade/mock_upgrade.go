@@ -0,0 +1,55 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: upgrade.go
+//
+// Generated by this command:
+//
+//	mockgen -source=upgrade.go -package=upgrade -destination=mock_upgrade.go UpgradeManager
+//
+// Package upgrade is a generated GoMock package.
+package upgrade
+
+import (
+	context "context"
+	reflect "reflect"
+
+	v1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockUpgradeManager is a mock of UpgradeManager interface.
+type MockUpgradeManager struct {
+	ctrl     *gomock.Controller
+	recorder *MockUpgradeManagerMockRecorder
+}
+
+// MockUpgradeManagerMockRecorder is the mock recorder for MockUpgradeManager.
+type MockUpgradeManagerMockRecorder struct {
+	mock *MockUpgradeManager
+}
+
+// NewMockUpgradeManager creates a new mock instance.
+func NewMockUpgradeManager(ctrl *gomock.Controller) *MockUpgradeManager {
+	mock := &MockUpgradeManager{ctrl: ctrl}
+	mock.recorder = &MockUpgradeManagerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUpgradeManager) EXPECT() *MockUpgradeManagerMockRecorder {
+	return m.recorder
+}
+
+// HandleUpgrade mocks base method.
+func (m *MockUpgradeManager) HandleUpgrade(ctx context.Context, devConfig *v1alpha1.DeviceConfig) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HandleUpgrade", ctx, devConfig)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HandleUpgrade indicates an expected call of HandleUpgrade.
+func (mr *MockUpgradeManagerMockRecorder) HandleUpgrade(ctx, devConfig any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleUpgrade", reflect.TypeOf((*MockUpgradeManager)(nil).HandleUpgrade), ctx, devConfig)
+}
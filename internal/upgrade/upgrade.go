@@ -0,0 +1,434 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	kmmlabels "github.com/rh-ecosystem-edge/kernel-module-management/pkg/labels"
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/utils"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// PodNodeNameField is the pods field index used to list the pods running on a node
+	PodNodeNameField = "spec.nodeName"
+
+	// UpgradeStateLabel is set to UpgradeStateFailed on the nodes left cordoned by a failed upgrade, so that
+	// they are not uncordoned by the other node operations, e.g. partitioning
+	UpgradeStateLabel = "amd.io/gpu-driver-upgrade-state"
+
+	// labels used by KMM for ordered upgrades: the operator sets the module version label to request a
+	// version on the node, and KMM sets the worker pod version label once that version is loaded
+	moduleVersionLabelTemplate    = "kmm.node.kubernetes.io/version-module.%s.%s"
+	workerPodVersionLabelTemplate = "beta.kmm.node.kubernetes.io/version-worker-pod.%s.%s"
+
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+	defaultDrainTimeout = 300 * time.Second
+)
+
+//go:generate mockgen -source=upgrade.go -package=upgrade -destination=mock_upgrade.go UpgradeManager
+type UpgradeManager interface {
+	HandleUpgrade(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) (bool, error)
+}
+
+type upgradeManager struct {
+	client client.Client
+}
+
+func NewUpgradeManager(client client.Client) UpgradeManager {
+	return &upgradeManager{
+		client: client,
+	}
+}
+
+// HandleUpgrade moves the nodes targeted by the DeviceConfig through the upgrade states, upgrading at most
+// MaxUnavailable nodes at the same time, and records the state of each node in the DeviceConfig status.
+// The status is only updated in devConfig, it is up to the caller to persist it.
+// It returns true while an upgrade is in progress on any of the nodes, and the nodes should be checked again
+func (um *upgradeManager) HandleUpgrade(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) (bool, error) {
+	policy := devConfig.Spec.UpgradePolicy
+	if policy == nil || devConfig.Spec.UseInTreeDrivers {
+		devConfig.Status.NodeUpgrades = nil
+		return false, nil
+	}
+
+	nodes := v1.NodeList{}
+	if err := um.client.List(ctx, &nodes, client.MatchingLabels(utils.GetNodeSelector(devConfig))); err != nil {
+		return false, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	sort.Slice(nodes.Items, func(i, j int) bool { return nodes.Items[i].Name < nodes.Items[j].Name })
+
+	targetVersion := devConfig.Spec.DriversVersion
+	versionLabel := fmt.Sprintf(moduleVersionLabelTemplate, devConfig.Namespace, devConfig.Name)
+	moduleReadyLabel := kmmlabels.GetKernelModuleReadyNodeLabel(devConfig.Namespace, devConfig.Name)
+
+	previousStatuses := map[string]amdv1alpha1.NodeUpgradeStatus{}
+	for _, nodeStatus := range devConfig.Status.NodeUpgrades {
+		previousStatuses[nodeStatus.NodeName] = nodeStatus
+	}
+
+	nodeStatuses := make([]amdv1alpha1.NodeUpgradeStatus, 0, len(nodes.Items))
+	candidates := []int{}
+	unavailable := 0
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		nodeStatus, found := previousStatuses[node.Name]
+		// a new version gives the failed node another chance. It stays reported as failed until it is
+		// selected, so that the cordon set by the previous attempt is still released once it is upgraded
+		retried := found && nodeStatus.State == amdv1alpha1.UpgradeStateFailed && nodeStatus.DriversVersion != targetVersion
+		if found && isInProgress(nodeStatus) && !retried {
+			nodeStatus.DriversVersion = targetVersion
+			nodeStatuses = append(nodeStatuses, nodeStatus)
+			unavailable++
+			continue
+		}
+
+		version, labelled := node.Labels[versionLabel]
+		_, loaded := node.Labels[moduleReadyLabel]
+		switch {
+		case !labelled && loaded:
+			// the drivers were loaded before the upgrade policy was set
+			candidates = append(candidates, len(nodeStatuses))
+		case !labelled:
+			// a node the drivers were never loaded on does not need to be drained
+			if err := um.setNodeLabel(ctx, node, versionLabel, &targetVersion); err != nil {
+				return false, err
+			}
+		case version != targetVersion:
+			candidates = append(candidates, len(nodeStatuses))
+		}
+		if found {
+			nodeStatuses = append(nodeStatuses, nodeStatus)
+		} else {
+			nodeStatuses = append(nodeStatuses, amdv1alpha1.NodeUpgradeStatus{NodeName: node.Name})
+		}
+	}
+
+	maxUnavailable, err := getMaxUnavailable(policy, len(nodes.Items))
+	if err != nil {
+		return false, err
+	}
+	pending := len(candidates)
+	for _, index := range candidates {
+		if unavailable >= maxUnavailable {
+			break
+		}
+		// the drivers upgrade and the partitioning of a node are not run at the same time
+		if isNodePartitioning(devConfig, nodeStatuses[index].NodeName) {
+			continue
+		}
+		setState(&nodeStatuses[index], amdv1alpha1.UpgradeStateStarted, "")
+		nodeStatuses[index].DriversVersion = targetVersion
+		unavailable++
+		pending--
+	}
+
+	nodesByName := map[string]*v1.Node{}
+	for i := range nodes.Items {
+		nodesByName[nodes.Items[i].Name] = &nodes.Items[i]
+	}
+
+	active := 0
+	failed := 0
+	var nodeErr error
+	for i := range nodeStatuses {
+		if !isInProgress(nodeStatuses[i]) {
+			continue
+		}
+		if err := um.handleNode(ctx, devConfig, nodesByName[nodeStatuses[i].NodeName], &nodeStatuses[i]); err != nil {
+			// the states reached by the other nodes are still reported
+			nodeErr = errors.Join(nodeErr, fmt.Errorf("failed to upgrade node %s: %v", nodeStatuses[i].NodeName, err))
+		}
+		switch nodeStatuses[i].State {
+		case amdv1alpha1.UpgradeStateFailed:
+			failed++
+		case amdv1alpha1.UpgradeStateDone:
+		default:
+			active++
+		}
+	}
+
+	// nodes that were never upgraded are not reported
+	devConfig.Status.NodeUpgrades = nil
+	for _, nodeStatus := range nodeStatuses {
+		if nodeStatus.State != "" {
+			devConfig.Status.NodeUpgrades = append(devConfig.Status.NodeUpgrades, nodeStatus)
+		}
+	}
+
+	// failed nodes need to be handled by the user, so there is nothing to wait for once they
+	// take all the unavailable slots
+	return active > 0 || (pending > 0 && failed < maxUnavailable), nodeErr
+}
+
+// handleNode moves the node to the next upgrade state, once the current one is completed
+func (um *upgradeManager) handleNode(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, node *v1.Node, nodeStatus *amdv1alpha1.NodeUpgradeStatus) error {
+	logger := log.FromContext(ctx).WithValues("node", node.Name, "version", nodeStatus.DriversVersion)
+	policy := devConfig.Spec.UpgradePolicy
+	drain := policy.Drain == nil || *policy.Drain
+
+	switch nodeStatus.State {
+	case amdv1alpha1.UpgradeStateStarted:
+		// a node retried after a failed upgrade is handled as a new one
+		if _, failed := node.Labels[UpgradeStateLabel]; failed {
+			if err := um.setNodeLabel(ctx, node, UpgradeStateLabel, nil); err != nil {
+				return err
+			}
+		}
+		if !drain {
+			setState(nodeStatus, amdv1alpha1.UpgradeStateModuleReload, "")
+			return nil
+		}
+		// a node already cordoned, e.g. by an admin, is left cordoned once upgraded
+		if !node.Spec.Unschedulable {
+			logger.Info("cordoning node")
+			if err := SetNodeUnschedulable(ctx, um.client, node, true); err != nil {
+				return err
+			}
+			nodeStatus.Cordoned = true
+		}
+		setState(nodeStatus, amdv1alpha1.UpgradeStateDrain, "")
+	case amdv1alpha1.UpgradeStateDrain:
+		remaining, err := EvictPods(ctx, um.client, node, policy.PodSelector)
+		if err != nil {
+			return err
+		}
+		if remaining == 0 {
+			logger.Info("node drained")
+			setState(nodeStatus, amdv1alpha1.UpgradeStateModuleReload, "")
+			return nil
+		}
+		timeout := defaultDrainTimeout
+		if policy.DrainTimeoutSeconds != 0 {
+			timeout = time.Duration(policy.DrainTimeoutSeconds) * time.Second
+		}
+		if time.Since(nodeStatus.LastTransitionTime.Time) > timeout {
+			logger.Info("node drain timed out", "remaining pods", remaining)
+			failedState := amdv1alpha1.UpgradeStateFailed
+			if err := um.setNodeLabel(ctx, node, UpgradeStateLabel, &failedState); err != nil {
+				return err
+			}
+			setState(nodeStatus, amdv1alpha1.UpgradeStateFailed, fmt.Sprintf("%d pods were not evicted after %s", remaining, timeout))
+			return nil
+		}
+		nodeStatus.Message = fmt.Sprintf("waiting for %d pods to be evicted", remaining)
+	case amdv1alpha1.UpgradeStateModuleReload:
+		return um.reloadModule(ctx, devConfig, node, nodeStatus)
+	}
+
+	return nil
+}
+
+// reloadModule follows the KMM ordered upgrade: the module version label is removed so that KMM unloads the
+// old drivers, and once they are unloaded it is set to the new version so that KMM loads the new drivers
+func (um *upgradeManager) reloadModule(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig, node *v1.Node,
+	nodeStatus *amdv1alpha1.NodeUpgradeStatus) error {
+	logger := log.FromContext(ctx).WithValues("node", node.Name, "version", nodeStatus.DriversVersion)
+	versionLabel := fmt.Sprintf(moduleVersionLabelTemplate, devConfig.Namespace, devConfig.Name)
+	workerPodVersionLabel := fmt.Sprintf(workerPodVersionLabelTemplate, devConfig.Namespace, devConfig.Name)
+	version, labelled := node.Labels[versionLabel]
+	loadedVersion, loaded := node.Labels[workerPodVersionLabel]
+
+	switch {
+	case labelled && version == nodeStatus.DriversVersion:
+		if !loaded || loadedVersion != nodeStatus.DriversVersion {
+			nodeStatus.Message = "waiting for the new drivers to be loaded"
+			return nil
+		}
+		if isNodePartitioning(devConfig, node.Name) {
+			nodeStatus.Message = "waiting for the partitioning of the node to complete"
+			return nil
+		}
+		if nodeStatus.Cordoned {
+			logger.Info("uncordoning node")
+			if err := SetNodeUnschedulable(ctx, um.client, node, false); err != nil {
+				return err
+			}
+			nodeStatus.Cordoned = false
+		}
+		logger.Info("node upgraded")
+		setState(nodeStatus, amdv1alpha1.UpgradeStateDone, "")
+	case labelled:
+		logger.Info("unloading the old drivers", "old version", version)
+		if err := um.setNodeLabel(ctx, node, versionLabel, nil); err != nil {
+			return err
+		}
+		nodeStatus.Message = "waiting for the old drivers to be unloaded"
+	case loaded:
+		nodeStatus.Message = "waiting for the old drivers to be unloaded"
+	default:
+		logger.Info("loading the new drivers")
+		if err := um.setNodeLabel(ctx, node, versionLabel, &nodeStatus.DriversVersion); err != nil {
+			return err
+		}
+		nodeStatus.Message = "waiting for the new drivers to be loaded"
+	}
+
+	return nil
+}
+
+// EvictPods evicts the pods matching podSelector running on the node, and returns the number of pods still
+// running on it. Evictions blocked by a PodDisruptionBudget are retried on the next call
+func EvictPods(ctx context.Context, c client.Client, node *v1.Node, podSelector string) (int, error) {
+	selector, err := labels.Parse(podSelector)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse pod selector %q: %v", podSelector, err)
+	}
+
+	pods := v1.PodList{}
+	if err = c.List(ctx, &pods, client.MatchingFields{PodNodeNameField: node.Name}, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return 0, fmt.Errorf("failed to list pods: %v", err)
+	}
+
+	logger := log.FromContext(ctx)
+	remaining := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !needsEviction(pod) {
+			continue
+		}
+		remaining++
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name}}
+		err = c.SubResource("eviction").Create(ctx, pod, eviction)
+		switch {
+		case err == nil:
+			logger.Info("evicted pod", "namespace", pod.Namespace, "name", pod.Name)
+		case k8serrors.IsNotFound(err):
+			remaining--
+		case k8serrors.IsTooManyRequests(err):
+			logger.Info("pod eviction blocked by a PodDisruptionBudget", "namespace", pod.Namespace, "name", pod.Name)
+		default:
+			return 0, fmt.Errorf("failed to evict pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+
+	return remaining, nil
+}
+
+// needsEviction returns false for the pods that are not evicted when draining a node: DaemonSet pods,
+// which would be recreated on the node, mirror pods, which cannot be evicted, and completed pods
+func needsEviction(pod *v1.Pod) bool {
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return false
+	}
+	if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+		return false
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+		return false
+	}
+	return true
+}
+
+// SetNodeUnschedulable cordons or uncordons the node
+func SetNodeUnschedulable(ctx context.Context, c client.Client, node *v1.Node, unschedulable bool) error {
+	if node.Spec.Unschedulable == unschedulable {
+		return nil
+	}
+
+	nodeCopy := node.DeepCopy()
+	node.Spec.Unschedulable = unschedulable
+	if err := c.Patch(ctx, node, client.MergeFrom(nodeCopy)); err != nil {
+		return fmt.Errorf("failed to set node %s unschedulable to %t: %v", node.Name, unschedulable, err)
+	}
+	return nil
+}
+
+// setNodeLabel sets the label to value, or removes it if value is nil
+func (um *upgradeManager) setNodeLabel(ctx context.Context, node *v1.Node, label string, value *string) error {
+	nodeCopy := node.DeepCopy()
+	if value == nil {
+		delete(node.Labels, label)
+	} else {
+		if node.Labels == nil {
+			node.Labels = map[string]string{}
+		}
+		node.Labels[label] = *value
+	}
+
+	if err := um.client.Patch(ctx, node, client.MergeFrom(nodeCopy)); err != nil {
+		return fmt.Errorf("failed to update label %s of node %s: %v", label, node.Name, err)
+	}
+	return nil
+}
+
+func getMaxUnavailable(policy *amdv1alpha1.UpgradePolicySpec, nodesNumber int) (int, error) {
+	maxUnavailable := intstr.FromInt(1)
+	if policy.MaxUnavailable != nil {
+		maxUnavailable = *policy.MaxUnavailable
+	}
+
+	value, err := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, nodesNumber, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get maxUnavailable: %v", err)
+	}
+	// at least one node must be upgraded at a time for the upgrade to progress
+	if value < 1 {
+		value = 1
+	}
+	return value, nil
+}
+
+// isInProgress returns true for the nodes counted as unavailable. Failed nodes are still cordoned,
+// so they are counted as well, stopping the upgrade until they are handled
+// IsNodeUpgrading returns true while the drivers upgrade of the node is in progress, or failed and left the
+// node cordoned
+func IsNodeUpgrading(devConfig *amdv1alpha1.DeviceConfig, nodeName string) bool {
+	for _, nodeStatus := range devConfig.Status.NodeUpgrades {
+		if nodeStatus.NodeName == nodeName {
+			return isInProgress(nodeStatus)
+		}
+	}
+	return false
+}
+
+// isNodePartitioning returns true while the GPUs of the node are partitioned
+func isNodePartitioning(devConfig *amdv1alpha1.DeviceConfig, nodeName string) bool {
+	for _, nodeStatus := range devConfig.Status.NodePartitions {
+		if nodeStatus.NodeName == nodeName {
+			return nodeStatus.State == amdv1alpha1.PartitionStateDrain || nodeStatus.State == amdv1alpha1.PartitionStateApply
+		}
+	}
+	return false
+}
+
+func isInProgress(nodeStatus amdv1alpha1.NodeUpgradeStatus) bool {
+	return nodeStatus.State != "" && nodeStatus.State != amdv1alpha1.UpgradeStateDone
+}
+
+func setState(nodeStatus *amdv1alpha1.NodeUpgradeStatus, state, message string) {
+	nodeStatus.State = state
+	nodeStatus.Message = message
+	nodeStatus.LastTransitionTime = metav1.Now()
+}
@@ -0,0 +1,403 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kmmlabels "github.com/rh-ecosystem-edge/kernel-module-management/pkg/labels"
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	mock_client "github.com/yevgeny-shnaidman/amd-gpu-operator/internal/client"
+	"go.uber.org/mock/gomock"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	devConfigName      = "devConfigName"
+	devConfigNamespace = "devConfigNamespace"
+)
+
+var (
+	versionLabel          = fmt.Sprintf(moduleVersionLabelTemplate, devConfigNamespace, devConfigName)
+	workerPodVersionLabel = fmt.Sprintf(workerPodVersionLabelTemplate, devConfigNamespace, devConfigName)
+)
+
+var _ = Describe("HandleUpgrade", func() {
+	var (
+		kubeClient        *mock_client.MockClient
+		subResourceClient *mock_client.MockSubResourceClient
+		um                UpgradeManager
+	)
+
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		subResourceClient = mock_client.NewMockSubResourceClient(ctrl)
+		um = NewUpgradeManager(kubeClient)
+	})
+
+	ctx := context.Background()
+	newDevConfig := func(nodeUpgrades ...amdv1alpha1.NodeUpgradeStatus) *amdv1alpha1.DeviceConfig {
+		return &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				DriversVersion: "v2",
+				UpgradePolicy:  &amdv1alpha1.UpgradePolicySpec{},
+			},
+			Status: amdv1alpha1.DeviceConfigStatus{NodeUpgrades: nodeUpgrades},
+		}
+	}
+	newNode := func(name string, labels map[string]string) v1.Node {
+		return v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	expectNodes := func(nodes ...v1.Node) *gomock.Call {
+		return kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Do(
+			func(_ interface{}, list *v1.NodeList, _ ...client.ListOption) {
+				list.Items = nodes
+			},
+		)
+	}
+	expectPods := func(pods ...v1.Pod) *gomock.Call {
+		return kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any(), gomock.Any()).Do(
+			func(_ interface{}, list *v1.PodList, _ ...client.ListOption) {
+				list.Items = pods
+			},
+		)
+	}
+
+	It("no upgrade policy", func() {
+		devConfig := newDevConfig(amdv1alpha1.NodeUpgradeStatus{NodeName: "node1", State: amdv1alpha1.UpgradeStateDone})
+		devConfig.Spec.UpgradePolicy = nil
+
+		inProgress, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodeUpgrades).To(BeNil())
+	})
+
+	It("new node is labelled with the current version", func() {
+		devConfig := newDevConfig()
+
+		gomock.InOrder(
+			expectNodes(newNode("node1", nil)),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Labels).To(HaveKeyWithValue(versionLabel, "v2"))
+				},
+			),
+		)
+
+		inProgress, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodeUpgrades).To(BeEmpty())
+	})
+
+	It("node with drivers loaded before the upgrade policy is upgraded", func() {
+		devConfig := newDevConfig()
+		moduleReadyLabel := kmmlabels.GetKernelModuleReadyNodeLabel(devConfigNamespace, devConfigName)
+
+		gomock.InOrder(
+			expectNodes(newNode("node1", map[string]string{moduleReadyLabel: ""})),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Labels).ToNot(HaveKey(versionLabel))
+					Expect(node.Spec.Unschedulable).To(BeTrue())
+				},
+			),
+		)
+
+		inProgress, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(devConfig.Status.NodeUpgrades).To(HaveLen(1))
+		Expect(devConfig.Status.NodeUpgrades[0].State).To(Equal(amdv1alpha1.UpgradeStateDrain))
+	})
+
+	It("upgrade starts on maxUnavailable nodes", func() {
+		devConfig := newDevConfig()
+
+		gomock.InOrder(
+			expectNodes(
+				newNode("node2", map[string]string{versionLabel: "v1"}),
+				newNode("node1", map[string]string{versionLabel: "v1"}),
+			),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Name).To(Equal("node1"))
+					Expect(node.Spec.Unschedulable).To(BeTrue())
+				},
+			),
+		)
+
+		inProgress, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(devConfig.Status.NodeUpgrades).To(HaveLen(1))
+		Expect(devConfig.Status.NodeUpgrades[0].NodeName).To(Equal("node1"))
+		Expect(devConfig.Status.NodeUpgrades[0].State).To(Equal(amdv1alpha1.UpgradeStateDrain))
+		Expect(devConfig.Status.NodeUpgrades[0].DriversVersion).To(Equal("v2"))
+		Expect(devConfig.Status.NodeUpgrades[0].Cordoned).To(BeTrue())
+	})
+
+	It("node being partitioned is not upgraded until the partitioning is done", func() {
+		devConfig := newDevConfig()
+		devConfig.Status.NodePartitions = []amdv1alpha1.NodePartitionStatus{{NodeName: "node1", State: amdv1alpha1.PartitionStateApply}}
+
+		expectNodes(newNode("node1", map[string]string{versionLabel: "v1"}))
+
+		inProgress, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(devConfig.Status.NodeUpgrades).To(BeEmpty())
+	})
+
+	It("node is drained, DaemonSet and mirror pods are not evicted", func() {
+		devConfig := newDevConfig(amdv1alpha1.NodeUpgradeStatus{NodeName: "node1", State: amdv1alpha1.UpgradeStateDrain, LastTransitionTime: metav1.Now()})
+		workload := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "workload"}}
+		dsPod := v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "ns",
+			Name:            "ds-pod",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "ds", Controller: pointer.Bool(true)}},
+		}}
+		mirrorPod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "mirror", Annotations: map[string]string{mirrorPodAnnotation: "x"}}}
+
+		gomock.InOrder(
+			expectNodes(newNode("node1", map[string]string{versionLabel: "v1"})),
+			expectPods(dsPod, workload, mirrorPod),
+			kubeClient.EXPECT().SubResource("eviction").Return(subResourceClient),
+			subResourceClient.EXPECT().Create(ctx, &workload, gomock.Any()).Return(nil),
+		)
+
+		inProgress, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(devConfig.Status.NodeUpgrades[0].State).To(Equal(amdv1alpha1.UpgradeStateDrain))
+		Expect(devConfig.Status.NodeUpgrades[0].Message).To(Equal("waiting for 1 pods to be evicted"))
+
+		gomock.InOrder(
+			expectNodes(newNode("node1", map[string]string{versionLabel: "v1"})),
+			expectPods(dsPod, mirrorPod),
+		)
+
+		inProgress, err = um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(devConfig.Status.NodeUpgrades[0].State).To(Equal(amdv1alpha1.UpgradeStateModuleReload))
+	})
+
+	It("eviction blocked by a PodDisruptionBudget until the drain timeout", func() {
+		transitionTime := metav1.NewTime(time.Now().Add(-time.Minute))
+		devConfig := newDevConfig(amdv1alpha1.NodeUpgradeStatus{NodeName: "node1", State: amdv1alpha1.UpgradeStateDrain, LastTransitionTime: transitionTime})
+		devConfig.Spec.UpgradePolicy.DrainTimeoutSeconds = 30
+		workload := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "workload"}}
+
+		gomock.InOrder(
+			expectNodes(newNode("node1", map[string]string{versionLabel: "v1"})),
+			expectPods(workload),
+			kubeClient.EXPECT().SubResource("eviction").Return(subResourceClient),
+			subResourceClient.EXPECT().Create(ctx, &workload, gomock.Any()).Return(k8serrors.NewTooManyRequests("pdb", 10)),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Labels).To(HaveKeyWithValue(UpgradeStateLabel, amdv1alpha1.UpgradeStateFailed))
+				},
+			),
+		)
+
+		inProgress, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodeUpgrades[0].State).To(Equal(amdv1alpha1.UpgradeStateFailed))
+	})
+
+	It("failed node is retried on a new version", func() {
+		devConfig := newDevConfig(amdv1alpha1.NodeUpgradeStatus{NodeName: "node1", State: amdv1alpha1.UpgradeStateFailed, DriversVersion: "v1", Cordoned: true})
+		node := newNode("node1", map[string]string{versionLabel: "v0", UpgradeStateLabel: amdv1alpha1.UpgradeStateFailed})
+		node.Spec.Unschedulable = true
+
+		gomock.InOrder(
+			expectNodes(node),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Labels).ToNot(HaveKey(UpgradeStateLabel))
+				},
+			),
+		)
+
+		inProgress, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(devConfig.Status.NodeUpgrades[0].State).To(Equal(amdv1alpha1.UpgradeStateDrain))
+		Expect(devConfig.Status.NodeUpgrades[0].DriversVersion).To(Equal("v2"))
+		Expect(devConfig.Status.NodeUpgrades[0].Cordoned).To(BeTrue())
+	})
+
+	It("node already cordoned is not cordoned by the upgrade", func() {
+		devConfig := newDevConfig()
+		node := newNode("node1", map[string]string{versionLabel: "v1"})
+		node.Spec.Unschedulable = true
+
+		expectNodes(node)
+
+		inProgress, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(devConfig.Status.NodeUpgrades[0].State).To(Equal(amdv1alpha1.UpgradeStateDrain))
+		Expect(devConfig.Status.NodeUpgrades[0].Cordoned).To(BeFalse())
+	})
+
+	It("eviction failed", func() {
+		devConfig := newDevConfig(amdv1alpha1.NodeUpgradeStatus{NodeName: "node1", State: amdv1alpha1.UpgradeStateDrain, LastTransitionTime: metav1.Now()})
+		workload := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "workload"}}
+
+		gomock.InOrder(
+			expectNodes(newNode("node1", map[string]string{versionLabel: "v1"})),
+			expectPods(workload),
+			kubeClient.EXPECT().SubResource("eviction").Return(subResourceClient),
+			subResourceClient.EXPECT().Create(ctx, &workload, gomock.Any()).Return(k8serrors.NewForbidden(schema.GroupResource{}, "workload", fmt.Errorf("some error"))),
+		)
+
+		_, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("module reload removes the old version label", func() {
+		devConfig := newDevConfig(amdv1alpha1.NodeUpgradeStatus{NodeName: "node1", State: amdv1alpha1.UpgradeStateModuleReload})
+
+		gomock.InOrder(
+			expectNodes(newNode("node1", map[string]string{versionLabel: "v1", workerPodVersionLabel: "v1"})),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Labels).ToNot(HaveKey(versionLabel))
+				},
+			),
+		)
+
+		inProgress, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(devConfig.Status.NodeUpgrades[0].State).To(Equal(amdv1alpha1.UpgradeStateModuleReload))
+	})
+
+	It("module reload sets the new version label once the old drivers are unloaded", func() {
+		devConfig := newDevConfig(amdv1alpha1.NodeUpgradeStatus{NodeName: "node1", State: amdv1alpha1.UpgradeStateModuleReload})
+
+		gomock.InOrder(
+			expectNodes(newNode("node1", map[string]string{})),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Labels).To(HaveKeyWithValue(versionLabel, "v2"))
+				},
+			),
+		)
+
+		inProgress, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+	})
+
+	It("new drivers are loaded, node is uncordoned", func() {
+		devConfig := newDevConfig(amdv1alpha1.NodeUpgradeStatus{NodeName: "node1", State: amdv1alpha1.UpgradeStateModuleReload, Cordoned: true})
+		node := newNode("node1", map[string]string{versionLabel: "v2", workerPodVersionLabel: "v2"})
+		node.Spec.Unschedulable = true
+
+		gomock.InOrder(
+			expectNodes(node),
+			kubeClient.EXPECT().Patch(ctx, gomock.Any(), gomock.Any()).Do(
+				func(_ interface{}, node *v1.Node, _ client.Patch, _ ...client.PatchOption) {
+					Expect(node.Spec.Unschedulable).To(BeFalse())
+				},
+			),
+		)
+
+		inProgress, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodeUpgrades[0].State).To(Equal(amdv1alpha1.UpgradeStateDone))
+		Expect(devConfig.Status.NodeUpgrades[0].Cordoned).To(BeFalse())
+	})
+
+	It("new drivers are loaded, node cordoned before the upgrade stays cordoned", func() {
+		devConfig := newDevConfig(amdv1alpha1.NodeUpgradeStatus{NodeName: "node1", State: amdv1alpha1.UpgradeStateModuleReload})
+		node := newNode("node1", map[string]string{versionLabel: "v2", workerPodVersionLabel: "v2"})
+		node.Spec.Unschedulable = true
+
+		expectNodes(node)
+
+		inProgress, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(devConfig.Status.NodeUpgrades[0].State).To(Equal(amdv1alpha1.UpgradeStateDone))
+	})
+
+	It("failed to list nodes", func() {
+		devConfig := newDevConfig()
+
+		kubeClient.EXPECT().List(ctx, gomock.Any(), gomock.Any()).Return(fmt.Errorf("some error"))
+
+		_, err := um.HandleUpgrade(ctx, devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("getMaxUnavailable", func() {
+	It("defaults to 1", func() {
+		maxUnavailable, err := getMaxUnavailable(&amdv1alpha1.UpgradePolicySpec{}, 10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(maxUnavailable).To(Equal(1))
+	})
+
+	It("percentage", func() {
+		percentage := intstr.FromString("25%")
+		maxUnavailable, err := getMaxUnavailable(&amdv1alpha1.UpgradePolicySpec{MaxUnavailable: &percentage}, 10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(maxUnavailable).To(Equal(2))
+	})
+
+	It("at least one node", func() {
+		percentage := intstr.FromString("10%")
+		maxUnavailable, err := getMaxUnavailable(&amdv1alpha1.UpgradePolicySpec{MaxUnavailable: &percentage}, 5)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(maxUnavailable).To(Equal(1))
+	})
+})
@@ -0,0 +1,93 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rh-ecosystem-edge/kernel-module-management/pkg/labels"
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// InTreeModuleLoadedLabel is set by the NFD rule in config/nfd on the nodes on which the amdgpu module is loaded
+	InTreeModuleLoadedLabel = "feature.node.kubernetes.io/kernel-loadedmodule.amdgpu"
+
+	defaultPriorityClassName = "system-node-critical"
+)
+
+// GetNodeSelector returns the selector of the nodes targeted by the DeviceConfig.
+// If the DeviceConfig does not define one, all the nodes with an AMD PCI device are targeted
+func GetNodeSelector(devConfig *amdv1alpha1.DeviceConfig) map[string]string {
+	if devConfig.Spec.Selector != nil {
+		return devConfig.Spec.Selector
+	}
+
+	ns := make(map[string]string, 0)
+	ns[fmt.Sprintf("feature.node.kubernetes.io/pci-%s.present", amdv1alpha1.AMDPCIVendorID)] = "true"
+	return ns
+}
+
+// GetOperandsNodeSelector returns the selector of the nodes on which the operands (device plugin, node labeller,
+// node metrics) should run. For OOT drivers the operands wait for the KMM kernel-module-ready label, while for
+// in-tree drivers they wait for the NFD label of the loaded amdgpu module on the nodes targeted by the DeviceConfig
+func GetOperandsNodeSelector(devConfig *amdv1alpha1.DeviceConfig) map[string]string {
+	if devConfig.Spec.UseInTreeDrivers {
+		ns := map[string]string{InTreeModuleLoadedLabel: "true"}
+		for k, v := range GetNodeSelector(devConfig) {
+			ns[k] = v
+		}
+		return ns
+	}
+	return map[string]string{labels.GetKernelModuleReadyNodeLabel(devConfig.Namespace, devConfig.Name): ""}
+}
+
+// GetAffinity returns the affinity of the operand pods of the DeviceConfig
+func GetAffinity(devConfig *amdv1alpha1.DeviceConfig) *v1.Affinity {
+	if devConfig.Spec.NodeAffinity == nil {
+		return nil
+	}
+	return &v1.Affinity{NodeAffinity: devConfig.Spec.NodeAffinity}
+}
+
+// GetPriorityClassName returns the priority class of the operand pods of the DeviceConfig
+func GetPriorityClassName(devConfig *amdv1alpha1.DeviceConfig) string {
+	if devConfig.Spec.PriorityClassName == "" {
+		return defaultPriorityClassName
+	}
+	return devConfig.Spec.PriorityClassName
+}
+
+// GetImagePullPolicy returns pullPolicy if set, otherwise the policy Kubernetes would default to for image:
+// Always for images without a tag or with the latest tag, IfNotPresent otherwise.
+// Setting it explicitly keeps the desired operand spec identical to the one stored by the API server
+func GetImagePullPolicy(image string, pullPolicy v1.PullPolicy) v1.PullPolicy {
+	if pullPolicy != "" {
+		return pullPolicy
+	}
+
+	if strings.Contains(image, "@") {
+		return v1.PullIfNotPresent
+	}
+	tagIndex := strings.LastIndex(image, ":")
+	if tagIndex < 0 || strings.Contains(image[tagIndex:], "/") || image[tagIndex+1:] == "latest" {
+		return v1.PullAlways
+	}
+	return v1.PullIfNotPresent
+}
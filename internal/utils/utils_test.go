@@ -0,0 +1,52 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("GetOperandsNodeSelector", func() {
+	It("OOT drivers wait for the KMM kernel module ready label", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: "namespace"},
+		}
+
+		Expect(GetOperandsNodeSelector(devConfig)).To(Equal(map[string]string{
+			"kmm.node.kubernetes.io/namespace.name.ready": "",
+		}))
+	})
+
+	It("in-tree drivers wait for the amdgpu module to be loaded", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: "namespace"},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				UseInTreeDrivers: true,
+				Selector:         map[string]string{"pool": "a"},
+			},
+		}
+
+		Expect(GetOperandsNodeSelector(devConfig)).To(Equal(map[string]string{
+			"pool":                  "a",
+			InTreeModuleLoadedLabel: "true",
+		}))
+		Expect(devConfig.Spec.Selector).To(Equal(map[string]string{"pool": "a"}))
+	})
+})
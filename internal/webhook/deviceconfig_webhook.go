@@ -0,0 +1,566 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/kmmmodule"
+	"github.com/yevgeny-shnaidman/amd-gpu-operator/internal/utils"
+)
+
+// kmmImageVars are the variables KMM substitutes in the container images
+const kmmImageVars = `(?:KERNEL_FULL_VERSION|KERNEL_VERSION|KERNEL_XYZ|KERNEL_X|KERNEL_Y|KERNEL_Z|MOD_NAMESPACE|MOD_NAME)`
+
+var (
+	// imageRefRegexp matches [registry[:port]/]name[/name...][:tag][@digest]
+	imageRefRegexp = regexp.MustCompile(`^` +
+		`(?:(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)(?:\.(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?))*(?::[0-9]+)?/)?` +
+		`[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*)*` +
+		`(?::[\w][\w.-]{0,127})?` +
+		`(?:@[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9A-Fa-f]{32,})?$`)
+
+	// imageVarRegexp matches the KMM variables, with or without braces
+	imageVarRegexp = regexp.MustCompile(`\$(?:\{` + kmmImageVars + `\}|` + kmmImageVars + `\b)`)
+
+	// reservedBuildArgs are the build args set by the operator
+	reservedBuildArgs = map[string]bool{
+		"DRIVERS_VERSION":    true,
+		"SOURCES_IMAGE_REPO": true,
+	}
+
+	// amdgpuParameters are the amdgpu module parameters accepted in modprobe.parameters
+	amdgpuParameters = map[string]bool{
+		"aspm":                          true,
+		"async_gfx_ring":                true,
+		"audio":                         true,
+		"bad_page_threshold":            true,
+		"cwsr_enable":                   true,
+		"dc":                            true,
+		"debug_evictions":               true,
+		"debug_largebar":                true,
+		"discovery":                     true,
+		"dpm":                           true,
+		"enforce_isolation":             true,
+		"exp_hw_support":                true,
+		"gpu_recovery":                  true,
+		"gttsize":                       true,
+		"halt_if_hws_hang":              true,
+		"hws_gws_support":               true,
+		"hws_max_conc_proc":             true,
+		"ignore_crat":                   true,
+		"job_hang_limit":                true,
+		"lockup_timeout":                true,
+		"max_num_of_queues_per_device":  true,
+		"mcbp":                          true,
+		"mes":                           true,
+		"msi":                           true,
+		"mtype_local":                   true,
+		"no_queue_eviction_on_vm_fault": true,
+		"no_system_mem_limit":           true,
+		"noretry":                       true,
+		"num_kcq":                       true,
+		"ppfeaturemask":                 true,
+		"queue_preemption_timeout_ms":   true,
+		"ras_enable":                    true,
+		"ras_mask":                      true,
+		"reset_method":                  true,
+		"runpm":                         true,
+		"sched_hw_submission":           true,
+		"sched_policy":                  true,
+		"send_sigterm":                  true,
+		"timeout_fatal_disable":         true,
+		"timeout_period":                true,
+		"user_partt_mode":               true,
+		"vm_block_size":                 true,
+		"vm_fragment_size":              true,
+		"vm_size":                       true,
+		"vm_update_mode":                true,
+		"vramlimit":                     true,
+	}
+)
+
+// DeviceConfigWebhook defaults and validates DeviceConfig objects on admission
+type DeviceConfigWebhook struct {
+	client client.Client
+}
+
+func NewDeviceConfigWebhook(client client.Client) *DeviceConfigWebhook {
+	return &DeviceConfigWebhook{
+		client: client,
+	}
+}
+
+func (w *DeviceConfigWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	// controller-runtime will set the paths to `mutate-<group>-<version>-<resource>` and
+	// `validate-<group>-<version>-<resource>`, so they must match the +kubebuilder annotations below.
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&amdv1alpha1.DeviceConfig{}).
+		WithDefaulter(w).
+		WithValidator(w).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-amd-io-v1alpha1-deviceconfig,mutating=true,failurePolicy=fail,sideEffects=None,groups=amd.io,resources=deviceconfigs,verbs=create;update,versions=v1alpha1,name=mdeviceconfig.kb.io,admissionReviewVersions=v1
+
+var _ admission.CustomDefaulter = &DeviceConfigWebhook{}
+
+// Default implements admission.CustomDefaulter, writing the defaults used by the operator into the DeviceConfig
+func (w *DeviceConfigWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	devConfig, ok := obj.(*amdv1alpha1.DeviceConfig)
+	if !ok {
+		return fmt.Errorf("object %v is not of the expected type *DeviceConfig", obj)
+	}
+
+	kmmmodule.SetDefaults(devConfig)
+	if devConfig.Spec.Selector == nil {
+		devConfig.Spec.Selector = utils.GetNodeSelector(devConfig)
+	}
+
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-amd-io-v1alpha1-deviceconfig,mutating=false,failurePolicy=fail,sideEffects=None,groups=amd.io,resources=deviceconfigs,verbs=create;update,versions=v1alpha1,name=vdeviceconfig.kb.io,admissionReviewVersions=v1
+
+var _ admission.CustomValidator = &DeviceConfigWebhook{}
+
+// ValidateCreate implements admission.CustomValidator
+func (w *DeviceConfigWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	devConfig, ok := obj.(*amdv1alpha1.DeviceConfig)
+	if !ok {
+		return nil, fmt.Errorf("object %v is not of the expected type *DeviceConfig", obj)
+	}
+
+	if err := w.validate(devConfig); err != nil {
+		return nil, err
+	}
+
+	return nil, w.validateSelectorOverlap(ctx, devConfig)
+}
+
+// ValidateUpdate implements admission.CustomValidator
+func (w *DeviceConfigWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldDevConfig, ok := oldObj.(*amdv1alpha1.DeviceConfig)
+	if !ok {
+		return nil, fmt.Errorf("object %v is not of the expected type *DeviceConfig", oldObj)
+	}
+	devConfig, ok := newObj.(*amdv1alpha1.DeviceConfig)
+	if !ok {
+		return nil, fmt.Errorf("object %v is not of the expected type *DeviceConfig", newObj)
+	}
+
+	// the finalizer and metadata updates of the operator must not be blocked, so that deletion can complete
+	if devConfig.DeletionTimestamp != nil || reflect.DeepEqual(oldDevConfig.Spec, devConfig.Spec) {
+		return nil, nil
+	}
+
+	if err := w.validate(devConfig); err != nil {
+		return nil, err
+	}
+
+	if err := validateDriversUpdate(oldDevConfig, devConfig); err != nil {
+		return nil, fmt.Errorf("failed to validate upgradePolicy: %v", err)
+	}
+
+	if reflect.DeepEqual(utils.GetNodeSelector(oldDevConfig), utils.GetNodeSelector(devConfig)) {
+		return nil, nil
+	}
+
+	return nil, w.validateSelectorOverlap(ctx, devConfig)
+}
+
+// ValidateDelete implements admission.CustomValidator
+func (w *DeviceConfigWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (w *DeviceConfigWebhook) validate(devConfig *amdv1alpha1.DeviceConfig) error {
+	if err := validateImages(devConfig); err != nil {
+		return fmt.Errorf("failed to validate images: %v", err)
+	}
+
+	if err := validateSelector(devConfig.Spec.Selector); err != nil {
+		return fmt.Errorf("failed to validate selector: %v", err)
+	}
+
+	metricsExporter := devConfig.Spec.MetricsExporter
+	if metricsExporter.NodePort != 0 && metricsExporter.ServiceType != v1.ServiceTypeNodePort {
+		return errors.New("metricsExporter.nodePort can only be set when metricsExporter.serviceType is NodePort")
+	}
+	if metricsExporter.TLS != nil && metricsExporter.TLS.CertSecret.Name == "" {
+		return errors.New("metricsExporter.tls.certSecret.name must be set")
+	}
+	if metricsExporter.TLS != nil && metricsExporter.TLS.CAConfigMap != nil && metricsExporter.TLS.CAConfigMap.Name == "" {
+		return errors.New("metricsExporter.tls.caConfigMap.name must be set")
+	}
+
+	if err := validateDevicePlugin(devConfig); err != nil {
+		return fmt.Errorf("failed to validate devicePlugin: %v", err)
+	}
+
+	if err := validateUpgradePolicy(devConfig); err != nil {
+		return fmt.Errorf("failed to validate upgradePolicy: %v", err)
+	}
+
+	if partitioning := devConfig.Spec.Partitioning; partitioning != nil {
+		if _, err := labels.Parse(partitioning.PodSelector); err != nil {
+			return fmt.Errorf("failed to validate partitioning: invalid podSelector: %v", err)
+		}
+	}
+
+	if devConfig.Spec.Blacklist.Enable && devConfig.Spec.UseInTreeDrivers {
+		return errors.New("blacklist.enable cannot be set when useInTreeDrivers is set")
+	}
+
+	if err := validateDriver(devConfig); err != nil {
+		return fmt.Errorf("failed to validate driver: %v", err)
+	}
+
+	return nil
+}
+
+func validateDevicePlugin(devConfig *amdv1alpha1.DeviceConfig) error {
+	devicePlugin := devConfig.Spec.DevicePlugin
+	if devicePlugin.ConfigMap != nil && devicePlugin.ConfigMap.Name == "" {
+		return errors.New("configMap.name must be set")
+	}
+
+	// the flags of the settings are set by the operator, so they must not be repeated in the args
+	for _, arg := range devicePlugin.Args {
+		flag, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if (flag == "resource_naming_strategy" && devicePlugin.ResourceNamingStrategy != "") ||
+			(flag == "pulse" && devicePlugin.HealthCheckInterval != nil) {
+			return fmt.Errorf("args cannot set %s, it is set by the operator", arg)
+		}
+	}
+
+	return nil
+}
+
+func validateUpgradePolicy(devConfig *amdv1alpha1.DeviceConfig) error {
+	policy := devConfig.Spec.UpgradePolicy
+	if policy == nil {
+		return nil
+	}
+
+	if devConfig.Spec.UseInTreeDrivers {
+		return errors.New("upgradePolicy cannot be set when useInTreeDrivers is set")
+	}
+
+	// the version is set on the nodes in the KMM module version label
+	if errs := validation.IsValidLabelValue(devConfig.Spec.DriversVersion); len(errs) > 0 {
+		return fmt.Errorf("invalid driversVersion %q: %s", devConfig.Spec.DriversVersion, strings.Join(errs, "; "))
+	}
+
+	if policy.MaxUnavailable != nil {
+		if _, err := intstr.GetScaledValueFromIntOrPercent(policy.MaxUnavailable, 100, false); err != nil {
+			return fmt.Errorf("invalid maxUnavailable: %v", err)
+		}
+	}
+
+	if _, err := labels.Parse(policy.PodSelector); err != nil {
+		return fmt.Errorf("invalid podSelector: %v", err)
+	}
+
+	return nil
+}
+
+// validateDriversUpdate rejects the drivers changes that would replace the drivers on all the nodes at once:
+// with an upgrade policy, the drivers are only rolled out node by node when driversVersion changes
+func validateDriversUpdate(oldDevConfig, devConfig *amdv1alpha1.DeviceConfig) error {
+	if devConfig.Spec.UpgradePolicy == nil || oldDevConfig.Spec.DriversVersion != devConfig.Spec.DriversVersion {
+		return nil
+	}
+
+	if oldDevConfig.Spec.DriversImage != devConfig.Spec.DriversImage {
+		return errors.New("driversImage cannot be changed without changing driversVersion")
+	}
+
+	if !reflect.DeepEqual(getMappedDrivers(oldDevConfig), getMappedDrivers(devConfig)) {
+		return errors.New("the kernels, drivers images and drivers versions of kernelMappings cannot be changed without changing driversVersion")
+	}
+
+	return nil
+}
+
+// getMappedDrivers returns the kernel mappings without the settings that do not change the drivers images
+func getMappedDrivers(devConfig *amdv1alpha1.DeviceConfig) []amdv1alpha1.KernelMapping {
+	mappings := make([]amdv1alpha1.KernelMapping, 0, len(devConfig.Spec.KernelMappings))
+	for _, km := range devConfig.Spec.KernelMappings {
+		km.DockerfileConfigMap = nil
+		mappings = append(mappings, km)
+	}
+	return mappings
+}
+
+func validateDriver(devConfig *amdv1alpha1.DeviceConfig) error {
+	build := devConfig.Spec.Driver.Build
+	if build.DockerfileConfigMap != nil {
+		if devConfig.Spec.UseInTreeDrivers {
+			return errors.New("build.dockerfileConfigMap cannot be set when useInTreeDrivers is set")
+		}
+
+		if build.DockerfileConfigMap.Name == "" {
+			return errors.New("build.dockerfileConfigMap.name must be set")
+		}
+	}
+
+	if build.Policy == amdv1alpha1.BuildPolicyAlways {
+		if devConfig.Spec.DriversImage != "" {
+			return errors.New("driversImage cannot be set when build.policy is Always")
+		}
+		for i, km := range devConfig.Spec.KernelMappings {
+			if km.DriversImage != "" {
+				return fmt.Errorf("kernelMappings[%d].driversImage cannot be set when build.policy is Always", i)
+			}
+		}
+	}
+
+	if build.Policy == amdv1alpha1.BuildPolicyNever && devConfig.Spec.Signing != nil {
+		return errors.New("signing cannot be set when build.policy is Never, the prebuilt drivers images must be signed")
+	}
+
+	for i, secret := range build.Secrets {
+		if secret.Name == "" {
+			return fmt.Errorf("build.secrets[%d].name must be set", i)
+		}
+	}
+
+	for i, arg := range build.ExtraBuildArgs {
+		if arg.Name == "" {
+			return fmt.Errorf("build.extraBuildArgs[%d].name must be set", i)
+		}
+		if reservedBuildArgs[arg.Name] {
+			return fmt.Errorf("build.extraBuildArgs[%d]: %s is set by the operator", i, arg.Name)
+		}
+	}
+
+	if err := validateModprobe(devConfig); err != nil {
+		return fmt.Errorf("invalid modprobe: %v", err)
+	}
+
+	if devConfig.Spec.UseInTreeDrivers && devConfig.Spec.Driver.Preflight.Enable {
+		return errors.New("preflight cannot be enabled when useInTreeDrivers is set")
+	}
+
+	return nil
+}
+
+func validateModprobe(devConfig *amdv1alpha1.DeviceConfig) error {
+	modprobe := devConfig.Spec.Driver.Modprobe
+	if devConfig.Spec.UseInTreeDrivers && (len(modprobe.Parameters) > 0 || modprobe.RawArgs != nil || len(modprobe.LoadOrder) > 0) {
+		return errors.New("modprobe cannot be set when useInTreeDrivers is set")
+	}
+
+	if len(modprobe.Parameters) > 0 && modprobe.RawArgs != nil {
+		return errors.New("parameters cannot be set together with rawArgs")
+	}
+
+	for _, param := range modprobe.Parameters {
+		key, value, found := strings.Cut(param, "=")
+		if !found || value == "" || strings.ContainsAny(value, " \t\n") {
+			return fmt.Errorf("parameter %q is not in the key=value form", param)
+		}
+		if !amdgpuParameters[key] {
+			return fmt.Errorf("unknown amdgpu parameter %s", key)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, module := range modprobe.LoadOrder {
+		if module == "" || seen[module] {
+			return fmt.Errorf("loadOrder contains an empty or duplicate module %q", module)
+		}
+		seen[module] = true
+	}
+	if len(modprobe.LoadOrder) > 0 && modprobe.LoadOrder[len(modprobe.LoadOrder)-1] != "amdgpu" {
+		return errors.New("the last module of loadOrder must be amdgpu")
+	}
+
+	return nil
+}
+
+func validateImages(devConfig *amdv1alpha1.DeviceConfig) error {
+	if devConfig.Spec.UseInTreeDrivers && devConfig.Spec.DriversImage != "" {
+		return errors.New("driversImage cannot be set when useInTreeDrivers is set")
+	}
+
+	if err := validateImage(devConfig.Spec.DriversImage); err != nil {
+		return fmt.Errorf("invalid driversImage: %v", err)
+	}
+
+	if err := validateImage(devConfig.Spec.DevicePluginImage); err != nil {
+		return fmt.Errorf("invalid devicePluginImage: %v", err)
+	}
+
+	if err := validateImage(devConfig.Spec.NodeLabeller.Image); err != nil {
+		return fmt.Errorf("invalid nodeLabeller.image: %v", err)
+	}
+
+	if err := validateImage(devConfig.Spec.MetricsExporter.Image); err != nil {
+		return fmt.Errorf("invalid metricsExporter.image: %v", err)
+	}
+
+	if rbacProxy := devConfig.Spec.MetricsExporter.RbacProxy; rbacProxy != nil {
+		if err := validateImage(rbacProxy.Image); err != nil {
+			return fmt.Errorf("invalid metricsExporter.rbacProxy.image: %v", err)
+		}
+	}
+
+	if err := validateImage(devConfig.Spec.Blacklist.Image); err != nil {
+		return fmt.Errorf("invalid blacklist.image: %v", err)
+	}
+
+	if partitioning := devConfig.Spec.Partitioning; partitioning != nil {
+		if err := validateImage(partitioning.Image); err != nil {
+			return fmt.Errorf("invalid partitioning.image: %v", err)
+		}
+	}
+
+	if err := validateImage(devConfig.Spec.Driver.Build.SourcesImageRepo); err != nil {
+		return fmt.Errorf("invalid driver.build.sourcesImageRepo: %v", err)
+	}
+
+	for i, km := range devConfig.Spec.KernelMappings {
+		if err := validateImage(km.DriversImage); err != nil {
+			return fmt.Errorf("invalid kernelMappings[%d].driversImage: %v", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validateImage checks that image is a valid image reference, once the KMM variables are substituted.
+// An empty image is valid, since the operator falls back to the default one
+func validateImage(image string) error {
+	if image == "" {
+		return nil
+	}
+
+	if !imageRefRegexp.MatchString(imageVarRegexp.ReplaceAllString(image, "x")) {
+		return fmt.Errorf("%q is not a valid image reference", image)
+	}
+
+	return nil
+}
+
+func validateSelector(selector map[string]string) error {
+	if len(selector) == 0 {
+		return errors.New("selector must contain at least one label")
+	}
+
+	for key, value := range selector {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid value %q for label %q: %s", value, key, strings.Join(errs, "; "))
+		}
+	}
+
+	return nil
+}
+
+// validateSelectorOverlap rejects a DeviceConfig whose selector matches the same nodes as the selector
+// of another DeviceConfig, since both would then deploy drivers and operands on those nodes
+func (w *DeviceConfigWebhook) validateSelectorOverlap(ctx context.Context, devConfig *amdv1alpha1.DeviceConfig) error {
+	devConfigList := amdv1alpha1.DeviceConfigList{}
+	if err := w.client.List(ctx, &devConfigList); err != nil {
+		return fmt.Errorf("failed to list DeviceConfigs: %v", err)
+	}
+
+	selector := utils.GetNodeSelector(devConfig)
+	var nodes *v1.NodeList
+	overlapping := []string{}
+	for i := range devConfigList.Items {
+		other := &devConfigList.Items[i]
+		if other.Namespace == devConfig.Namespace && other.Name == devConfig.Name {
+			continue
+		}
+		otherSelector := utils.GetNodeSelector(other)
+		switch {
+		case selectorsConflict(selector, otherSelector):
+			continue
+		case !isSubset(selector, otherSelector) && !isSubset(otherSelector, selector):
+			// selectors requiring different labels only overlap on the nodes carrying the labels of both
+			if nodes == nil {
+				nodes = &v1.NodeList{}
+				if err := w.client.List(ctx, nodes, client.MatchingLabels(selector)); err != nil {
+					return fmt.Errorf("failed to list nodes matching DeviceConfig selector: %v", err)
+				}
+			}
+			if !anyNodeMatches(nodes, otherSelector) {
+				continue
+			}
+		}
+		overlapping = append(overlapping, other.Namespace+"/"+other.Name)
+	}
+
+	if len(overlapping) > 0 {
+		sort.Strings(overlapping)
+		return fmt.Errorf("selector overlaps with the selector of DeviceConfigs %s", strings.Join(overlapping, ", "))
+	}
+
+	return nil
+}
+
+// selectorsConflict returns true if the selectors require different values for the same label,
+// so that no node can match both
+func selectorsConflict(first, second map[string]string) bool {
+	for key, value := range first {
+		if otherValue, ok := second[key]; ok && otherValue != value {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubset returns true if all the labels required by first are required with the same value by second,
+// so that every node matching second also matches first
+func isSubset(first, second map[string]string) bool {
+	for key, value := range first {
+		if otherValue, ok := second[key]; !ok || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+func anyNodeMatches(nodes *v1.NodeList, selector map[string]string) bool {
+	for _, node := range nodes.Items {
+		if labels.SelectorFromSet(selector).Matches(labels.Set(node.Labels)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,581 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	amdv1alpha1 "github.com/yevgeny-shnaidman/amd-gpu-operator/api/v1alpha1"
+	mock_client "github.com/yevgeny-shnaidman/amd-gpu-operator/internal/client"
+)
+
+const (
+	devConfigName      = "devConfigName"
+	devConfigNamespace = "devConfigNamespace"
+)
+
+var _ = Describe("Default", func() {
+	w := NewDeviceConfigWebhook(nil)
+
+	It("defaults are set for OOT drivers", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{}
+
+		err := w.Default(context.TODO(), devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(devConfig.Spec.DriversVersion).To(Equal("el9-6.1.1"))
+		Expect(devConfig.Spec.DevicePluginImage).To(Equal("rocm/k8s-device-plugin"))
+		Expect(devConfig.Spec.Selector).To(Equal(map[string]string{"feature.node.kubernetes.io/pci-1002.present": "true"}))
+	})
+
+	It("drivers version is not set for in-tree drivers", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{Spec: amdv1alpha1.DeviceConfigSpec{UseInTreeDrivers: true}}
+
+		err := w.Default(context.TODO(), devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(devConfig.Spec.DriversVersion).To(BeEmpty())
+	})
+
+	It("user values are not overridden", func() {
+		devConfig := &amdv1alpha1.DeviceConfig{
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				DriversVersion:    "someVersion",
+				DevicePluginImage: "some-registry/device-plugin:v1",
+				Selector:          map[string]string{"some-label": "some-value"},
+			},
+		}
+
+		err := w.Default(context.TODO(), devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(devConfig.Spec.DriversVersion).To(Equal("someVersion"))
+		Expect(devConfig.Spec.DevicePluginImage).To(Equal("some-registry/device-plugin:v1"))
+		Expect(devConfig.Spec.Selector).To(Equal(map[string]string{"some-label": "some-value"}))
+	})
+})
+
+var _ = Describe("validateImage", func() {
+	DescribeTable("image references",
+		func(image string, valid bool) {
+			err := validateImage(image)
+			if valid {
+				Expect(err).ToNot(HaveOccurred())
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+		},
+		Entry("empty image", "", true),
+		Entry("image name only", "rocm/k8s-device-plugin", true),
+		Entry("registry with port and tag", "registry.example.com:5000/ns/image:v1.0", true),
+		Entry("KMM variables", "image-registry.openshift-image-registry.svc:5000/$MOD_NAMESPACE/amd_gpu_kmm_modules:el9-${KERNEL_FULL_VERSION}", true),
+		Entry("KMM kernel version parts", "quay.io/ns/image:${KERNEL_X}.${KERNEL_Y}.$KERNEL_Z", true),
+		Entry("unknown variable", "quay.io/ns/image:${KERNEL_X_Y}", false),
+		Entry("digest", "quay.io/ns/image@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", true),
+		Entry("upper case name", "quay.io/NS/Image", false),
+		Entry("spaces", "quay.io/ns/image :v1", false),
+		Entry("empty tag", "quay.io/ns/image:", false),
+	)
+})
+
+var _ = Describe("validateSelector", func() {
+	It("empty selector", func() {
+		Expect(validateSelector(map[string]string{})).To(HaveOccurred())
+	})
+
+	It("invalid key", func() {
+		Expect(validateSelector(map[string]string{"bad key": "true"})).To(HaveOccurred())
+	})
+
+	It("invalid value", func() {
+		Expect(validateSelector(map[string]string{"key": "bad value"})).To(HaveOccurred())
+	})
+
+	It("valid selector", func() {
+		Expect(validateSelector(map[string]string{"feature.node.kubernetes.io/pci-1002.present": "true"})).ToNot(HaveOccurred())
+	})
+})
+
+var _ = Describe("selectorsConflict", func() {
+	DescribeTable("selectors",
+		func(first, second map[string]string, conflict bool) {
+			Expect(selectorsConflict(first, second)).To(Equal(conflict))
+		},
+		Entry("same selectors", map[string]string{"a": "1"}, map[string]string{"a": "1"}, false),
+		Entry("disjoint keys", map[string]string{"a": "1"}, map[string]string{"b": "1"}, false),
+		Entry("different values", map[string]string{"a": "1", "b": "1"}, map[string]string{"a": "2", "b": "1"}, true),
+	)
+})
+
+var _ = Describe("isSubset", func() {
+	DescribeTable("selectors",
+		func(first, second map[string]string, subset bool) {
+			Expect(isSubset(first, second)).To(Equal(subset))
+		},
+		Entry("same selectors", map[string]string{"a": "1"}, map[string]string{"a": "1"}, true),
+		Entry("fewer labels", map[string]string{"a": "1"}, map[string]string{"a": "1", "b": "1"}, true),
+		Entry("more labels", map[string]string{"a": "1", "b": "1"}, map[string]string{"a": "1"}, false),
+		Entry("shared and different labels", map[string]string{"a": "1", "b": "1"}, map[string]string{"a": "1", "c": "1"}, false),
+	)
+})
+
+var _ = Describe("ValidateCreate", func() {
+	var (
+		kubeClient *mock_client.MockClient
+		w          *DeviceConfigWebhook
+	)
+
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		w = NewDeviceConfigWebhook(kubeClient)
+	})
+
+	ctx := context.Background()
+	newDevConfig := func(name string, selector map[string]string) amdv1alpha1.DeviceConfig {
+		return amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: devConfigNamespace,
+			},
+			Spec: amdv1alpha1.DeviceConfigSpec{
+				Selector: selector,
+			},
+		}
+	}
+
+	It("valid DeviceConfig", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		kubeClient.EXPECT().List(ctx, gomock.Any()).Do(
+			func(_ interface{}, list *amdv1alpha1.DeviceConfigList, _ ...client.ListOption) {
+				list.Items = []amdv1alpha1.DeviceConfig{devConfig, newDevConfig("other", map[string]string{"pool": "b"})}
+			},
+		)
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("overlapping selectors", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		kubeClient.EXPECT().List(ctx, gomock.Any()).Do(
+			func(_ interface{}, list *amdv1alpha1.DeviceConfigList, _ ...client.ListOption) {
+				list.Items = []amdv1alpha1.DeviceConfig{newDevConfig("other", map[string]string{"pool": "a", "zone": "b"})}
+			},
+		)
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(devConfigNamespace + "/other"))
+	})
+
+	It("selectors with disjoint keys matching the same nodes", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any()).Do(
+				func(_ interface{}, list *amdv1alpha1.DeviceConfigList, _ ...client.ListOption) {
+					list.Items = []amdv1alpha1.DeviceConfig{newDevConfig("other", map[string]string{"zone": "b"})}
+				},
+			),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), client.MatchingLabels{"pool": "a"}).Do(
+				func(_ interface{}, list *v1.NodeList, _ ...client.ListOption) {
+					list.Items = []v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"pool": "a", "zone": "b"}}}}
+				},
+			),
+		)
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(devConfigNamespace + "/other"))
+	})
+
+	It("selectors with disjoint keys matching different nodes", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any()).Do(
+				func(_ interface{}, list *amdv1alpha1.DeviceConfigList, _ ...client.ListOption) {
+					list.Items = []amdv1alpha1.DeviceConfig{newDevConfig("other", map[string]string{"zone": "b"})}
+				},
+			),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), client.MatchingLabels{"pool": "a"}).Do(
+				func(_ interface{}, list *v1.NodeList, _ ...client.ListOption) {
+					list.Items = []v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"pool": "a"}}}}
+				},
+			),
+		)
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("selectors sharing a label and requiring different ones, matching different nodes", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a", "zone": "b"})
+		gomock.InOrder(
+			kubeClient.EXPECT().List(ctx, gomock.Any()).Do(
+				func(_ interface{}, list *amdv1alpha1.DeviceConfigList, _ ...client.ListOption) {
+					list.Items = []amdv1alpha1.DeviceConfig{newDevConfig("other", map[string]string{"pool": "a", "rack": "c"})}
+				},
+			),
+			kubeClient.EXPECT().List(ctx, gomock.Any(), client.MatchingLabels{"pool": "a", "zone": "b"}).Do(
+				func(_ interface{}, list *v1.NodeList, _ ...client.ListOption) {
+					list.Items = []v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"pool": "a", "zone": "b"}}}}
+				},
+			),
+		)
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("failed to list DeviceConfigs", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		kubeClient.EXPECT().List(ctx, gomock.Any()).Return(fmt.Errorf("some error"))
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("metrics node port without NodePort service type", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.MetricsExporter.NodePort = 30110
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("metrics TLS without certificate secret", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.MetricsExporter.TLS = &amdv1alpha1.MetricsTLSSpec{}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("device plugin config ConfigMap without name", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.DevicePlugin.ConfigMap = &v1.LocalObjectReference{}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("device plugin args repeating the resource naming strategy", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.DevicePlugin.ResourceNamingStrategy = amdv1alpha1.ResourceNamingStrategySingle
+		devConfig.Spec.DevicePlugin.Args = []string{"--resource_naming_strategy=mixed"}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("upgrade policy with invalid pod selector", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.UpgradePolicy = &amdv1alpha1.UpgradePolicySpec{PodSelector: "gpu in (a"}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("upgrade policy with a drivers version that is not a valid label value", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.DriversVersion = "6.1.1+build"
+		devConfig.Spec.UpgradePolicy = &amdv1alpha1.UpgradePolicySpec{}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("driversVersion"))
+	})
+
+	It("upgrade policy with invalid maxUnavailable", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		maxUnavailable := intstr.FromString("half")
+		devConfig.Spec.UpgradePolicy = &amdv1alpha1.UpgradePolicySpec{MaxUnavailable: &maxUnavailable}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("inbox driver blacklist with in-tree drivers", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.UseInTreeDrivers = true
+		devConfig.Spec.Blacklist.Enable = true
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("build dockerfile ConfigMap with in-tree drivers", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.UseInTreeDrivers = true
+		devConfig.Spec.Driver.Build.DockerfileConfigMap = &v1.LocalObjectReference{Name: "my-dockerfile"}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("preflight with in-tree drivers", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.UseInTreeDrivers = true
+		devConfig.Spec.Driver.Preflight.Enable = true
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("build dockerfile ConfigMap without name", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.Driver.Build.DockerfileConfigMap = &v1.LocalObjectReference{}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("drivers image with the Always build policy", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.Driver.Build.Policy = amdv1alpha1.BuildPolicyAlways
+		devConfig.Spec.KernelMappings = []amdv1alpha1.KernelMapping{{Regexp: "^.+$", DriversImage: "quay.io/ns/drivers"}}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("signing with the Never build policy", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.Driver.Build.Policy = amdv1alpha1.BuildPolicyNever
+		devConfig.Spec.Signing = &amdv1alpha1.ModuleSigning{
+			KeySecret:  &v1.LocalObjectReference{Name: "key"},
+			CertSecret: &v1.LocalObjectReference{Name: "cert"},
+		}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("extra build arg set by the operator", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.Driver.Build.ExtraBuildArgs = []amdv1alpha1.BuildArg{{Name: "DRIVERS_VERSION", Value: "6.2"}}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("extra build arg without name", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.Driver.Build.ExtraBuildArgs = []amdv1alpha1.BuildArg{{Value: "value"}}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("invalid sources image repository", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.Driver.Build.SourcesImageRepo = "registry.example.com/AMD/sources"
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("valid modprobe parameters and load order", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.Driver.Modprobe = amdv1alpha1.ModprobeSpec{
+			Parameters: []string{"sched_policy=1", "ras_enable=0", "vm_fragment_size=9", "noretry=1"},
+			LoadOrder:  []string{"amdkcl", "amdxcp", "amd-sched", "amdttm", "amdgpu"},
+		}
+		kubeClient.EXPECT().List(ctx, gomock.Any()).Return(nil)
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("unknown modprobe parameter", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.Driver.Modprobe.Parameters = []string{"not_a_param=1"}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("modprobe parameter without value", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.Driver.Modprobe.Parameters = []string{"sched_policy"}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("modprobe parameters with raw args", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.Driver.Modprobe.Parameters = []string{"sched_policy=1"}
+		devConfig.Spec.Driver.Modprobe.RawArgs = &amdv1alpha1.ModprobeArgs{Load: []string{"amdgpu"}}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("modprobe load order not ending with amdgpu", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.Driver.Modprobe.LoadOrder = []string{"amdgpu", "amdttm"}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("drivers image with in-tree drivers", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.UseInTreeDrivers = true
+		devConfig.Spec.DriversImage = "quay.io/ns/drivers"
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("partitioning with an invalid pod selector", func() {
+		devConfig := newDevConfig(devConfigName, map[string]string{"pool": "a"})
+		devConfig.Spec.Partitioning = &amdv1alpha1.PartitioningSpec{ComputePartition: "CPX", PodSelector: "app in"}
+
+		_, err := w.ValidateCreate(ctx, &devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("ValidateUpdate", func() {
+	var (
+		kubeClient *mock_client.MockClient
+		w          *DeviceConfigWebhook
+	)
+
+	BeforeEach(func() {
+		ctrl := gomock.NewController(GinkgoT())
+		kubeClient = mock_client.NewMockClient(ctrl)
+		w = NewDeviceConfigWebhook(kubeClient)
+	})
+
+	ctx := context.Background()
+	newDevConfig := func(selector map[string]string) *amdv1alpha1.DeviceConfig {
+		return &amdv1alpha1.DeviceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: devConfigName, Namespace: devConfigNamespace},
+			Spec:       amdv1alpha1.DeviceConfigSpec{Selector: selector},
+		}
+	}
+
+	It("metadata update of an invalid DeviceConfig", func() {
+		oldDevConfig := newDevConfig(map[string]string{})
+		devConfig := oldDevConfig.DeepCopy()
+		devConfig.Finalizers = []string{"some-finalizer"}
+
+		_, err := w.ValidateUpdate(ctx, oldDevConfig, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("DeviceConfig being deleted", func() {
+		oldDevConfig := newDevConfig(map[string]string{"pool": "a"})
+		devConfig := newDevConfig(map[string]string{})
+		now := metav1.Now()
+		devConfig.DeletionTimestamp = &now
+
+		_, err := w.ValidateUpdate(ctx, oldDevConfig, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("spec update without selector change skips the overlap check", func() {
+		oldDevConfig := newDevConfig(map[string]string{"pool": "a"})
+		devConfig := oldDevConfig.DeepCopy()
+		devConfig.Spec.DriversVersion = "v2"
+
+		_, err := w.ValidateUpdate(ctx, oldDevConfig, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("invalid spec update", func() {
+		oldDevConfig := newDevConfig(map[string]string{"pool": "a"})
+		devConfig := newDevConfig(map[string]string{})
+
+		_, err := w.ValidateUpdate(ctx, oldDevConfig, devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("kernel mapping drivers image change with an upgrade policy", func() {
+		oldDevConfig := newDevConfig(map[string]string{"pool": "a"})
+		oldDevConfig.Spec.DriversVersion = "v1"
+		oldDevConfig.Spec.UpgradePolicy = &amdv1alpha1.UpgradePolicySpec{}
+		oldDevConfig.Spec.KernelMappings = []amdv1alpha1.KernelMapping{{Regexp: "^.+$", DriversImage: "quay.io/ns/drivers:a"}}
+		devConfig := oldDevConfig.DeepCopy()
+		devConfig.Spec.KernelMappings[0].DriversImage = "quay.io/ns/drivers:b"
+
+		_, err := w.ValidateUpdate(ctx, oldDevConfig, devConfig)
+
+		Expect(err).To(HaveOccurred())
+
+		devConfig.Spec.DriversVersion = "v2"
+
+		_, err = w.ValidateUpdate(ctx, oldDevConfig, devConfig)
+
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("selector update is checked for overlaps", func() {
+		oldDevConfig := newDevConfig(map[string]string{"pool": "a"})
+		devConfig := newDevConfig(map[string]string{"pool": "b"})
+		kubeClient.EXPECT().List(ctx, gomock.Any()).Return(fmt.Errorf("some error"))
+
+		_, err := w.ValidateUpdate(ctx, oldDevConfig, devConfig)
+
+		Expect(err).To(HaveOccurred())
+	})
+})